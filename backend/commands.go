@@ -0,0 +1,99 @@
+// package api contains api implementation for backend
+// this file contains command line subcommands
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/gtfs"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// RunCommand runs command line subcommand given by args
+// go run . gtfs-export [file]
+// go run . gtfs-import file [--dry-run]
+// go run . realtime-simulate [interval-seconds] [--once]
+// go run . maintenance-schedule
+func RunCommand(args []string) error {
+	switch args[0] {
+	case "gtfs-export":
+		path := "gtfs.zip"
+		if len(args) > 1 {
+			path = args[1]
+		}
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := gtfs.Export(file); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	case "gtfs-import":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: gtfs-import file [--dry-run]")
+		}
+		file, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		report, err := gtfs.Import(file, info.Size(), len(args) > 2 && args[2] == "--dry-run")
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(report)
+	case "realtime-simulate":
+		interval := 30 * time.Second
+		once := false
+		for _, arg := range args[1:] {
+			if arg == "--once" {
+				once = true
+				continue
+			}
+			seconds, err := strconv.Atoi(arg)
+			if err != nil || seconds < 1 {
+				return fmt.Errorf("usage: realtime-simulate [interval-seconds] [--once]")
+			}
+			interval = time.Duration(seconds) * time.Second
+		}
+		return SimulateRealtime(interval, once)
+	case "services-generate":
+		days := serializers.ServiceHorizonDays
+		if len(args) > 1 {
+			var err error
+			days, err = strconv.Atoi(args[1])
+			if err != nil || days < 0 || days > serializers.ServiceMaxDays {
+				return fmt.Errorf("usage: services-generate [days]")
+			}
+		}
+		created, err := serializers.Generate_service_connections(utils.Wall_clock_now().AddDate(0, 0, days))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created %d connections\n", created)
+		return nil
+	case "maintenance-schedule":
+		created, err := serializers.Schedule_maintenance(time.Now())
+		if err != nil {
+			return err
+		}
+		for _, request := range created {
+			fmt.Printf("created maintenance request %d for vehicle %s\n", request.ID, *request.VehicleRef)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown command %s", args[0])
+}
@@ -0,0 +1,256 @@
+// package gtfs contains import and export of timetables in GTFS format
+// this file contains export of static GTFS feed
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// AgencyID is id of the only agency in exported feed
+const AgencyID = "IIS"
+
+// GTFS route types
+const (
+	RouteTypeTram = 0
+	RouteTypeBus  = 3
+)
+
+// TripID returns GTFS trip id of connection
+// realtime feed uses the same ids so both feeds can be matched
+func TripID(connection_id uint) string {
+	return strconv.FormatUint(uint64(connection_id), 10)
+}
+
+// ServiceID returns GTFS service id of day the connection departs in
+func ServiceID(departure time.Time) string {
+	return departure.Format("20060102")
+}
+
+// DirectionID returns GTFS direction id of connection direction
+func DirectionID(direction bool) string {
+	if direction {
+		return "1"
+	}
+	return "0"
+}
+
+// FormatTime formats time as GTFS time measured from midnight of service day
+// times after midnight are represented as hours greater than 23
+func FormatTime(t time.Time, service_day time.Time) string {
+	midnight := time.Date(service_day.Year(), service_day.Month(), service_day.Day(), 0, 0, 0, 0, service_day.Location())
+	seconds := int(t.Sub(midnight).Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+}
+
+// getEnv returns environment variable or default value if it is not set
+func getEnv(name string, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// optionalString returns value or empty string when it is not set
+func optionalString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// RouteType returns GTFS route type for vehicle type
+func RouteType(vehicle_type string) int {
+	if vehicle_type == "tram" {
+		return RouteTypeTram
+	}
+	return RouteTypeBus
+}
+
+// Export writes stops, lines, segments and connections shown to passengers as GTFS zip into w
+func Export(w io.Writer) error {
+	var stops []models.Stop
+	if res := utils.DB.Order("id").Find(&stops); res.Error != nil {
+		return res.Error
+	}
+	var lines []models.Line
+	if res := utils.DB.Order("name").Find(&lines); res.Error != nil {
+		return res.Error
+	}
+	// feed has only connections passengers can see
+	var connections []models.Connection
+	if res := utils.DB.Where(serializers.PublicConnections).Order("departure_time").Find(&connections); res.Error != nil {
+		return res.Error
+	}
+
+	archive := zip.NewWriter(w)
+
+	// agency.txt
+	err := writeFile(archive, "agency.txt",
+		[]string{"agency_id", "agency_name", "agency_url", "agency_timezone"},
+		[][]string{{
+			AgencyID,
+			getEnv("GTFS_AGENCY_NAME", "IIS"),
+			getEnv("GTFS_AGENCY_URL", "https://iis-beryl.vercel.app"),
+			getEnv("GTFS_AGENCY_TIMEZONE", "Europe/Prague"),
+		}})
+	if err != nil {
+		return err
+	}
+
+	// stops.txt
+	stop_ids := map[string]string{}
+	stations := map[uint]bool{}
+	for _, stop := range stops {
+		if stop.ParentID != nil {
+			stations[*stop.ParentID] = true
+		}
+	}
+	rows := [][]string{}
+	for _, stop := range stops {
+		stop_ids[stop.Name] = strconv.FormatUint(uint64(stop.ID), 10)
+		location_type, parent_station := "0", ""
+		if stations[stop.ID] {
+			location_type = "1"
+		}
+		if stop.ParentID != nil {
+			parent_station = strconv.FormatUint(uint64(*stop.ParentID), 10)
+		}
+		latitude, longitude := "", ""
+		if stop.Latitude != nil && stop.Longitude != nil {
+			latitude = strconv.FormatFloat(*stop.Latitude, 'f', -1, 64)
+			longitude = strconv.FormatFloat(*stop.Longitude, 'f', -1, 64)
+		}
+		wheelchair_boarding := "0" // no information
+		if stop.Accessible {
+			wheelchair_boarding = "1"
+		}
+		rows = append(rows, []string{stop_ids[stop.Name], stop.Name, latitude, longitude,
+			optionalString(stop.Zone), optionalString(stop.Platform), wheelchair_boarding, location_type, parent_station})
+	}
+	err = writeFile(archive, "stops.txt", []string{"stop_id", "stop_name", "stop_lat", "stop_lon",
+		"zone_id", "platform_code", "wheelchair_boarding", "location_type", "parent_station"}, rows)
+	if err != nil {
+		return err
+	}
+
+	// routes.txt
+	route_types := map[string]int{}
+	for _, connection := range connections {
+		if _, ok := route_types[connection.LineName]; ok || connection.VehicleRegistration == nil {
+			continue
+		}
+		vehicle := models.Vehicle{}
+		if res := utils.DB.Find(&vehicle, "registration = ?", connection.VehicleRegistration); res.Error != nil {
+			return res.Error
+		}
+		route_types[connection.LineName] = RouteType(vehicle.VehicleTypeName)
+	}
+	rows = [][]string{}
+	final_stops := map[string][2]string{}
+	for _, line := range lines {
+		route_type, ok := route_types[line.Name]
+		if !ok {
+			route_type = RouteTypeBus
+		}
+		final_stops[line.Name] = [2]string{line.FinalStop, line.InitialStop}
+		rows = append(rows, []string{
+			line.Name,
+			AgencyID,
+			line.Name,
+			line.InitialStop + " - " + line.FinalStop,
+			strconv.Itoa(route_type),
+		})
+	}
+	err = writeFile(archive, "routes.txt", []string{"route_id", "agency_id", "route_short_name", "route_long_name", "route_type"}, rows)
+	if err != nil {
+		return err
+	}
+
+	// trips.txt, stop_times.txt
+	trip_rows := [][]string{}
+	stop_time_rows := [][]string{}
+	service_days := map[string]bool{}
+	for _, connection := range connections {
+		connection_stops, err := serializers.Get_connection_stops(connection.LineName, connection.Direction, connection.DepartureTime)
+		if err != nil {
+			return err
+		}
+		if len(connection_stops) < 2 {
+			continue
+		}
+		headsign := final_stops[connection.LineName][0]
+		if connection.Direction {
+			headsign = final_stops[connection.LineName][1]
+		}
+		service_id := ServiceID(connection.DepartureTime)
+		service_days[service_id] = true
+		trip_rows = append(trip_rows, []string{
+			connection.LineName,
+			service_id,
+			TripID(connection.ID),
+			headsign,
+			DirectionID(connection.Direction),
+		})
+		for i, stop := range connection_stops {
+			stop_time_rows = append(stop_time_rows, []string{
+				TripID(connection.ID),
+				FormatTime(stop.ArrivalTime, connection.DepartureTime),
+				FormatTime(stop.DepartureTime, connection.DepartureTime),
+				stop_ids[stop.StopName],
+				strconv.Itoa(i + 1),
+			})
+		}
+	}
+	err = writeFile(archive, "trips.txt", []string{"route_id", "service_id", "trip_id", "trip_headsign", "direction_id"}, trip_rows)
+	if err != nil {
+		return err
+	}
+	err = writeFile(archive, "stop_times.txt", []string{"trip_id", "arrival_time", "departure_time", "stop_id", "stop_sequence"}, stop_time_rows)
+	if err != nil {
+		return err
+	}
+
+	// calendar_dates.txt
+	days := []string{}
+	for day := range service_days {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	rows = [][]string{}
+	for _, day := range days {
+		rows = append(rows, []string{day, day, "1"})
+	}
+	err = writeFile(archive, "calendar_dates.txt", []string{"service_id", "date", "exception_type"}, rows)
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// writeFile writes csv file with header and rows into zip archive
+func writeFile(archive *zip.Writer, name string, header []string, rows [][]string) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
@@ -0,0 +1,751 @@
+// package gtfs contains import and export of timetables in GTFS format
+// this file contains import of static GTFS feed
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+	"gorm.io/gorm"
+)
+
+// ImportCounts holds number of records touched by import
+type ImportCounts struct {
+	Created   int
+	Updated   int
+	Unchanged int
+}
+
+// ImportChange describes one record created or updated by import
+type ImportChange struct {
+	Entity string
+	Key    string
+	Action string
+}
+
+// RowErr describes invalid row of imported feed which was skipped
+type RowErr struct {
+	File  string
+	Row   int
+	ID    string
+	Error string
+}
+
+// ImportConflict describes assigned connection which kept its times because its driver or vehicle
+// would not be available with the imported ones
+type ImportConflict struct {
+	ConnectionID uint
+	Key          string
+	Error        string
+}
+
+// ImportReport describes changes made by import
+// in dry run the changes are only reported and not saved
+type ImportReport struct {
+	DryRun      bool
+	Stops       ImportCounts
+	Lines       ImportCounts
+	Connections ImportCounts
+	Changes     []ImportChange
+	Errors      []RowErr
+	Conflicts   []ImportConflict
+}
+
+// errDryRun rolls back transaction of dry run import
+var errDryRun = errors.New("dry run")
+
+// feedRow is one row of csv file with its row number
+type feedRow struct {
+	number int
+	values map[string]string
+}
+
+func (r feedRow) get(name string) string {
+	return strings.TrimSpace(r.values[name])
+}
+
+// importTrip is trip with its stops read from feed
+type importTrip struct {
+	row        feedRow
+	id         string
+	line       string
+	service    string
+	direction  bool
+	stops      []string
+	arrivals   []int
+	departures []int
+	valid      bool
+}
+
+// Import reads GTFS zip and creates or updates stops, lines and connections in one transaction
+// invalid rows are reported and skipped, when dry_run is set nothing is saved
+func Import(r io.ReaderAt, size int64, dry_run bool) (*ImportReport, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]feedRow{}
+	for _, name := range []string{"agency.txt", "stops.txt", "routes.txt", "trips.txt", "stop_times.txt", "calendar.txt", "calendar_dates.txt"} {
+		rows, err := readFile(archive, name)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = rows
+	}
+	for _, name := range []string{"stops.txt", "routes.txt", "trips.txt", "stop_times.txt"} {
+		if files[name] == nil {
+			return nil, fmt.Errorf("feed does not contain %s", name)
+		}
+	}
+	if files["calendar.txt"] == nil && files["calendar_dates.txt"] == nil {
+		return nil, fmt.Errorf("feed does not contain calendar.txt nor calendar_dates.txt")
+	}
+
+	report := &ImportReport{DryRun: dry_run, Changes: []ImportChange{}, Errors: []RowErr{}, Conflicts: []ImportConflict{}}
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		stop_names, err := importStops(tx, files["stops.txt"], report)
+		if err != nil {
+			return err
+		}
+		line_names := importRoutes(files["routes.txt"], report)
+		services := readServices(files["calendar.txt"], files["calendar_dates.txt"], report)
+		trips := readTrips(files["trips.txt"], files["stop_times.txt"], line_names, stop_names, report)
+		if err := importLines(tx, trips, report); err != nil {
+			return err
+		}
+		if err := importConnections(tx, trips, services, report); err != nil {
+			return err
+		}
+		if dry_run {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return report, nil
+}
+
+// readFile reads csv file from archive, returns nil if the file is not present
+func readFile(archive *zip.Reader, name string) ([]feedRow, error) {
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil, nil
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
+	rows := []feedRow{}
+	if len(records) == 0 {
+		return rows, nil
+	}
+	header := records[0]
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+	for i, record := range records[1:] {
+		row := feedRow{number: i + 2, values: map[string]string{}}
+		for j, value := range record {
+			if j < len(header) {
+				row.values[header[j]] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// importStops creates missing stops and stations (location_type 1) and links platforms to their parent_station
+// returns map of GTFS stop ids of stops which are not stations to stop names
+func importStops(tx *gorm.DB, rows []feedRow, report *ImportReport) (map[string]string, error) {
+	stop_names := map[string]string{}
+	station_ids := map[string]uint{}
+	// stations are imported first, so their platforms can refer to them
+	for _, stations := range []bool{true, false} {
+		for _, row := range rows {
+			location_type := row.get("location_type")
+			if location_type != "" && location_type != "0" && location_type != "1" {
+				continue
+			}
+			if (location_type == "1") != stations {
+				continue
+			}
+			id, name := row.get("stop_id"), row.get("stop_name")
+			if id == "" || name == "" {
+				report.Errors = append(report.Errors, RowErr{"stops.txt", row.number, id, "stop_id and stop_name are required"})
+				continue
+			}
+
+			stop := models.Stop{}
+			res := tx.Where("name = ?", name).Find(&stop)
+			if res.Error != nil {
+				return nil, res.Error
+			}
+			changed, err := readStopAttributes(row, &stop)
+			if err != nil {
+				report.Errors = append(report.Errors, RowErr{"stops.txt", row.number, id, err.Error()})
+			}
+			if parent := row.get("parent_station"); !stations && parent != "" {
+				if parent_id, ok := station_ids[parent]; !ok {
+					report.Errors = append(report.Errors, RowErr{"stops.txt", row.number, id, "parent station " + parent + " does not exist"})
+				} else if stop.ParentID == nil || *stop.ParentID != parent_id {
+					stop.ParentID = &parent_id
+					changed = true
+				}
+			}
+			if res.RowsAffected > 0 && changed {
+				if res := tx.Save(&stop); res.Error != nil {
+					return nil, res.Error
+				}
+				report.Stops.Updated++
+				report.Changes = append(report.Changes, ImportChange{"stop", name, "update"})
+			} else if res.RowsAffected > 0 {
+				report.Stops.Unchanged++
+			} else {
+				stop.Name = name
+				if res := tx.Create(&stop); res.Error != nil {
+					return nil, res.Error
+				}
+				report.Stops.Created++
+				report.Changes = append(report.Changes, ImportChange{"stop", name, "create"})
+			}
+			if stations {
+				station_ids[id] = stop.ID
+			} else {
+				stop_names[id] = name
+			}
+		}
+	}
+	return stop_names, nil
+}
+
+// readStopAttributes loads coordinates, zone, platform and accessibility given in row into stop
+// attributes missing in row are kept, returns whether stop was changed
+func readStopAttributes(row feedRow, stop *models.Stop) (bool, error) {
+	changed := false
+	if row.get("stop_lat") != "" || row.get("stop_lon") != "" {
+		latitude, err := strconv.ParseFloat(row.get("stop_lat"), 64)
+		if err != nil {
+			return false, errors.New("invalid stop_lat")
+		}
+		longitude, err := strconv.ParseFloat(row.get("stop_lon"), 64)
+		if err != nil {
+			return false, errors.New("invalid stop_lon")
+		}
+		validator_errs := []validators.ValidatorErr{}
+		if validators.Stop_coordinates_validator(&latitude, &longitude, &validator_errs); len(validator_errs) != 0 {
+			return false, errors.New(validator_errs[0].Desc)
+		}
+		if stop.Latitude == nil || *stop.Latitude != latitude || stop.Longitude == nil || *stop.Longitude != longitude {
+			stop.Latitude, stop.Longitude = &latitude, &longitude
+			changed = true
+		}
+	}
+	if zone := row.get("zone_id"); zone != "" && (stop.Zone == nil || *stop.Zone != zone) {
+		stop.Zone = &zone
+		changed = true
+	}
+	if platform := row.get("platform_code"); platform != "" && (stop.Platform == nil || *stop.Platform != platform) {
+		stop.Platform = &platform
+		changed = true
+	}
+	if wheelchair_boarding := row.get("wheelchair_boarding"); wheelchair_boarding == "1" || wheelchair_boarding == "2" {
+		if accessible := wheelchair_boarding == "1"; stop.Accessible != accessible {
+			stop.Accessible = accessible
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// importRoutes returns map of GTFS route ids to line names
+func importRoutes(rows []feedRow, report *ImportReport) map[string]string {
+	line_names := map[string]string{}
+	for _, row := range rows {
+		id := row.get("route_id")
+		name := row.get("route_short_name")
+		if name == "" {
+			name = row.get("route_long_name")
+		}
+		if name == "" {
+			name = id
+		}
+		if id == "" {
+			report.Errors = append(report.Errors, RowErr{"routes.txt", row.number, id, "route_id is required"})
+			continue
+		}
+		line_names[id] = name
+	}
+	return line_names
+}
+
+// readServices returns map of GTFS service ids to days the service runs in
+// days are dates in UTC same as days of timetable
+func readServices(calendar []feedRow, calendar_dates []feedRow, report *ImportReport) map[string][]time.Time {
+	days := map[string]map[string]time.Time{}
+	weekdays := []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+	for _, row := range calendar {
+		id := row.get("service_id")
+		start, err_start := time.Parse("20060102", row.get("start_date"))
+		end, err_end := time.Parse("20060102", row.get("end_date"))
+		if id == "" || err_start != nil || err_end != nil || end.Before(start) {
+			report.Errors = append(report.Errors, RowErr{"calendar.txt", row.number, id, "invalid service_id or date range"})
+			continue
+		}
+		if days[id] == nil {
+			days[id] = map[string]time.Time{}
+		}
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			if row.get(weekdays[day.Weekday()]) == "1" {
+				days[id][day.Format("20060102")] = day
+			}
+		}
+	}
+	for _, row := range calendar_dates {
+		id := row.get("service_id")
+		day, err := time.Parse("20060102", row.get("date"))
+		if id == "" || err != nil {
+			report.Errors = append(report.Errors, RowErr{"calendar_dates.txt", row.number, id, "invalid service_id or date"})
+			continue
+		}
+		if days[id] == nil {
+			days[id] = map[string]time.Time{}
+		}
+		switch row.get("exception_type") {
+		case "1":
+			days[id][day.Format("20060102")] = day
+		case "2":
+			delete(days[id], day.Format("20060102"))
+		default:
+			report.Errors = append(report.Errors, RowErr{"calendar_dates.txt", row.number, id, "invalid exception_type"})
+		}
+	}
+	services := map[string][]time.Time{}
+	for id, service_days := range days {
+		for _, day := range service_days {
+			services[id] = append(services[id], day)
+		}
+		sort.Slice(services[id], func(i, j int) bool {
+			return services[id][i].Before(services[id][j])
+		})
+	}
+	return services
+}
+
+// parseTime parses GTFS time into seconds from midnight of service day
+func parseTime(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %s", value)
+	}
+	total := 0
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 || (i > 0 && number > 59) {
+			return 0, fmt.Errorf("invalid time %s", value)
+		}
+		total = total*60 + number
+	}
+	return total, nil
+}
+
+// readTrips reads trips and their stop times ordered by stop sequence
+func readTrips(trip_rows []feedRow, stop_time_rows []feedRow, line_names map[string]string, stop_names map[string]string, report *ImportReport) []*importTrip {
+	trips := []*importTrip{}
+	trips_by_id := map[string]*importTrip{}
+	for _, row := range trip_rows {
+		trip := &importTrip{
+			row:       row,
+			id:        row.get("trip_id"),
+			service:   row.get("service_id"),
+			direction: row.get("direction_id") == "1",
+			valid:     true,
+		}
+		line, ok := line_names[row.get("route_id")]
+		if trip.id == "" || !ok {
+			report.Errors = append(report.Errors, RowErr{"trips.txt", row.number, trip.id, "trip_id missing or route does not exist"})
+			continue
+		}
+		trip.line = line
+		trips = append(trips, trip)
+		trips_by_id[trip.id] = trip
+	}
+
+	type stopTime struct {
+		sequence  int
+		stop      string
+		arrival   int
+		departure int
+	}
+	stop_times := map[string][]stopTime{}
+	for _, row := range stop_time_rows {
+		trip, ok := trips_by_id[row.get("trip_id")]
+		if !ok {
+			report.Errors = append(report.Errors, RowErr{"stop_times.txt", row.number, row.get("trip_id"), "trip does not exist"})
+			continue
+		}
+		if !trip.valid {
+			continue
+		}
+		sequence, err := strconv.Atoi(row.get("stop_sequence"))
+		if err != nil {
+			report.Errors = append(report.Errors, RowErr{"stop_times.txt", row.number, trip.id, "invalid stop_sequence"})
+			trip.valid = false
+			continue
+		}
+		stop, ok := stop_names[row.get("stop_id")]
+		if !ok {
+			report.Errors = append(report.Errors, RowErr{"stop_times.txt", row.number, trip.id, "stop " + row.get("stop_id") + " does not exist"})
+			trip.valid = false
+			continue
+		}
+		arrival_value, departure_value := row.get("arrival_time"), row.get("departure_time")
+		if departure_value == "" {
+			departure_value = arrival_value
+		}
+		if arrival_value == "" {
+			arrival_value = departure_value
+		}
+		arrival, err := parseTime(arrival_value)
+		if err != nil {
+			report.Errors = append(report.Errors, RowErr{"stop_times.txt", row.number, trip.id, err.Error()})
+			trip.valid = false
+			continue
+		}
+		departure, err := parseTime(departure_value)
+		if err != nil {
+			report.Errors = append(report.Errors, RowErr{"stop_times.txt", row.number, trip.id, err.Error()})
+			trip.valid = false
+			continue
+		}
+		if departure < arrival || (departure-arrival)%60 != 0 {
+			report.Errors = append(report.Errors, RowErr{"stop_times.txt", row.number, trip.id, "dwell time must be whole minutes and must not be negative"})
+			trip.valid = false
+			continue
+		}
+		stop_times[trip.id] = append(stop_times[trip.id], stopTime{sequence, stop, arrival, departure})
+	}
+
+	for _, trip := range trips {
+		if !trip.valid {
+			continue
+		}
+		times := stop_times[trip.id]
+		sort.Slice(times, func(i, j int) bool { return times[i].sequence < times[j].sequence })
+		for i, stop_time := range times {
+			if i > 0 && (stop_time.arrival < times[i-1].departure || (stop_time.arrival-times[i-1].departure)%60 != 0) {
+				report.Errors = append(report.Errors, RowErr{"trips.txt", trip.row.number, trip.id, "travel times must be whole minutes and must not decrease"})
+				trip.valid = false
+				break
+			}
+			trip.stops = append(trip.stops, stop_time.stop)
+			trip.arrivals = append(trip.arrivals, stop_time.arrival)
+			trip.departures = append(trip.departures, stop_time.departure)
+		}
+		if trip.valid && len(trip.stops) < 2 {
+			report.Errors = append(report.Errors, RowErr{"trips.txt", trip.row.number, trip.id, "trip must have at least 2 stops"})
+			trip.valid = false
+		}
+	}
+	return trips
+}
+
+// tripSegments returns ordered segments of line driven by trip in direction Initial->Final
+// dwell times of trip stops are kept for intermediate stops
+func tripSegments(trip *importTrip) []models.Segment {
+	last := len(trip.stops) - 1
+	segments := []models.Segment{}
+	for k := 0; k < last; k++ {
+		// from and to are indexes of segment stops in trip
+		from, to := k, k+1
+		if trip.direction {
+			from, to = last-k, last-k-1
+		}
+		segment := models.Segment{
+			Sequence:  uint(k + 1),
+			StopName1: trip.stops[from],
+			StopName2: trip.stops[to],
+			LineName:  trip.line,
+		}
+		if trip.direction {
+			segment.Time = uint((trip.arrivals[from] - trip.departures[to]) / 60)
+		} else {
+			segment.Time = uint((trip.arrivals[to] - trip.departures[from]) / 60)
+		}
+		if k+1 < last {
+			segment.DwellTime = uint((trip.departures[to] - trip.arrivals[to]) / 60)
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// reverseSegments returns ordered segments of reverse direction in order driven by trip
+func reverseSegments(trip *importTrip) []models.Segment {
+	last := len(trip.stops) - 1
+	segments := []models.Segment{}
+	for k := 0; k < last; k++ {
+		segment := models.Segment{
+			Sequence:  uint(k + 1),
+			Direction: true,
+			StopName1: trip.stops[k],
+			StopName2: trip.stops[k+1],
+			Time:      uint((trip.arrivals[k+1] - trip.departures[k]) / 60),
+			LineName:  trip.line,
+		}
+		if k+1 < last {
+			segment.DwellTime = uint((trip.departures[k+1] - trip.arrivals[k+1]) / 60)
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// sameSegments checks if two segment sequences describe the same route with the same times
+func sameSegments(a []models.Segment, b []models.Segment) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Direction != b[i].Direction || a[i].StopName1 != b[i].StopName1 || a[i].StopName2 != b[i].StopName2 ||
+			a[i].Time != b[i].Time || a[i].DwellTime != b[i].DwellTime {
+			return false
+		}
+	}
+	return true
+}
+
+// tripMatches checks if trip drives stops of line in its direction with the same times
+// dwell time in first and last stop of trip is ignored
+func tripMatches(trip *importTrip, segments []models.Segment) bool {
+	stops := serializers.Line_stops(segments, trip.direction)
+	if len(stops) != len(trip.stops) {
+		return false
+	}
+	start := trip.departures[0]
+	for i, stop := range stops {
+		if stop.StopName != trip.stops[i] {
+			return false
+		}
+		if i > 0 && time.Duration(trip.arrivals[i]-start)*time.Second != stop.Arrival {
+			return false
+		}
+		if i > 0 && i < len(stops)-1 && time.Duration(trip.departures[i]-start)*time.Second != stop.Departure {
+			return false
+		}
+	}
+	return true
+}
+
+// importLines creates or updates lines from trips and validates trips against them
+// segments of line are taken from its first valid trip in direction Initial->Final,
+// first valid trip in reverse direction adds own reverse segments if it drives the line differently
+func importLines(tx *gorm.DB, trips []*importTrip, report *ImportReport) error {
+	forward := map[string]*importTrip{}
+	reverse := map[string]*importTrip{}
+	line_order := []string{}
+	for _, trip := range trips {
+		if !trip.valid {
+			continue
+		}
+		if forward[trip.line] == nil && reverse[trip.line] == nil {
+			line_order = append(line_order, trip.line)
+		}
+		if !trip.direction && forward[trip.line] == nil {
+			forward[trip.line] = trip
+		}
+		if trip.direction && reverse[trip.line] == nil {
+			reverse[trip.line] = trip
+		}
+	}
+
+	line_segments := map[string][]models.Segment{}
+	for _, line_name := range line_order {
+		var segments []models.Segment
+		if forward[line_name] == nil {
+			segments = tripSegments(reverse[line_name])
+		} else {
+			segments = tripSegments(forward[line_name])
+			if reverse[line_name] != nil && !sameSegments(tripSegments(reverse[line_name]), segments) {
+				segments = append(segments, reverseSegments(reverse[line_name])...)
+			}
+		}
+		line_segments[line_name] = segments
+		forward_segments := serializers.Direction_segments(segments, false)
+
+		var line models.Line
+		res := tx.Preload("Segments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("direction, sequence, id")
+		}).Where("name = ?", line_name).Find(&line)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			line = models.Line{
+				Name:        line_name,
+				InitialStop: forward_segments[0].StopName1,
+				FinalStop:   forward_segments[len(forward_segments)-1].StopName2,
+				Segments:    segments,
+			}
+			if res := tx.Create(&line); res.Error != nil {
+				return res.Error
+			}
+			report.Lines.Created++
+			report.Changes = append(report.Changes, ImportChange{"line", line_name, "create"})
+			continue
+		}
+		if sameSegments(line.Segments, segments) {
+			report.Lines.Unchanged++
+			continue
+		}
+		if res := tx.Where("line_name = ?", line_name).Delete(&models.Segment{}); res.Error != nil {
+			return res.Error
+		}
+		line.InitialStop = forward_segments[0].StopName1
+		line.FinalStop = forward_segments[len(forward_segments)-1].StopName2
+		line.Segments = segments
+		if res := tx.Save(&line); res.Error != nil {
+			return res.Error
+		}
+		if err := retimeConnections(tx, line_name, segments, report); err != nil {
+			return err
+		}
+		report.Lines.Updated++
+		report.Changes = append(report.Changes, ImportChange{"line", line_name, "update"})
+	}
+
+	for _, trip := range trips {
+		if trip.valid && !tripMatches(trip, line_segments[trip.line]) {
+			report.Errors = append(report.Errors, RowErr{"trips.txt", trip.row.number, trip.id, "stop sequence or times do not match segments of line " + trip.line})
+			trip.valid = false
+		}
+	}
+	return nil
+}
+
+// retimeConnections moves arrival times of connections of line which did not depart yet to follow new segments
+// assigned connection whose driver or vehicle would not be available keeps its arrival and is reported as conflict
+func retimeConnections(tx *gorm.DB, line_name string, segments []models.Segment, report *ImportReport) error {
+	var connections []models.Connection
+	res := tx.Where("line_name = ? AND departure_time > ?", line_name, utils.Wall_clock_now()).Order("departure_time").Find(&connections)
+	if res.Error != nil {
+		return res.Error
+	}
+	durations := map[bool]time.Duration{}
+	for _, direction := range []bool{false, true} {
+		durations[direction] = time.Duration(int(serializers.Line_duration(segments, direction).Minutes())) * time.Minute
+	}
+	for i := range connections {
+		connection := &connections[i]
+		arrival := connection.DepartureTime.Add(durations[connection.Direction])
+		if connection.ArrivalTime.Equal(arrival) {
+			continue
+		}
+		connection.ArrivalTime = arrival
+		if conflictReported(connection, report) {
+			continue
+		}
+		if res := tx.Model(connection).Update("arrival_time", arrival); res.Error != nil {
+			return res.Error
+		}
+	}
+	return nil
+}
+
+// conflictReported checks if driver and vehicle of connection are available with its new times
+// and reports conflict when they are not, connection without driver and vehicle has no conflict
+func conflictReported(connection *models.Connection, report *ImportReport) bool {
+	if connection.DriverID == nil && connection.VehicleRegistration == nil {
+		return false
+	}
+	validator_errs := []validators.ValidatorErr{}
+	departure := connection.DepartureTime.Format("2006-01-02 15:04")
+	validators.Driver_availability(int(connection.ID), connection.DriverID, departure, connection.ArrivalTime, 1, &validator_errs)
+	validators.Vehicle_availability(int(connection.ID), connection.VehicleRegistration, departure, connection.ArrivalTime, 1, &validator_errs)
+	validators.Connections_working_time([]models.Connection{*connection}, &validator_errs)
+	if len(validator_errs) == 0 {
+		return false
+	}
+	descs := []string{}
+	for _, validator_err := range validator_errs {
+		descs = append(descs, validator_err.Desc)
+	}
+	report.Conflicts = append(report.Conflicts, ImportConflict{connection.ID, connection.LineName + " " + departure, strings.Join(descs, "; ")})
+	return true
+}
+
+// importConnections creates connection for every valid trip and every day of its service
+// GTFS times of trip are wall-clock times stored as UTC same as times of timetable
+func importConnections(tx *gorm.DB, trips []*importTrip, services map[string][]time.Time, report *ImportReport) error {
+	for _, trip := range trips {
+		if !trip.valid {
+			continue
+		}
+		days, ok := services[trip.service]
+		if !ok {
+			report.Errors = append(report.Errors, RowErr{"trips.txt", trip.row.number, trip.id, "service " + trip.service + " does not exist"})
+			continue
+		}
+		for _, day := range days {
+			midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+			departure := midnight.Add(time.Duration(trip.departures[0]) * time.Second)
+			arrival := midnight.Add(time.Duration(trip.arrivals[len(trip.arrivals)-1]) * time.Second)
+			key := trip.line + " " + departure.Format("2006-01-02 15:04")
+
+			var connection models.Connection
+			res := tx.Where("line_name = ? AND departure_time = ?", trip.line, departure).Find(&connection)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				connection = models.Connection{
+					LineName:      trip.line,
+					DepartureTime: departure,
+					ArrivalTime:   arrival,
+					Direction:     trip.direction,
+				}
+				if res := tx.Create(&connection); res.Error != nil {
+					return res.Error
+				}
+				report.Connections.Created++
+				report.Changes = append(report.Changes, ImportChange{"connection", key, "create"})
+				continue
+			}
+			// connections which already departed are kept as they ran
+			departed := !connection.DepartureTime.After(utils.Wall_clock_now())
+			if departed || (connection.Direction == trip.direction && connection.ArrivalTime.Equal(arrival)) {
+				report.Connections.Unchanged++
+				continue
+			}
+			connection.Direction = trip.direction
+			connection.ArrivalTime = arrival
+			if conflictReported(&connection, report) {
+				report.Connections.Unchanged++
+				continue
+			}
+			if res := tx.Model(&connection).Select("Direction", "ArrivalTime").Updates(&connection); res.Error != nil {
+				return res.Error
+			}
+			report.Connections.Updated++
+			report.Changes = append(report.Changes, ImportChange{"connection", key, "update"})
+		}
+	}
+	return nil
+}
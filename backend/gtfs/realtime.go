@@ -0,0 +1,396 @@
+// package gtfs contains import and export of timetables in GTFS format
+// this file contains GTFS-Realtime feed with trip updates and vehicle positions
+package gtfs
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RealtimeVersion is version of GTFS-Realtime specification of published feed
+const RealtimeVersion = "2.0"
+
+// realtimeWindow limits connections in feed to those running around current time
+const realtimeWindow = 2 * time.Hour
+
+// GTFS-Realtime enum values
+const (
+	FullDataset = "FULL_DATASET"
+
+	TripScheduled = "SCHEDULED"
+	TripCanceled  = "CANCELED"
+
+	StopScheduled = "SCHEDULED"
+	StopSkipped   = "SKIPPED"
+
+	StoppedAt   = "STOPPED_AT"
+	InTransitTo = "IN_TRANSIT_TO"
+	IncomingAt  = "INCOMING_AT"
+)
+
+// realtimeEnums maps names of enum values to numbers used in protobuf
+var realtimeEnums = map[string]uint64{
+	FullDataset:   0,
+	TripScheduled: 0,
+	TripCanceled:  3,
+	StopSkipped:   1,
+	IncomingAt:    0,
+	StoppedAt:     1,
+	InTransitTo:   2,
+}
+
+// FeedMessage is GTFS-Realtime feed, fields follow names of the specification
+// so JSON rendering of feed can be used for debugging
+type FeedMessage struct {
+	Header FeedHeader   `json:"header"`
+	Entity []FeedEntity `json:"entity"`
+}
+
+type FeedHeader struct {
+	GtfsRealtimeVersion string `json:"gtfs_realtime_version"`
+	Incrementality      string `json:"incrementality"`
+	Timestamp           uint64 `json:"timestamp"`
+}
+
+type FeedEntity struct {
+	ID         string           `json:"id"`
+	TripUpdate *TripUpdate      `json:"trip_update,omitempty"`
+	Vehicle    *VehiclePosition `json:"vehicle,omitempty"`
+}
+
+type TripDescriptor struct {
+	TripID               string `json:"trip_id"`
+	RouteID              string `json:"route_id"`
+	DirectionID          uint32 `json:"direction_id"`
+	StartTime            string `json:"start_time"`
+	StartDate            string `json:"start_date"`
+	ScheduleRelationship string `json:"schedule_relationship"`
+}
+
+type VehicleDescriptor struct {
+	ID           string `json:"id"`
+	LicensePlate string `json:"license_plate"`
+}
+
+type TripUpdate struct {
+	Trip           TripDescriptor     `json:"trip"`
+	Vehicle        *VehicleDescriptor `json:"vehicle,omitempty"`
+	StopTimeUpdate []StopTimeUpdate   `json:"stop_time_update,omitempty"`
+	Timestamp      *uint64            `json:"timestamp,omitempty"`
+	Delay          *int32             `json:"delay,omitempty"`
+}
+
+type StopTimeUpdate struct {
+	StopSequence         uint32         `json:"stop_sequence"`
+	StopID               string         `json:"stop_id"`
+	Arrival              *StopTimeEvent `json:"arrival,omitempty"`
+	Departure            *StopTimeEvent `json:"departure,omitempty"`
+	ScheduleRelationship string         `json:"schedule_relationship"`
+}
+
+type StopTimeEvent struct {
+	Delay int32 `json:"delay"`
+	Time  int64 `json:"time"`
+}
+
+type VehiclePosition struct {
+	Trip                TripDescriptor     `json:"trip"`
+	Vehicle             *VehicleDescriptor `json:"vehicle,omitempty"`
+	Position            *Position          `json:"position,omitempty"`
+	CurrentStopSequence *uint32            `json:"current_stop_sequence,omitempty"`
+	StopID              string             `json:"stop_id,omitempty"`
+	CurrentStatus       string             `json:"current_status,omitempty"`
+	Timestamp           uint64             `json:"timestamp"`
+}
+
+type Position struct {
+	Latitude  float32 `json:"latitude"`
+	Longitude float32 `json:"longitude"`
+}
+
+// Realtime builds GTFS-Realtime feed from real-time state of connections running around now
+// now is wall-clock time same as times of timetable, header gets current instant,
+// cancelled connections and stops not served by partially cancelled connections are reported too,
+// trip and stop ids are the same as in static feed
+func Realtime(now time.Time) (*FeedMessage, error) {
+	location, err := time.LoadLocation(getEnv("GTFS_AGENCY_TIMEZONE", "Europe/Prague"))
+	if err != nil {
+		return nil, err
+	}
+	feed := &FeedMessage{
+		Header: FeedHeader{
+			GtfsRealtimeVersion: RealtimeVersion,
+			Incrementality:      FullDataset,
+			Timestamp:           uint64(time.Now().Unix()),
+		},
+		Entity: []FeedEntity{},
+	}
+
+	var stops []models.Stop
+	if res := utils.DB.Find(&stops); res.Error != nil {
+		return nil, res.Error
+	}
+	stop_ids := map[string]string{}
+	for _, stop := range stops {
+		stop_ids[stop.Name] = strconv.FormatUint(uint64(stop.ID), 10)
+	}
+
+	var connections []models.Connection
+	res := utils.DB.Order("departure_time").Where(serializers.PublicConnections).
+		Where("(realtime_updated_at IS NOT NULL OR status = ? OR cancelled_from_stop IS NOT NULL) AND departure_time <= ? AND arrival_time >= ?",
+			models.CancelledConnection, now.Add(realtimeWindow), now.Add(-realtimeWindow)).
+		Find(&connections)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	for _, connection := range connections {
+		connection_stops, err := serializers.Expected_connection_stops(connection)
+		if err != nil {
+			return nil, err
+		}
+		trip := TripDescriptor{
+			TripID:               TripID(connection.ID),
+			RouteID:              connection.LineName,
+			StartTime:            FormatTime(connection.DepartureTime, connection.DepartureTime),
+			StartDate:            ServiceID(connection.DepartureTime),
+			ScheduleRelationship: TripScheduled,
+		}
+		if connection.Direction {
+			trip.DirectionID = 1
+		}
+		var vehicle *VehicleDescriptor
+		if connection.VehicleRegistration != nil {
+			vehicle = &VehicleDescriptor{ID: *connection.VehicleRegistration, LicensePlate: *connection.VehicleRegistration}
+		}
+
+		if connection.Status == models.CancelledConnection {
+			trip.ScheduleRelationship = TripCanceled
+			feed.Entity = append(feed.Entity, FeedEntity{ID: "trip-" + trip.TripID, TripUpdate: &TripUpdate{Trip: trip, Vehicle: vehicle}})
+			continue
+		}
+
+		update := &TripUpdate{Trip: trip, Vehicle: vehicle}
+		if connection.Delay != nil {
+			delay := int32(*connection.Delay)
+			update.Delay = &delay
+		}
+		if connection.RealtimeUpdatedAt != nil {
+			timestamp := uint64(wallTime(*connection.RealtimeUpdatedAt, location).Unix())
+			update.Timestamp = &timestamp
+		}
+		next := 0
+		if connection.LastStopIndex != nil {
+			next = *connection.LastStopIndex + 1
+		}
+		for i := next; i < len(connection_stops); i++ {
+			stop := connection_stops[i]
+			stop_time_update := StopTimeUpdate{
+				StopSequence:         uint32(i + 1),
+				StopID:               stop_ids[stop.StopName],
+				ScheduleRelationship: StopScheduled,
+			}
+			if stop.Cancelled {
+				stop_time_update.ScheduleRelationship = StopSkipped
+				update.StopTimeUpdate = append(update.StopTimeUpdate, stop_time_update)
+				continue
+			}
+			if i > 0 && stop.ExpectedArrivalTime != nil {
+				stop_time_update.Arrival = stopTimeEvent(stop.ArrivalTime, *stop.ExpectedArrivalTime, location)
+			}
+			if i < len(connection_stops)-1 && stop.ExpectedDepartureTime != nil {
+				stop_time_update.Departure = stopTimeEvent(stop.DepartureTime, *stop.ExpectedDepartureTime, location)
+			}
+			if stop_time_update.Arrival != nil || stop_time_update.Departure != nil {
+				update.StopTimeUpdate = append(update.StopTimeUpdate, stop_time_update)
+			}
+		}
+		feed.Entity = append(feed.Entity, FeedEntity{ID: "trip-" + trip.TripID, TripUpdate: update})
+
+		position, err := vehiclePosition(connection, connection_stops, stop_ids, location)
+		if err != nil {
+			return nil, err
+		}
+		if position != nil {
+			position.Trip = trip
+			position.Vehicle = vehicle
+			feed.Entity = append(feed.Entity, FeedEntity{ID: "vehicle-" + trip.TripID, Vehicle: position})
+		}
+	}
+	return feed, nil
+}
+
+// vehiclePosition returns last reported position of connection or nil if vehicle did not report any
+func vehiclePosition(connection models.Connection, connection_stops []serializers.ConnectionStop, stop_ids map[string]string, location *time.Location) (*VehiclePosition, error) {
+	event := models.RealtimeEvent{}
+	res := utils.DB.Where("connection_id = ? AND type = ?", connection.ID, models.PositionEvent).Order("time DESC").Limit(1).Find(&event)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, res.Error
+	}
+	position := &VehiclePosition{
+		Timestamp:     uint64(wallTime(event.Time, location).Unix()),
+		CurrentStatus: InTransitTo,
+	}
+	if event.Latitude != nil && event.Longitude != nil {
+		position.Position = &Position{Latitude: float32(*event.Latitude), Longitude: float32(*event.Longitude)}
+	}
+	next := 0
+	if connection.LastStopIndex != nil {
+		next = *connection.LastStopIndex + 1
+	}
+	if event.StopIndex != nil && *event.StopIndex >= next {
+		next = *event.StopIndex
+		position.CurrentStatus = StoppedAt
+	}
+	if next < len(connection_stops) {
+		sequence := uint32(next + 1)
+		position.CurrentStopSequence = &sequence
+		position.StopID = stop_ids[connection_stops[next].StopName]
+	}
+	return position, nil
+}
+
+// stopTimeEvent creates expected arrival or departure with delay against scheduled time
+func stopTimeEvent(scheduled time.Time, expected time.Time, location *time.Location) *StopTimeEvent {
+	return &StopTimeEvent{
+		Delay: int32(expected.Sub(scheduled).Seconds()),
+		Time:  wallTime(expected, location).Unix(),
+	}
+}
+
+// wallTime interprets date and time of day as time in agency timezone
+// timetable times are stored as local times of the agency
+func wallTime(t time.Time, location *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, location)
+}
+
+// Marshal encodes feed in protobuf format of GTFS-Realtime specification
+func (m *FeedMessage) Marshal() []byte {
+	var header []byte
+	header = appendString(header, 1, m.Header.GtfsRealtimeVersion)
+	header = appendVarint(header, 2, realtimeEnums[m.Header.Incrementality])
+	header = appendVarint(header, 3, m.Header.Timestamp)
+
+	var b []byte
+	b = appendMessage(b, 1, header)
+	for _, entity := range m.Entity {
+		var e []byte
+		e = appendString(e, 1, entity.ID)
+		if entity.TripUpdate != nil {
+			e = appendMessage(e, 3, entity.TripUpdate.marshal())
+		}
+		if entity.Vehicle != nil {
+			e = appendMessage(e, 4, entity.Vehicle.marshal())
+		}
+		b = appendMessage(b, 2, e)
+	}
+	return b
+}
+
+func (t *TripDescriptor) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, t.TripID)
+	b = appendString(b, 2, t.StartTime)
+	b = appendString(b, 3, t.StartDate)
+	b = appendVarint(b, 4, realtimeEnums[t.ScheduleRelationship])
+	b = appendString(b, 5, t.RouteID)
+	b = appendVarint(b, 6, uint64(t.DirectionID))
+	return b
+}
+
+func (v *VehicleDescriptor) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, v.ID)
+	b = appendString(b, 3, v.LicensePlate)
+	return b
+}
+
+func (u *TripUpdate) marshal() []byte {
+	var b []byte
+	b = appendMessage(b, 1, u.Trip.marshal())
+	for _, stop_time_update := range u.StopTimeUpdate {
+		b = appendMessage(b, 2, stop_time_update.marshal())
+	}
+	if u.Vehicle != nil {
+		b = appendMessage(b, 3, u.Vehicle.marshal())
+	}
+	if u.Timestamp != nil {
+		b = appendVarint(b, 4, *u.Timestamp)
+	}
+	if u.Delay != nil {
+		b = appendVarint(b, 5, uint64(int64(*u.Delay)))
+	}
+	return b
+}
+
+func (s *StopTimeUpdate) marshal() []byte {
+	var b []byte
+	b = appendVarint(b, 1, uint64(s.StopSequence))
+	if s.Arrival != nil {
+		b = appendMessage(b, 2, s.Arrival.marshal())
+	}
+	if s.Departure != nil {
+		b = appendMessage(b, 3, s.Departure.marshal())
+	}
+	b = appendString(b, 4, s.StopID)
+	b = appendVarint(b, 5, realtimeEnums[s.ScheduleRelationship])
+	return b
+}
+
+func (e *StopTimeEvent) marshal() []byte {
+	var b []byte
+	b = appendVarint(b, 1, uint64(int64(e.Delay)))
+	b = appendVarint(b, 2, uint64(e.Time))
+	return b
+}
+
+func (p *VehiclePosition) marshal() []byte {
+	var b []byte
+	b = appendMessage(b, 1, p.Trip.marshal())
+	if p.Position != nil {
+		var position []byte
+		position = protowire.AppendTag(position, 1, protowire.Fixed32Type)
+		position = protowire.AppendFixed32(position, math.Float32bits(p.Position.Latitude))
+		position = protowire.AppendTag(position, 2, protowire.Fixed32Type)
+		position = protowire.AppendFixed32(position, math.Float32bits(p.Position.Longitude))
+		b = appendMessage(b, 2, position)
+	}
+	if p.CurrentStopSequence != nil {
+		b = appendVarint(b, 3, uint64(*p.CurrentStopSequence))
+	}
+	if p.CurrentStatus != "" {
+		b = appendVarint(b, 4, realtimeEnums[p.CurrentStatus])
+	}
+	b = appendVarint(b, 5, p.Timestamp)
+	b = appendString(b, 7, p.StopID)
+	if p.Vehicle != nil {
+		b = appendMessage(b, 8, p.Vehicle.marshal())
+	}
+	return b
+}
+
+// appendString appends string field, empty strings are left out
+func appendString(b []byte, number protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, number, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+// appendVarint appends integer or enum field
+func appendVarint(b []byte, number protowire.Number, value uint64) []byte {
+	b = protowire.AppendTag(b, number, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
+
+// appendMessage appends embedded message field
+func appendMessage(b []byte, number protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, number, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
@@ -0,0 +1,122 @@
+// package images contains processing of uploaded images
+// this file contains decoding, scaling down and encoding of photos and icons
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"path"
+	"strings"
+)
+
+// MaxPixels is the largest image which is decoded, larger ones are refused before decoding
+const MaxPixels = 40_000_000
+
+// ErrTooLarge is returned for images with more than MaxPixels pixels
+var ErrTooLarge = errors.New("image is too large")
+
+// Check reads only header of image and returns its format, JPEG, PNG and GIF are supported
+func Check(data []byte) (string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("unsupported image, use JPEG, PNG or GIF: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return "", ErrTooLarge
+	}
+	return format, nil
+}
+
+// Decode decodes image after checking its size
+func Decode(data []byte) (image.Image, error) {
+	if _, err := Check(data); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Fit scales image down to fit into width x height keeping its aspect ratio
+// every pixel of result is average of pixels of source it covers, smaller images are only copied
+func Fit(img image.Image, width int, height int) *image.RGBA {
+	bounds := img.Bounds()
+	source := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(source, source.Bounds(), img, bounds.Min, draw.Src)
+
+	src_w, src_h := source.Bounds().Dx(), source.Bounds().Dy()
+	dst_w, dst_h := src_w, src_h
+	if dst_w > width {
+		dst_w, dst_h = width, max(1, src_h*width/src_w)
+	}
+	if dst_h > height {
+		dst_w, dst_h = max(1, dst_w*height/dst_h), height
+	}
+	if dst_w == src_w && dst_h == src_h {
+		return source
+	}
+
+	result := image.NewRGBA(image.Rect(0, 0, dst_w, dst_h))
+	for y := 0; y < dst_h; y++ {
+		y0, y1 := y*src_h/dst_h, max(y*src_h/dst_h+1, (y+1)*src_h/dst_h)
+		for x := 0; x < dst_w; x++ {
+			x0, x1 := x*src_w/dst_w, max(x*src_w/dst_w+1, (x+1)*src_w/dst_w)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := source.Pix[sy*source.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+			count := (x1 - x0) * (y1 - y0)
+			pixel := result.Pix[y*result.Stride+x*4:]
+			for c := 0; c < 4; c++ {
+				pixel[c] = uint8(sum[c] / count)
+			}
+		}
+	}
+	return result
+}
+
+// EncodeJPEG encodes image as JPEG, transparent parts are shown on white background
+// metadata of uploaded photo, e.g. location in EXIF, is not kept
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, flat, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// EncodePNG encodes image as PNG keeping its transparency
+func EncodePNG(img image.Image) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Thumbnail_key returns key of thumbnail stored next to image with given key
+func Thumbnail_key(key string) string {
+	extension := path.Ext(key)
+	return strings.TrimSuffix(key, extension) + "_thumb" + extension
+}
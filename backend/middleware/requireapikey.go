@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAuthOrAPIKey lets through requests with API key from given env variable in X-API-Key header,
+// other requests have to be authorized as user with one of permitted roles
+func RequireAuthOrAPIKey(key_env string, permitted_roles ...string) gin.HandlerFunc {
+	require_auth := RequireAuth(permitted_roles...)
+	return func(ctx *gin.Context) {
+		key := os.Getenv(key_env)
+		header := ctx.GetHeader("X-API-Key")
+		if key != "" && header != "" && subtle.ConstantTimeCompare([]byte(key), []byte(header)) == 1 {
+			ctx.Set("api_key", key_env)
+			ctx.Next()
+			return
+		}
+		require_auth(ctx)
+	}
+}
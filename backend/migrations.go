@@ -3,36 +3,81 @@
 package api
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/AdamPekny/IIS/backend/models"
 	"github.com/AdamPekny/IIS/backend/utils"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+// connection_service_index is unique index of departures of service connections
+const connection_service_index = "idx_connection_service_departure"
+
 // Migrate_all migrates ORM all models
-func Migrate_all() {
+// returns error when unique index of service connections can not be created
+func Migrate_all() error {
 	// Migrate User models
 	utils.DB.AutoMigrate(&models.User{})
+	utils.DB.AutoMigrate(&models.Absence{}, &models.PreferredShift{})
 
 	// Migrate Vehicle models
 	utils.DB.AutoMigrate(&models.VehicleType{}, &models.Vehicle{})
 
 	// Migrate Maintenance models
-	utils.DB.AutoMigrate(&models.MalfunctionReport{}, &models.MaintenanceRequest{}, &models.MaintenanceReport{})
+	legacy_costs := utils.DB.Migrator().HasTable(&models.MaintenanceReport{}) && !utils.DB.Migrator().HasColumn(&models.MaintenanceReport{}, "LegacyCost")
+	utils.DB.AutoMigrate(&models.MalfunctionReport{}, &models.MaintenancePlan{}, &models.MaintenanceRequest{}, &models.MaintenanceStatusChange{}, &models.SparePart{}, &models.MaintenanceReport{}, &models.MaintenanceReportItem{}, &models.Attachment{}, &models.OdometerReading{})
+
+	// cost of reports without parts entered before it was derived is kept as their legacy cost
+	if legacy_costs {
+		utils.DB.Exec("UPDATE maintenance_reports SET legacy_cost = GREATEST(cost - labour_hours * labour_rate, 0) WHERE NOT EXISTS " +
+			"(SELECT 1 FROM maintenance_report_items WHERE maintenance_report_items.mainten_rep_ref = maintenance_reports.id)")
+	}
 
-	utils.DB.AutoMigrate(&models.Stop{}, &models.Line{}, &models.Segment{}, &models.Connection{})
+	// requests created before maintenance plans always had malfunction report, vehicle is taken from it
+	utils.DB.Exec("ALTER TABLE maintenance_requests ALTER COLUMN malfunc_rep_ref DROP NOT NULL")
+	utils.DB.Exec("UPDATE maintenance_requests SET vehicle_ref = malfunction_reports.vehicle_ref FROM malfunction_reports " +
+		"WHERE malfunction_reports.id = maintenance_requests.malfunc_rep_ref AND maintenance_requests.vehicle_ref IS NULL")
+
+	// connections of services generated twice by concurrent requests are merged before unique index is created
+	if utils.DB.Migrator().HasTable(&models.Connection{}) && !utils.DB.Migrator().HasIndex(&models.Connection{}, connection_service_index) {
+		if err := merge_service_connections(); err != nil {
+			return fmt.Errorf("merging duplicate service connections: %w", err)
+		}
+	}
+
+	err := utils.DB.AutoMigrate(&models.Stop{}, &models.Line{}, &models.Segment{}, &models.Service{}, &models.ServiceException{}, &models.Duty{}, &models.DeadheadLeg{}, &models.Connection{}, &models.RealtimeEvent{})
+	if err != nil {
+		return err
+	}
+	if !utils.DB.Migrator().HasIndex(&models.Connection{}, connection_service_index) {
+		return fmt.Errorf("unique index %s of connections was not created", connection_service_index)
+	}
+
+	// Migrate qualification models
+	utils.DB.AutoMigrate(&models.Licence{}, &models.RouteKnowledge{})
+
+	// number segments created before explicit stop order in order of their creation
+	var segments []models.Segment
+	if res := utils.DB.Where("sequence = 0").Order("line_name, id").Find(&segments); res.Error == nil {
+		sequences := map[string]uint{}
+		for _, segment := range segments {
+			sequences[segment.LineName]++
+			utils.DB.Model(&segment).Update("sequence", sequences[segment.LineName])
+		}
+	}
 
 	var users []models.User
 	result := utils.DB.Where("role = ?", string(models.AdminRole)).Find(&users)
 
 	if result.Error != nil {
-		return
+		return nil
 	}
 
 	pwd_hash, err := bcrypt.GenerateFromPassword([]byte("DmiInbN5"), 14)
 	if err != nil {
-		return
+		return nil
 	}
 
 	if result.RowsAffected == 0 {
@@ -45,4 +90,87 @@ func Migrate_all() {
 			Role:      models.AdminRole,
 		})
 	}
+	return nil
+}
+
+// merge_service_connections keeps one connection of each service departure
+// connection with duty, then with driver or vehicle, then with real-time events is kept,
+// assignment missing in it is taken from removed duplicates and their real-time events are moved to it
+func merge_service_connections() error {
+	return utils.DB.Transaction(func(tx *gorm.DB) error {
+		var connections []models.Connection
+		res := tx.Where("service_id IS NOT NULL AND (service_id, departure_time) IN " +
+			"(SELECT service_id, departure_time FROM connections WHERE service_id IS NOT NULL GROUP BY service_id, departure_time HAVING COUNT(*) > 1)").
+			Order("service_id, departure_time, id").Find(&connections)
+		if res.Error != nil {
+			return res.Error
+		}
+		has_events := tx.Migrator().HasTable(&models.RealtimeEvent{})
+		for start := 0; start < len(connections); {
+			end := start + 1
+			for end < len(connections) && *connections[end].ServiceID == *connections[start].ServiceID &&
+				connections[end].DepartureTime.Equal(connections[start].DepartureTime) {
+				end++
+			}
+			if err := merge_connections(tx, connections[start:end], has_events); err != nil {
+				return err
+			}
+			start = end
+		}
+		return nil
+	})
+}
+
+// merge_connections merges duplicates of one service departure into the most used one
+func merge_connections(tx *gorm.DB, duplicates []models.Connection, has_events bool) error {
+	scores := make([]int, len(duplicates))
+	for i := range duplicates {
+		if duplicates[i].DutyID != nil {
+			scores[i] += 4
+		}
+		if duplicates[i].DriverID != nil || duplicates[i].VehicleRegistration != nil {
+			scores[i] += 2
+		}
+		if has_events {
+			var events int64
+			if res := tx.Model(&models.RealtimeEvent{}).Where("connection_id = ?", duplicates[i].ID).Count(&events); res.Error != nil {
+				return res.Error
+			}
+			if events != 0 {
+				scores[i]++
+			}
+		}
+	}
+	kept := 0
+	for i := range duplicates {
+		if scores[i] > scores[kept] {
+			kept = i
+		}
+	}
+	connection := &duplicates[kept]
+	removed := []uint{}
+	for i := range duplicates {
+		if i == kept {
+			continue
+		}
+		removed = append(removed, duplicates[i].ID)
+		if connection.DutyID == nil {
+			connection.DutyID = duplicates[i].DutyID
+		}
+		if connection.DriverID == nil {
+			connection.DriverID = duplicates[i].DriverID
+		}
+		if connection.VehicleRegistration == nil {
+			connection.VehicleRegistration = duplicates[i].VehicleRegistration
+		}
+	}
+	if has_events {
+		if res := tx.Model(&models.RealtimeEvent{}).Where("connection_id IN ?", removed).Update("connection_id", connection.ID); res.Error != nil {
+			return res.Error
+		}
+	}
+	if res := tx.Model(connection).Select("DutyID", "DriverID", "VehicleRegistration").Updates(connection); res.Error != nil {
+		return res.Error
+	}
+	return tx.Where("id IN ?", removed).Delete(&models.Connection{}).Error
 }
@@ -0,0 +1,33 @@
+// package models contains gorm model definitions for ORM usage
+// this file contains models for files attached to malfunction and maintenance reports
+package models
+
+import (
+	"time"
+)
+
+type AttachmentKind string
+
+const (
+	PhotoAttachment    AttachmentKind = "photo"
+	InvoiceAttachment  AttachmentKind = "invoice"
+	DocumentAttachment AttachmentKind = "document"
+)
+
+// Attachment is file attached to either malfunction report or maintenance report
+// content of file is kept in storage under StorageKey
+type Attachment struct {
+	ID            uint               `gorm:"primaryKey;autoIncrement;not null"`
+	MalfuncRepRef *uint              `gorm:"default:null"`
+	MalfuncRep    *MalfunctionReport `gorm:"foreignKey:MalfuncRepRef"`
+	MaintenRepRef *uint              `gorm:"default:null"`
+	MaintenRep    *MaintenanceReport `gorm:"foreignKey:MaintenRepRef"`
+	Kind          AttachmentKind     `gorm:"not null"`
+	FileName      string             `gorm:"not null;size:255"`
+	ContentType   string             `gorm:"not null;size:100"`
+	Size          int64              `gorm:"not null"`
+	StorageKey    string             `gorm:"not null;unique"`
+	UploadedByRef *uint              `gorm:"not null"`
+	UploadedBy    *User              `gorm:"foreignKey:UploadedByRef"`
+	CreatedAt     time.Time          `gorm:"autoCreateTime"`
+}
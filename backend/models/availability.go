@@ -0,0 +1,60 @@
+// package models contains gorm model definitions for ORM usage
+// this file contains models for availability of drivers and technicians
+package models
+
+import (
+	"time"
+)
+
+type AbsenceType string
+
+const (
+	VacationAbsence AbsenceType = "vacation"
+	SickAbsence     AbsenceType = "sick"
+	OtherAbsence    AbsenceType = "other"
+)
+
+// Absence is time off of user, user can not be assigned to any work during it
+type Absence struct {
+	ID        uint        `gorm:"primaryKey;autoIncrement;not null"`
+	UserID    uint        `gorm:"not null"`
+	User      *User       `gorm:"foreignKey:UserID"`
+	Type      AbsenceType `gorm:"not null"`
+	StartTime time.Time   `gorm:"not null"`
+	EndTime   time.Time   `gorm:"not null"`
+	Note      *string
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// PreferredShift is part of week user prefers to work in, it does not block any assignment
+// shift ending before its start continues over midnight to next day
+type PreferredShift struct {
+	ID        uint         `gorm:"primaryKey;autoIncrement;not null"`
+	UserID    uint         `gorm:"not null"`
+	User      *User        `gorm:"foreignKey:UserID"`
+	Weekday   time.Weekday `gorm:"not null"`
+	StartTime string       `gorm:"not null;size:5"` // 15:04
+	EndTime   string       `gorm:"not null;size:5"` // 15:04
+}
+
+// Covers checks if work from departure to arrival fits in shift starting on day of departure
+func (s *PreferredShift) Covers(departure time.Time, arrival time.Time) bool {
+	if departure.Weekday() != s.Weekday {
+		return false
+	}
+	start, err := time.Parse("15:04", s.StartTime)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", s.EndTime)
+	if err != nil {
+		return false
+	}
+	day := time.Date(departure.Year(), departure.Month(), departure.Day(), 0, 0, 0, 0, departure.Location())
+	shift_start := day.Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute)
+	shift_end := day.Add(time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute)
+	if !shift_end.After(shift_start) {
+		shift_end = shift_end.AddDate(0, 0, 1)
+	}
+	return !departure.Before(shift_start) && !arrival.After(shift_end)
+}
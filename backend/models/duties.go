@@ -0,0 +1,33 @@
+// package models contains gorm model definitions for ORM usage
+// this file contains models for duties of drivers
+package models
+
+import (
+	"time"
+)
+
+// Duty is shift of one driver and vehicle made of consecutive connections
+// it starts by sign-on and ends by sign-off in depot, deadhead legs move empty vehicle between stops
+type Duty struct {
+	ID                  uint          `gorm:"primaryKey;autoIncrement;not null"`
+	DepotName           string        `gorm:"not null"`
+	Depot               Stop          `gorm:"foreignKey:DepotName;references:Name"`
+	SignOn              time.Time     `gorm:"not null"`
+	SignOff             time.Time     `gorm:"not null"`
+	DriverID            *uint         `gorm:"default:null"`
+	VehicleRegistration *string       `gorm:"default:null"`
+	Connections         []Connection  `gorm:"constraint:OnDelete:SET NULL"`
+	Deadheads           []DeadheadLeg `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// DeadheadLeg is ride of empty vehicle between two stops within duty
+type DeadheadLeg struct {
+	ID            uint   `gorm:"primaryKey;autoIncrement;not null"`
+	DutyID        uint   `gorm:"not null;index"`
+	FromStopName  string `gorm:"not null"`
+	FromStop      Stop   `gorm:"foreignKey:FromStopName;references:Name"`
+	ToStopName    string `gorm:"not null"`
+	ToStop        Stop   `gorm:"foreignKey:ToStopName;references:Name"`
+	DepartureTime time.Time
+	ArrivalTime   time.Time
+}
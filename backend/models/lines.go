@@ -6,30 +6,73 @@ import (
 	"time"
 )
 
+// Line is route connections drive on
+// only vehicles of VehicleTypes with at least MinCapacity can operate line, no vehicle types allow any type
 type Line struct {
-	Name        string       `gorm:"primaryKey;unique;not null"`
-	InitialStop string       `gorm:"not null"`
-	FinalStop   string       `gorm:"not null"`
-	Connections []Connection `gorm:"constraint:OnDelete:CASCADE"`
-	Segments    []Segment    `gorm:"constraint:OnDelete:CASCADE"`
+	Name         string        `gorm:"primaryKey;unique;not null"`
+	InitialStop  string        `gorm:"not null"`
+	FinalStop    string        `gorm:"not null"`
+	MinCapacity  uint          `gorm:"not null;default:0"`
+	VehicleTypes []VehicleType `gorm:"many2many:line_vehicle_types;foreignKey:Name;joinForeignKey:LineName;references:Type;joinReferences:VehicleTypeName;constraint:OnDelete:CASCADE"`
+	Connections  []Connection  `gorm:"constraint:OnDelete:CASCADE"`
+	Segments     []Segment     `gorm:"constraint:OnDelete:CASCADE"`
 }
 
+// Segment is part of line between two consecutive stops
+// segments of line are ordered by Sequence starting from 1 separately for each direction,
+// lines without segments for direction TRUE drive segments of direction FALSE backwards
 type Segment struct {
 	ID        uint `gorm:"primaryKey;autoIncrement;not null"`
+	Sequence  uint `gorm:"not null;default:0"`
+	Direction bool `gorm:"not null;default:false"` // same meaning as Connection.Direction
 	StopName1 string
 	StopName2 string
 	Stop1     Stop `gorm:"foreignKey:StopName1;references:Name"`
 	Stop2     Stop `gorm:"foreignKey:StopName2;references:Name"`
-	Time      uint `gorm:"not null"`
+	Time      uint `gorm:"not null"`           // travel time from Stop1 to Stop2 in minutes
+	DwellTime uint `gorm:"not null;default:0"` // minutes spent in Stop2, ignored for final stop
 	LineName  string
 }
 
+type ConnectionStatus string
+
+const (
+	ScheduledConnection ConnectionStatus = "scheduled"
+	CancelledConnection ConnectionStatus = "cancelled"
+	DelayedConnection   ConnectionStatus = "delayed"
+	CompletedConnection ConnectionStatus = "completed"
+)
+
 type Connection struct {
-	ID                  uint `gorm:"primaryKey;autoIncrement;not null"`
-	DepartureTime       time.Time
+	ID                  uint      `gorm:"primaryKey;autoIncrement;not null"`
+	DepartureTime       time.Time `gorm:"uniqueIndex:idx_connection_service_departure"`
 	ArrivalTime         time.Time
-	Direction           bool    //TRUE: Initial->Final FALSE: Final->Initial
-	VehicleRegistration *string `gorm:"default:null"`
-	LineName            string  `gorm:"not null"`
-	DriverID            *uint   `gorm:"default:null"`
+	Direction           bool               //FALSE: Initial->Final TRUE: Final->Initial
+	VehicleRegistration *string            `gorm:"default:null"`
+	LineName            string             `gorm:"not null"`
+	DriverID            *uint              `gorm:"default:null"`
+	ServiceID           *uint              `gorm:"default:null;uniqueIndex:idx_connection_service_departure"` // one connection of service per departure
+	ServiceDay          *time.Time         `gorm:"type:date;default:null"`
+	Delay               *int               `gorm:"default:null"` // seconds, nil without real-time data
+	LastStopIndex       *int               `gorm:"default:null"` // last departed stop in direction of connection
+	RealtimeUpdatedAt   *time.Time         `gorm:"default:null"`
+	RealtimeEvents      []RealtimeEvent    `gorm:"constraint:OnDelete:CASCADE"`
+	Status              ConnectionStatus   `gorm:"not null;default:scheduled"`
+	StatusReason        *string            `gorm:"default:null"`
+	StatusManual        bool               `gorm:"not null;default:false"` // status set by dispatcher is not changed by real-time data
+	MalfuncRepRef       *uint              `gorm:"default:null"`           // malfunction report which caused the status
+	MalfuncRep          *MalfunctionReport `gorm:"foreignKey:MalfuncRepRef;constraint:OnDelete:SET NULL"`
+	ReassignMalfuncRef  *uint              `gorm:"default:null"` // malfunction report of vehicle which has to be replaced
+	ReassignMalfunc     *MalfunctionReport `gorm:"foreignKey:ReassignMalfuncRef;constraint:OnDelete:SET NULL"`
+	CancelledFromStop   *int               `gorm:"default:null"` // first stop not served by partially cancelled connection
+	CancelledToStop     *int               `gorm:"default:null"` // last stop not served by partially cancelled connection
+	DutyID              *uint              `gorm:"default:null"`
+}
+
+// StopCancelled checks if stop with given index in direction of connection is not served
+func (c *Connection) StopCancelled(index int) bool {
+	if c.Status == CancelledConnection {
+		return true
+	}
+	return c.CancelledFromStop != nil && c.CancelledToStop != nil && index >= *c.CancelledFromStop && index <= *c.CancelledToStop
 }
@@ -3,17 +3,31 @@
 package models
 
 import (
+	"math"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Status string
 
 const (
-	PendingStatus    Status = "pending"
-	InProgressStatus Status = "progress"
-	DoneStatus       Status = "done"
+	PendingStatus         Status = "pending"
+	InProgressStatus      Status = "progress"
+	WaitingForPartsStatus Status = "waiting_parts"
+	DoneStatus            Status = "done"
+	RejectedStatus        Status = "rejected"
+	ReopenedStatus        Status = "reopened"
 )
 
+// ClosedStatuses are statuses of maintenance requests which need no more work
+var ClosedStatuses = []Status{DoneStatus, RejectedStatus}
+
+// Closed checks if maintenance request in status needs no more work
+func (s Status) Closed() bool {
+	return s == DoneStatus || s == RejectedStatus
+}
+
 type MalfunctionReport struct {
 	ID           uint                 `gorm:"primaryKey;autoIncrement;not null"`
 	Title        string               `gorm:"not null;size:100"`
@@ -24,28 +38,109 @@ type MalfunctionReport struct {
 	Vehicle      *Vehicle             `gorm:"foreignKey:VehicleRef"`
 	CreatedAt    time.Time            `gorm:"autoCreateTime"`
 	MaintenReqs  []MaintenanceRequest `gorm:"foreignkey:MalfuncRepRef;constraint:OnDelete:CASCADE"`
+	Attachments  []Attachment         `gorm:"foreignKey:MalfuncRepRef;constraint:OnDelete:CASCADE"`
 }
 
 type MaintenanceRequest struct {
-	ID            uint   `gorm:"primaryKey;autoIncrement;not null"`
-	Status        Status `gorm:"not null;default:pending"`
-	Deadline      *time.Time
-	CreatedAt     time.Time          `gorm:"autoCreateTime"`
-	MalfuncRepRef *uint              `gorm:"not null"`
-	MalfuncRep    *MalfunctionReport `gorm:"foreignkey:MalfuncRepRef"`
-	CreatedByRef  *uint              `gorm:"not null"`
-	CreatedBy     *User              `gorm:"foreignKey:CreatedByRef"`
-	ResolvedByRef *uint
-	ResolvedBy    *User              `gorm:"foreignKey:ResolvedByRef"`
-	MaintenRep    *MaintenanceReport `gorm:"foreignkey:MaintenReqRef;constraint:OnDelete:CASCADE"`
+	ID             uint   `gorm:"primaryKey;autoIncrement;not null"`
+	Status         Status `gorm:"not null;default:pending"`
+	Deadline       *time.Time
+	CreatedAt      time.Time          `gorm:"autoCreateTime"`
+	MalfuncRepRef  *uint              `gorm:"default:null"` // nil for request created by maintenance plan
+	MalfuncRep     *MalfunctionReport `gorm:"foreignkey:MalfuncRepRef"`
+	VehicleRef     *string            `gorm:"default:null"`
+	Vehicle        *Vehicle           `gorm:"foreignKey:VehicleRef;constraint:OnDelete:CASCADE"`
+	MaintenPlanRef *uint              `gorm:"default:null"`
+	MaintenPlan    *MaintenancePlan   `gorm:"foreignKey:MaintenPlanRef"`
+	Mileage        *float64           `gorm:"default:null"` // estimated mileage of vehicle when plan created the request
+	CreatedByRef   *uint              `gorm:"not null"`
+	CreatedBy      *User              `gorm:"foreignKey:CreatedByRef"`
+	ResolvedByRef  *uint
+	ResolvedBy     *User                     `gorm:"foreignKey:ResolvedByRef"`
+	MaintenRep     *MaintenanceReport        `gorm:"foreignkey:MaintenReqRef;constraint:OnDelete:CASCADE"`
+	StatusHistory  []MaintenanceStatusChange `gorm:"foreignKey:MaintenReqRef;constraint:OnDelete:CASCADE"`
+}
+
+// MaintenanceStatusChange records who changed status of maintenance request and when
+// creation of request is recorded with empty FromStatus
+type MaintenanceStatusChange struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement;not null"`
+	MaintenReqRef uint      `gorm:"not null"`
+	FromStatus    Status    `gorm:"not null"`
+	ToStatus      Status    `gorm:"not null"`
+	ChangedByRef  *uint     `gorm:"not null"`
+	ChangedBy     *User     `gorm:"foreignKey:ChangedByRef"`
+	Note          *string   `gorm:"default:null"`
+	ChangedAt     time.Time `gorm:"autoCreateTime"`
+}
+
+// AfterCreate records creation of maintenance request into its status history
+func (r *MaintenanceRequest) AfterCreate(tx *gorm.DB) (err error) {
+	status := r.Status
+	if status == "" {
+		status = PendingStatus
+	}
+	return tx.Create(&MaintenanceStatusChange{
+		MaintenReqRef: r.ID,
+		ToStatus:      status,
+		ChangedByRef:  r.CreatedByRef,
+	}).Error
 }
 
+// MaintenanceReport is result of maintenance request
+// Cost is derived from used parts and labour, it is never entered directly,
+// LegacyCost is cost entered before it was derived and it stays part of Cost
 type MaintenanceReport struct {
-	ID            uint                `gorm:"primaryKey;autoIncrement;not null"`
-	Title         string              `gorm:"not null;size:100"`
-	Description   string              `gorm:"not null"`
-	Cost          float64             `gorm:"default:0.0;type:decimal(11,2);not null"`
-	CreatedAt     time.Time           `gorm:"autoCreateTime"`
-	MaintenReqRef *uint               `gorm:"not null;unique"`
-	MaintenReq    *MaintenanceRequest `gorm:"foreignKey:MaintenReqRef"`
+	ID            uint                    `gorm:"primaryKey;autoIncrement;not null"`
+	Title         string                  `gorm:"not null;size:100"`
+	Description   string                  `gorm:"not null"`
+	Cost          float64                 `gorm:"default:0.0;type:decimal(11,2);not null"`
+	LabourHours   float64                 `gorm:"default:0.0;type:decimal(11,2);not null"`
+	LabourRate    float64                 `gorm:"default:0.0;type:decimal(11,2);not null"` // price of labour hour when report was saved
+	LegacyCost    float64                 `gorm:"default:0.0;type:decimal(11,2);not null"`
+	CreatedAt     time.Time               `gorm:"autoCreateTime"`
+	MaintenReqRef *uint                   `gorm:"not null;unique"`
+	MaintenReq    *MaintenanceRequest     `gorm:"foreignKey:MaintenReqRef"`
+	Items         []MaintenanceReportItem `gorm:"foreignKey:MaintenRepRef;constraint:OnDelete:CASCADE"`
+	Attachments   []Attachment            `gorm:"foreignKey:MaintenRepRef;constraint:OnDelete:CASCADE"`
+}
+
+// DeriveCost sets Cost of report to price of its items and labour and its legacy cost
+func (r *MaintenanceReport) DeriveCost() {
+	r.Cost = r.LegacyCost + r.LabourHours*r.LabourRate
+	for i := range r.Items {
+		r.Cost += r.Items[i].Cost()
+	}
+	r.Cost = math.Round(r.Cost*100) / 100
+}
+
+// MaintenancePlan is preventive maintenance of all vehicles of given type or of single vehicle
+// request is due when IntervalDays passed or vehicle drove IntervalKm since last request of the plan
+type MaintenancePlan struct {
+	ID              uint                 `gorm:"primaryKey;autoIncrement;not null"`
+	Title           string               `gorm:"not null;size:100"`
+	Description     string               `gorm:"not null"`
+	VehicleTypeName *string              `gorm:"default:null"`
+	VehicleType     *VehicleType         `gorm:"foreignKey:VehicleTypeName;references:Type;constraint:OnDelete:CASCADE"`
+	VehicleRef      *string              `gorm:"default:null"`
+	Vehicle         *Vehicle             `gorm:"foreignKey:VehicleRef;constraint:OnDelete:CASCADE"`
+	IntervalDays    *uint                `gorm:"default:null"`
+	IntervalKm      *uint                `gorm:"default:null"`
+	DeadlineDays    uint                 `gorm:"not null;default:7"` // days given to resolve created request
+	CreatedByRef    *uint                `gorm:"not null"`
+	CreatedBy       *User                `gorm:"foreignKey:CreatedByRef"`
+	CreatedAt       time.Time            `gorm:"autoCreateTime"`
+	MaintenReqs     []MaintenanceRequest `gorm:"foreignKey:MaintenPlanRef;constraint:OnDelete:SET NULL"`
+}
+
+// OdometerReading is mileage of vehicle entered manually
+// mileage after the reading is estimated from completed connections
+type OdometerReading struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement;not null"`
+	VehicleRef   string    `gorm:"not null"`
+	Vehicle      *Vehicle  `gorm:"foreignKey:VehicleRef;constraint:OnDelete:CASCADE"`
+	Mileage      float64   `gorm:"type:decimal(11,1);not null"` // km
+	RecordedAt   time.Time `gorm:"not null"`
+	CreatedByRef *uint     `gorm:"not null"`
+	CreatedBy    *User     `gorm:"foreignKey:CreatedByRef"`
 }
@@ -0,0 +1,36 @@
+// package models contains gorm model definitions for ORM usage
+// this file contains models for spare parts inventory used in maintenance
+package models
+
+import (
+	"time"
+)
+
+// SparePart is item of parts catalogue with its current stock
+// part is low on stock when Stock drops to MinStock
+type SparePart struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement;not null"`
+	Number    string    `gorm:"not null;unique;size:50"` // catalogue number of part
+	Name      string    `gorm:"not null;size:100"`
+	Unit      string    `gorm:"not null;size:10;default:pcs"`
+	UnitPrice float64   `gorm:"default:0.0;type:decimal(11,2);not null"`
+	Stock     float64   `gorm:"default:0.0;type:decimal(11,2);not null"`
+	MinStock  float64   `gorm:"default:0.0;type:decimal(11,2);not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// MaintenanceReportItem is part used in maintenance, UnitPrice is price of part when report was saved
+type MaintenanceReportItem struct {
+	ID            uint               `gorm:"primaryKey;autoIncrement;not null"`
+	MaintenRepRef uint               `gorm:"not null"`
+	MaintenRep    *MaintenanceReport `gorm:"foreignKey:MaintenRepRef"`
+	SparePartRef  uint               `gorm:"not null"`
+	SparePart     *SparePart         `gorm:"foreignKey:SparePartRef;constraint:OnDelete:RESTRICT"`
+	Quantity      float64            `gorm:"type:decimal(11,2);not null"`
+	UnitPrice     float64            `gorm:"default:0.0;type:decimal(11,2);not null"`
+}
+
+// Cost returns price of all pieces of part used
+func (i *MaintenanceReportItem) Cost() float64 {
+	return i.Quantity * i.UnitPrice
+}
@@ -0,0 +1,39 @@
+// package models contains gorm model definitions for ORM usage
+// this file contains models for qualifications of drivers
+package models
+
+import (
+	"time"
+)
+
+// Licence qualifies driver to drive vehicles of given type until its expiry
+// renewed licence is recorded as new licence
+type Licence struct {
+	ID              uint         `gorm:"primaryKey;autoIncrement;not null"`
+	DriverID        uint         `gorm:"not null"`
+	Driver          *User        `gorm:"foreignKey:DriverID"`
+	VehicleTypeName string       `gorm:"not null"`
+	VehicleType     *VehicleType `gorm:"foreignKey:VehicleTypeName;references:Type;constraint:OnDelete:CASCADE"`
+	Category        string       `gorm:"not null;size:4"`
+	ValidUntil      time.Time    `gorm:"type:date;not null"`
+}
+
+// RouteKnowledge qualifies driver to drive on given line, without ValidUntil it does not expire
+type RouteKnowledge struct {
+	ID         uint       `gorm:"primaryKey;autoIncrement;not null"`
+	DriverID   uint       `gorm:"not null"`
+	Driver     *User      `gorm:"foreignKey:DriverID"`
+	LineName   string     `gorm:"not null"`
+	Line       *Line      `gorm:"foreignKey:LineName;references:Name;constraint:OnDelete:CASCADE"`
+	ValidUntil *time.Time `gorm:"type:date;default:null"`
+}
+
+// Valid checks if licence is valid during whole day of given time
+func (l *Licence) Valid(at time.Time) bool {
+	return !l.ValidUntil.Before(time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, l.ValidUntil.Location()))
+}
+
+// Valid checks if route knowledge is valid during whole day of given time
+func (r *RouteKnowledge) Valid(at time.Time) bool {
+	return r.ValidUntil == nil || !r.ValidUntil.Before(time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, r.ValidUntil.Location()))
+}
@@ -0,0 +1,28 @@
+// package models contains gorm model definitions for ORM usage
+// this file contains models for real-time vehicle data
+package models
+
+import (
+	"time"
+)
+
+type RealtimeEventType string
+
+const (
+	PositionEvent RealtimeEventType = "position"
+	DepartedEvent RealtimeEventType = "departed"
+)
+
+// RealtimeEvent is position or departure from stop reported for running connection
+type RealtimeEvent struct {
+	ID           uint              `gorm:"primaryKey;autoIncrement;not null"`
+	ConnectionID uint              `gorm:"not null;index"`
+	Type         RealtimeEventType `gorm:"not null"`
+	StopName     *string           `gorm:"default:null"`
+	StopIndex    *int              `gorm:"default:null"` // index of stop in direction of connection
+	Latitude     *float64          `gorm:"default:null"`
+	Longitude    *float64          `gorm:"default:null"`
+	Time         time.Time         `gorm:"not null"`
+	Delay        int               `gorm:"not null"` // seconds
+	CreatedAt    time.Time         `gorm:"autoCreateTime"`
+}
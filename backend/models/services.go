@@ -0,0 +1,65 @@
+// package models contains gorm model definitions for ORM usage
+// this file contains models for recurring services
+package models
+
+import (
+	"time"
+)
+
+type ExceptionType string
+
+const (
+	AddedException   ExceptionType = "added"
+	RemovedException ExceptionType = "removed"
+)
+
+// WeekdayNames are names of weekdays used by services, Monday first
+var WeekdayNames = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// AllWeekdays is weekday mask of service running every day
+const AllWeekdays uint8 = 1<<7 - 1
+
+// Service is recurring connection, concrete connections are generated from it
+type Service struct {
+	ID                  uint   `gorm:"primaryKey;autoIncrement;not null"`
+	LineName            string `gorm:"not null"`
+	DepartureTime       string `gorm:"not null"` // 15:04
+	Direction           bool
+	Weekdays            uint8              `gorm:"not null"` // bit 0 Monday ... bit 6 Sunday
+	ValidFrom           time.Time          `gorm:"type:date;not null"`
+	ValidTo             *time.Time         `gorm:"type:date;default:null"` // nil for services without end
+	VehicleRegistration *string            `gorm:"default:null"`
+	DriverID            *uint              `gorm:"default:null"`
+	Exceptions          []ServiceException `gorm:"constraint:OnDelete:CASCADE"`
+	Connections         []Connection       `gorm:"constraint:OnDelete:SET NULL"`
+}
+
+// ServiceException adds or removes single day of service, e.g. holiday
+type ServiceException struct {
+	ID        uint          `gorm:"primaryKey;autoIncrement;not null"`
+	ServiceID uint          `gorm:"not null"`
+	Date      time.Time     `gorm:"type:date;not null"`
+	Type      ExceptionType `gorm:"not null"`
+}
+
+// WeekdayBit returns bit of weekday in service weekday mask
+func WeekdayBit(day time.Weekday) uint8 {
+	return 1 << ((uint(day) + 6) % 7)
+}
+
+// RunsOn checks if service runs on given day
+func (s *Service) RunsOn(day time.Time) bool {
+	date := day.Format("2006-01-02")
+	for _, exception := range s.Exceptions {
+		if exception.Date.Format("2006-01-02") == date {
+			return exception.Type == AddedException
+		}
+	}
+	if date < s.ValidFrom.Format("2006-01-02") {
+		return false
+	}
+	if s.ValidTo != nil && date > s.ValidTo.Format("2006-01-02") {
+		return false
+	}
+	return s.Weekdays&WeekdayBit(day.Weekday()) != 0
+}
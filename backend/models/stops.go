@@ -2,7 +2,17 @@
 // this file contains models for stops
 package models
 
+// Stop is place where connections pick up passengers
+// stops without coordinates are left out of maps and nearest stops,
+// stop with Platforms is station, segments of lines use its platforms and passengers search by station
 type Stop struct {
-	ID   uint   `gorm:"primaryKey;not null;autoIncrement"`
-	Name string `gorm:"not null;unique"`
+	ID         uint     `gorm:"primaryKey;not null;autoIncrement"`
+	Name       string   `gorm:"not null;unique"`
+	Latitude   *float64 `gorm:"default:null"` // WGS 84 degrees, set together with Longitude
+	Longitude  *float64 `gorm:"default:null"`
+	Platform   *string  `gorm:"default:null"`           // platform or bay code, e.g. A or 2
+	Accessible bool     `gorm:"not null;default:false"` // step-free access for wheelchairs
+	Zone       *string  `gorm:"default:null"`           // fare zone
+	ParentID   *uint    `gorm:"default:null"`           // station of platform
+	Platforms  []Stop   `gorm:"foreignKey:ParentID;constraint:OnDelete:SET NULL"`
 }
@@ -22,15 +22,19 @@ const (
 
 type User struct {
 	gorm.Model
-	FirstName      string    `gorm:"not null"`
-	LastName       string    `gorm:"not null"`
-	Email          string    `gorm:"not null"` // Unique among non deleted users
-	BirthDate      time.Time `gorm:"not null"`
-	Password       string    `gorm:"not null"`
-	Role           Role      `gorm:"not null"`
-	FullName       string
-	Connections    []Connection        `gorm:"foreignKey:DriverID"`
-	MalfuncReports []MalfunctionReport `gorm:"foreignKey:CreatedByRef"`
+	FirstName       string    `gorm:"not null"`
+	LastName        string    `gorm:"not null"`
+	Email           string    `gorm:"not null"` // Unique among non deleted users
+	BirthDate       time.Time `gorm:"not null"`
+	Password        string    `gorm:"not null"`
+	Role            Role      `gorm:"not null"`
+	FullName        string
+	Connections     []Connection        `gorm:"foreignKey:DriverID"`
+	MalfuncReports  []MalfunctionReport `gorm:"foreignKey:CreatedByRef"`
+	Absences        []Absence           `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	PreferredShifts []PreferredShift    `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Licences        []Licence           `gorm:"foreignKey:DriverID;constraint:OnDelete:CASCADE"`
+	RouteKnowledge  []RouteKnowledge    `gorm:"foreignKey:DriverID;constraint:OnDelete:CASCADE"`
 }
 
 func (u *User) BeforeSave(tx *gorm.DB) (err error) {
@@ -60,6 +64,26 @@ func (u *User) AfterDelete(tx *gorm.DB) (err error) {
 		return result.Error
 	}
 
+	if result := tx.Model(&Duty{}).Where("driver_id = ?", u.ID).Update("driver_id", nil); result.Error != nil {
+		return result.Error
+	}
+
+	if result := tx.Where("user_id = ?", u.ID).Delete(&Absence{}); result.Error != nil {
+		return result.Error
+	}
+
+	if result := tx.Where("user_id = ?", u.ID).Delete(&PreferredShift{}); result.Error != nil {
+		return result.Error
+	}
+
+	if result := tx.Where("driver_id = ?", u.ID).Delete(&Licence{}); result.Error != nil {
+		return result.Error
+	}
+
+	if result := tx.Where("driver_id = ?", u.ID).Delete(&RouteKnowledge{}); result.Error != nil {
+		return result.Error
+	}
+
 	return nil
 }
 
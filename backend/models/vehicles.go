@@ -2,6 +2,10 @@
 // this file contains models for vehicles
 package models
 
+import (
+	"time"
+)
+
 type Vehicle struct {
 	Registration    string `gorm:"primaryKey;unique;not null"`
 	Capacity        uint   `gorm:"not null"`
@@ -9,10 +13,15 @@ type Vehicle struct {
 	VehicleTypeName string
 	VehicleType     VehicleType         `gorm:"foreignKey:VehicleTypeName;references:Type"`
 	Connections     []Connection        `gorm:"constraint:OnDelete:SET NULL"`
+	Duties          []Duty              `gorm:"constraint:OnDelete:SET NULL"`
 	Malfunctions    []MalfunctionReport `gorm:"foreignKey:VehicleRef;constraint:OnDelete:CASCADE"`
+	ImageKey        *string             `gorm:"default:null"` // photo in storage, its thumbnail is under images.Thumbnail_key
+	ImageUpdatedAt  *time.Time          `gorm:"default:null"`
 }
 
 type VehicleType struct {
-	ID   uint   `gorm:"primaryKey;autoIncrement;not null"`
-	Type string `gorm:"unique;not null"`
+	ID            uint       `gorm:"primaryKey;autoIncrement;not null"`
+	Type          string     `gorm:"unique;not null"`
+	IconKey       *string    `gorm:"default:null"` // icon in storage, its thumbnail is under images.Thumbnail_key
+	IconUpdatedAt *time.Time `gorm:"default:null"`
 }
@@ -44,6 +44,11 @@ func Router() *gin.Engine {
 	router.GET("/api/vehicletypes/list", middleware.RequireAuth(string(models.SuperuserRole)), views.ListVehicleTypes)
 	router.POST("/api/vehicletypes/create", middleware.RequireAuth(string(models.SuperuserRole)), views.CreateVehicleType)
 	router.DELETE("/api/vehicletypes/delete/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.DeleteVehicleType)
+	router.POST("/api/vehicles/image/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.UploadVehicleImage)
+	router.GET("/api/vehicles/image/:id", views.GetVehicleImage)
+	router.DELETE("/api/vehicles/image/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.DeleteVehicleImage)
+	router.POST("/api/vehicletypes/icon/:type", middleware.RequireAuth(string(models.SuperuserRole)), views.UploadVehicleTypeIcon)
+	router.GET("/api/vehicletypes/icon/:type", views.GetVehicleTypeIcon)
 
 	// Connections
 	router.GET("/api/connections/list", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole)), views.ListConnections)
@@ -54,21 +59,64 @@ func Router() *gin.Engine {
 	router.PATCH("/api/connections/assign/:id", middleware.RequireAuth(string(models.DispatcherRole)), views.AssignToConnection)
 	router.PATCH("/api/connections/update/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.UpdateConnection)
 	router.DELETE("/api/connections/delete/:id/:days", middleware.RequireAuth(string(models.SuperuserRole)), views.DeleteConnection)
+	router.PATCH("/api/connections/status/:id", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole)), views.UpdateConnectionStatus)
+	router.POST("/api/connections/roster/preview", middleware.RequireAuth(string(models.DispatcherRole)), views.PreviewRoster)
+	router.POST("/api/connections/roster/commit", middleware.RequireAuth(string(models.DispatcherRole)), views.CommitRoster)
+	router.GET("/api/connections/reassign", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole)), views.ListReassignments)
 	router.GET("/api/connections/list/driver/:id", middleware.RequireAuth(string(models.DriverRole)), views.ListDriverConnections)
 	// not logged user
 	router.GET("/api/connections/search", views.ListUserConnections)
 	router.GET("/api/connections/search/:line", views.ListUserConnectionsByLine)
 	router.GET("/api/connections/search/:line/:date", views.ListConnectionsUserByLineAndDate)
+	router.GET("/api/connections/plan", views.PlanJourney)
 	router.GET("/api/connections/get/details/:id", views.GetDetailOfConnection) //unregistered ???
+	router.GET("/api/connections/realtime/:id", views.GetRealtime)
+	router.POST("/api/connections/realtime/:id", middleware.RequireAuthOrAPIKey("AVL_API_KEY", string(models.DriverRole)), views.RecordRealtimeEvent)
+	// services
+	router.GET("/api/services/list", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole)), views.ListServices)
+	router.GET("/api/services/get/:id", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole)), views.GetService)
+	router.PATCH("/api/services/update/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.UpdateService)
+	router.DELETE("/api/services/delete/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.DeleteService)
+	router.POST("/api/services/generate", middleware.RequireAuth(string(models.SuperuserRole)), views.GenerateServices)
+
+	// duties
+	router.GET("/api/duties/list", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole)), views.ListDuties)
+	router.GET("/api/duties/get/:id", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole)), views.GetDuty)
+	router.POST("/api/duties/create", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole)), views.CreateDuty)
+	router.PATCH("/api/duties/assign/:id", middleware.RequireAuth(string(models.DispatcherRole)), views.AssignDuty)
+	router.DELETE("/api/duties/delete/:id", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole)), views.DeleteDuty)
+	// availability
+	router.GET("/api/availability/list", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole)), views.ListAvailability)
+	router.GET("/api/availability/my", middleware.RequireAuth(string(models.DriverRole), string(models.TechnicianRole)), views.GetMyAvailability)
+	router.POST("/api/availability/absences/create", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole), string(models.DriverRole), string(models.TechnicianRole)), views.CreateAbsence)
+	router.DELETE("/api/availability/absences/delete/:id", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole), string(models.DriverRole), string(models.TechnicianRole)), views.DeleteAbsence)
+	router.PUT("/api/availability/preferences", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole), string(models.DriverRole), string(models.TechnicianRole)), views.UpdatePreferredShifts)
+	// qualifications
+	router.GET("/api/qualifications/get/:id", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole), string(models.DriverRole)), views.GetQualifications)
+	router.GET("/api/qualifications/expiring", middleware.RequireAuth(string(models.SuperuserRole), string(models.DispatcherRole)), views.ListExpiringQualifications)
+	router.POST("/api/qualifications/licences/create", middleware.RequireAuth(string(models.SuperuserRole)), views.CreateLicence)
+	router.POST("/api/qualifications/routes/create", middleware.RequireAuth(string(models.SuperuserRole)), views.CreateRouteKnowledge)
+	router.DELETE("/api/qualifications/licences/delete/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.DeleteLicence)
+	router.DELETE("/api/qualifications/routes/delete/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.DeleteRouteKnowledge)
+	// GTFS
+	router.GET("/api/gtfs/export", views.ExportGTFS)
+	router.GET("/api/gtfs/realtime", views.GTFSRealtime)
+	router.POST("/api/gtfs/import", middleware.RequireAuth(string(models.SuperuserRole)), views.ImportGTFS)
+
 	//stops
 	router.GET("/api/stops", middleware.RequireAuth(string(models.SuperuserRole)), views.ListStops)
 	router.GET("/api/stops/get/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.GetStop)
 	router.POST("/api/stops/create", middleware.RequireAuth(string(models.SuperuserRole)), views.CreateStop)
 	router.PUT("/api/stops/edit/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.EditStop)
 	router.DELETE("/api/stops/delete/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.DeleteStop)
+	router.GET("/api/stops/:id/departures", views.ListStopDepartures)
+	router.GET("/api/stops/geojson", views.ListStopsGeoJSON)
+	router.GET("/api/stops/nearest", views.ListNearestStops)
+	router.GET("/api/stops/stations", views.ListStations)
 
 	//lines
 	router.GET("/api/lines/list", views.ListLines)
+	router.GET("/api/lines/geojson", views.ListLinesGeoJSON)
 	router.GET("/api/lines/get/:line", middleware.RequireAuth(string(models.SuperuserRole)), views.GetLine)
 	router.POST("/api/lines/create", middleware.RequireAuth(string(models.SuperuserRole)), views.CreateLine)
 	router.PATCH("/api/lines/update/:line", middleware.RequireAuth(string(models.SuperuserRole)), views.UpdateLine)
@@ -81,6 +129,7 @@ func Router() *gin.Engine {
 	router.PUT("/api/maintenance/malfunc/update/:id", middleware.RequireAuth(string(models.DriverRole)), views.UpdateMalfuncReport)
 	router.PUT("/api/maintenance/maintenreq/update/:id", middleware.RequireAuth(string(models.SuperuserRole), string(models.TechnicianRole)), views.UpdateMaintenRequest)
 	router.PATCH("/api/maintenance/maintenreq/assigntech/:id", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.AssignTechMaintenRequest)
+	router.PATCH("/api/maintenance/maintenreq/status/:id", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.ChangeMaintenRequestStatus)
 	router.PUT("/api/maintenance/maintenrep/update/:id", middleware.RequireAuth(string(models.TechnicianRole)), views.UpdateMaintenReport)
 	router.DELETE("/api/maintenance/malfunc/delete/:id", middleware.RequireAuth(string(models.DriverRole)), views.DeleteMalfuncReport)
 	router.DELETE("/api/maintenance/maintenreq/delete/:id", middleware.RequireAuth(string(models.DriverRole)), views.DeleteMaintenRequest)
@@ -92,8 +141,37 @@ func Router() *gin.Engine {
 	router.GET("/api/maintenance/maintenreq/list/super/:id/:status", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.ListCreatorStatusMaintenRequests)
 	router.GET("/api/maintenance/maintenreq/list/tech/:id/:status", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.ListResolverStatusMaintenRequests)
 	router.GET("/api/maintenance/maintenreq/get/:id", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.GetMaintenRequest)
+	router.GET("/api/maintenance/maintenreq/history/:id", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.GetMaintenRequestHistory)
 	router.GET("/api/maintenance/maintenrep/list", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.ListMaintenReports)
 	router.GET("/api/maintenance/maintenrep/get/:id", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.GetMaintenReport)
 
+	// Maintenance plans
+	router.GET("/api/maintenance/plans/list", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.ListMaintenPlans)
+	router.GET("/api/maintenance/plans/get/:id", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.GetMaintenPlan)
+	router.POST("/api/maintenance/plans/create", middleware.RequireAuth(string(models.SuperuserRole)), views.CreateMaintenPlan)
+	router.POST("/api/maintenance/plans/run", middleware.RequireAuth(string(models.SuperuserRole)), views.RunMaintenPlans)
+	router.PUT("/api/maintenance/plans/update/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.UpdateMaintenPlan)
+	router.DELETE("/api/maintenance/plans/delete/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.DeleteMaintenPlan)
+	router.GET("/api/maintenance/mileage/get/:id", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.GetVehicleMileage)
+	router.POST("/api/maintenance/mileage/create", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.CreateOdometerReading)
+
+	// Spare parts
+	router.GET("/api/maintenance/parts/list", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.ListSpareParts)
+	router.GET("/api/maintenance/parts/lowstock", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.ListLowStockParts)
+	router.GET("/api/maintenance/parts/get/:id", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.GetSparePart)
+	router.POST("/api/maintenance/parts/create", middleware.RequireAuth(string(models.SuperuserRole)), views.CreateSparePart)
+	router.POST("/api/maintenance/parts/restock/:id", middleware.RequireAuth(string(models.TechnicianRole), string(models.SuperuserRole)), views.RestockSparePart)
+	router.PUT("/api/maintenance/parts/update/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.UpdateSparePart)
+	router.DELETE("/api/maintenance/parts/delete/:id", middleware.RequireAuth(string(models.SuperuserRole)), views.DeleteSparePart)
+
+	// Attachments
+	router.POST("/api/maintenance/malfunc/attachments/:id", middleware.RequireAuth(string(models.DriverRole)), views.CreateMalfuncAttachment)
+	router.POST("/api/maintenance/maintenrep/attachments/:id", middleware.RequireAuth(string(models.TechnicianRole)), views.CreateMaintenRepAttachment)
+	router.GET("/api/attachments/download/:id", views.DownloadAttachment)
+	router.DELETE("/api/attachments/delete/:id", middleware.RequireAuth(string(models.DriverRole), string(models.TechnicianRole)), views.DeleteAttachment)
+
+	// Maintenance analytics
+	router.GET("/api/maintenance/analytics", middleware.RequireAuth(string(models.SuperuserRole)), views.GetMaintenanceAnalytics)
+
 	return router
 }
@@ -19,7 +19,9 @@ func init() {
 
 func main() {
 	gofakeit.Seed(69420)
-	api.Migrate_all()
+	if err := api.Migrate_all(); err != nil {
+		panic(err)
+	}
 	/*
 		seed users
 		mail: root@<role>.com
@@ -57,8 +59,13 @@ func main() {
 	}
 	//seed stops
 	for i := 0; i < 22; i++ {
+		// stops are placed around Brno
+		latitude, longitude := gofakeit.Float64Range(49.15, 49.25), gofakeit.Float64Range(16.55, 16.70)
 		stop := models.Stop{
-			Name: gofakeit.StreetName(),
+			Name:       gofakeit.StreetName(),
+			Latitude:   &latitude,
+			Longitude:  &longitude,
+			Accessible: gofakeit.Bool(),
 		}
 		utils.DB.Create(&stop)
 	}
@@ -81,6 +88,7 @@ func main() {
 	// seed segments
 	for i := 0; i < len(lines); i++ {
 		initial_segment := models.Segment{
+			Sequence:  1,
 			StopName1: lines[i].InitialStop,
 			StopName2: stops[gofakeit.Number(0, len(stops)-1)].Name,
 			Time:      uint(rand.Intn(3) + 1),
@@ -91,6 +99,7 @@ func main() {
 		utils.DB.Save(&lines[i])
 		for j := 0; j < 3; j++ {
 			next_segment := models.Segment{
+				Sequence:  uint(len(lines[i].Segments) + 1),
 				StopName1: lines[i].Segments[len(lines[i].Segments)-1].StopName2,
 				StopName2: stops[gofakeit.Number(0, len(stops)-1)].Name,
 				Time:      uint(rand.Intn(3) + 1),
@@ -101,6 +110,7 @@ func main() {
 			utils.DB.Save(&lines[i])
 		}
 		final_segment := models.Segment{
+			Sequence:  uint(len(lines[i].Segments) + 1),
 			StopName1: lines[i].Segments[len(lines[i].Segments)-1].StopName2,
 			StopName2: lines[i].FinalStop,
 			Time:      uint(rand.Intn(3) + 1),
@@ -110,6 +120,15 @@ func main() {
 		lines[i].Segments = append(lines[i].Segments, final_segment)
 		utils.DB.Save(&lines[i])
 	}
+	//seed qualifications of driver
+	var driver models.User
+	utils.DB.First(&driver, "role = ?", models.DriverRole)
+	for _, v := range vehicleTypes {
+		utils.DB.Create(&models.Licence{DriverID: driver.ID, VehicleTypeName: v.Type, Category: "D", ValidUntil: gofakeit.FutureDate()})
+	}
+	for _, line := range lines {
+		utils.DB.Create(&models.RouteKnowledge{DriverID: driver.ID, LineName: line.Name})
+	}
 	for i := 0; i < 8; i++ {
 		connection := models.Connection{
 			DepartureTime:       gofakeit.Date(),
@@ -0,0 +1,247 @@
+// package serializers contains serializers used for serializing data
+// this file contains serializers for maintenance cost and reliability analytics of fleet
+package serializers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// AnalyticsGroups are ways maintenance analytics can be grouped by
+var AnalyticsGroups = []string{"vehicle", "type", "brand", "month"}
+
+// MaintenanceAnalyticsSerializer is used to serialize maintenance costs and reliability of one group of vehicles
+// costs are grouped by time of maintenance report, failures and repairs by time of malfunction report
+type MaintenanceAnalyticsSerializer struct {
+	Group             string
+	Reports           int
+	Cost              float64
+	PartsCost         float64
+	LabourCost        float64
+	LabourHours       float64
+	Failures          int
+	MTBFHours         *float64 // mean time between consecutive failures of the same vehicle
+	Repairs           int
+	MTTRHours         *float64 // mean time from malfunction report to maintenance report
+	MeanResponseHours *float64 // mean time from malfunction report to maintenance request
+}
+
+// analytics_group collects sums of durations of one group before their means are computed
+type analytics_group struct {
+	row       MaintenanceAnalyticsSerializer
+	between   time.Duration
+	gaps      int
+	repair    time.Duration
+	response  time.Duration
+	responses int
+}
+
+// Maintenance_analytics aggregates maintenance reports and malfunction reports from from until to by group
+// failures before from are used only as start of time between failures
+func Maintenance_analytics(group string, from time.Time, to time.Time) ([]MaintenanceAnalyticsSerializer, error) {
+	groups := map[string]*analytics_group{}
+	get_group := func(vehicle *models.Vehicle, registration *string, at time.Time) *analytics_group {
+		key := analytics_key(group, vehicle, registration, at)
+		if groups[key] == nil {
+			groups[key] = &analytics_group{row: MaintenanceAnalyticsSerializer{Group: key}}
+		}
+		return groups[key]
+	}
+
+	var reports []models.MaintenanceReport
+	if result := utils.DB.Preload("MaintenReq.Vehicle").Preload("Items").
+		Where("created_at >= ? AND created_at < ?", from, to).Find(&reports); result.Error != nil {
+		return nil, result.Error
+	}
+	for i := range reports {
+		report := &reports[i]
+		var vehicle *models.Vehicle
+		var registration *string
+		if report.MaintenReq != nil {
+			vehicle, registration = report.MaintenReq.Vehicle, report.MaintenReq.VehicleRef
+		}
+		row := &get_group(vehicle, registration, report.CreatedAt).row
+		row.Reports++
+		row.Cost += report.Cost
+		row.LabourHours += report.LabourHours
+		row.LabourCost += report.LabourHours * report.LabourRate
+		for j := range report.Items {
+			row.PartsCost += report.Items[j].Cost()
+		}
+	}
+
+	var malfunctions []models.MalfunctionReport
+	if result := utils.DB.Preload("Vehicle").Where("created_at < ?", to).
+		Order("vehicle_ref, created_at").Find(&malfunctions); result.Error != nil {
+		return nil, result.Error
+	}
+	malfunction_groups := map[uint]*analytics_group{}
+	for i := range malfunctions {
+		malfunction := &malfunctions[i]
+		if malfunction.CreatedAt.Before(from) {
+			continue
+		}
+		stats := get_group(malfunction.Vehicle, malfunction.VehicleRef, malfunction.CreatedAt)
+		malfunction_groups[malfunction.ID] = stats
+		stats.row.Failures++
+		if i > 0 && *malfunctions[i-1].VehicleRef == *malfunction.VehicleRef {
+			stats.between += malfunction.CreatedAt.Sub(malfunctions[i-1].CreatedAt)
+			stats.gaps++
+		}
+	}
+
+	if err := analytics_repairs(malfunctions, malfunction_groups); err != nil {
+		return nil, err
+	}
+
+	rows := []MaintenanceAnalyticsSerializer{}
+	for _, stats := range groups {
+		row := stats.row
+		row.Cost = math.Round(row.Cost*100) / 100
+		row.PartsCost = math.Round(row.PartsCost*100) / 100
+		row.LabourCost = math.Round(row.LabourCost*100) / 100
+		row.MTBFHours = mean_hours(stats.between, stats.gaps)
+		row.MTTRHours = mean_hours(stats.repair, row.Repairs)
+		row.MeanResponseHours = mean_hours(stats.response, stats.responses)
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if group != "month" && rows[i].Cost != rows[j].Cost {
+			return rows[i].Cost > rows[j].Cost
+		}
+		return rows[i].Group < rows[j].Group
+	})
+
+	return rows, nil
+}
+
+// analytics_repairs adds response and repair times of malfunctions into their groups
+// malfunction is responded by its first maintenance request and repaired by first maintenance report of its requests
+func analytics_repairs(malfunctions []models.MalfunctionReport, malfunction_groups map[uint]*analytics_group) error {
+	if len(malfunction_groups) == 0 {
+		return nil
+	}
+	malfunction_ids := []uint{}
+	for id := range malfunction_groups {
+		malfunction_ids = append(malfunction_ids, id)
+	}
+	var requests []models.MaintenanceRequest
+	if result := utils.DB.Where("malfunc_rep_ref IN ?", malfunction_ids).Find(&requests); result.Error != nil {
+		return result.Error
+	}
+	request_ids := []uint{}
+	for _, request := range requests {
+		request_ids = append(request_ids, request.ID)
+	}
+	var reports []models.MaintenanceReport
+	if len(request_ids) != 0 {
+		if result := utils.DB.Where("mainten_req_ref IN ?", request_ids).Find(&reports); result.Error != nil {
+			return result.Error
+		}
+	}
+	reported := map[uint]time.Time{}
+	for _, report := range reports {
+		reported[*report.MaintenReqRef] = report.CreatedAt
+	}
+
+	responded := map[uint]time.Time{}
+	repaired := map[uint]time.Time{}
+	for _, request := range requests {
+		malfunction := *request.MalfuncRepRef
+		if at, ok := responded[malfunction]; !ok || request.CreatedAt.Before(at) {
+			responded[malfunction] = request.CreatedAt
+		}
+		if report_at, ok := reported[request.ID]; ok {
+			if at, ok := repaired[malfunction]; !ok || report_at.Before(at) {
+				repaired[malfunction] = report_at
+			}
+		}
+	}
+	for _, malfunction := range malfunctions {
+		stats := malfunction_groups[malfunction.ID]
+		if stats == nil {
+			continue
+		}
+		if at, ok := responded[malfunction.ID]; ok {
+			stats.response += at.Sub(malfunction.CreatedAt)
+			stats.responses++
+		}
+		if at, ok := repaired[malfunction.ID]; ok {
+			stats.repair += at.Sub(malfunction.CreatedAt)
+			stats.row.Repairs++
+		}
+	}
+
+	return nil
+}
+
+// analytics_key returns name of group of vehicle or time, vehicle without type or brand is in group -
+func analytics_key(group string, vehicle *models.Vehicle, registration *string, at time.Time) string {
+	key := ""
+	switch group {
+	case "type":
+		if vehicle != nil {
+			key = vehicle.VehicleTypeName
+		}
+	case "brand":
+		if vehicle != nil {
+			key = vehicle.Brand
+		}
+	case "month":
+		key = at.Format("2006-01")
+	default:
+		if registration != nil {
+			key = *registration
+		}
+	}
+	if key == "" {
+		return "-"
+	}
+	return key
+}
+
+// mean_hours returns mean of count durations in hours rounded to minutes, nil when there are none
+func mean_hours(total time.Duration, count int) *float64 {
+	if count == 0 {
+		return nil
+	}
+	hours := math.Round((total / time.Duration(count)).Minutes()) / 60
+	return &hours
+}
+
+// Write_analytics_csv writes analytics rows as CSV with header, missing means are empty
+func Write_analytics_csv(rows []MaintenanceAnalyticsSerializer, writer io.Writer) error {
+	csv_writer := csv.NewWriter(writer)
+	csv_writer.Write([]string{"group", "reports", "cost", "parts_cost", "labour_cost", "labour_hours",
+		"failures", "mtbf_hours", "repairs", "mttr_hours", "mean_response_hours"})
+	optional := func(value *float64) string {
+		if value == nil {
+			return ""
+		}
+		return fmt.Sprintf("%.2f", *value)
+	}
+	for _, row := range rows {
+		csv_writer.Write([]string{
+			row.Group,
+			fmt.Sprint(row.Reports),
+			fmt.Sprintf("%.2f", row.Cost),
+			fmt.Sprintf("%.2f", row.PartsCost),
+			fmt.Sprintf("%.2f", row.LabourCost),
+			fmt.Sprintf("%.2f", row.LabourHours),
+			fmt.Sprint(row.Failures),
+			optional(row.MTBFHours),
+			fmt.Sprint(row.Repairs),
+			optional(row.MTTRHours),
+			optional(row.MeanResponseHours),
+		})
+	}
+	csv_writer.Flush()
+	return csv_writer.Error()
+}
@@ -0,0 +1,201 @@
+// package serializers contains serializers used for serializing data
+// this file contains serializers for files attached to malfunction and maintenance reports
+package serializers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/storage"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+)
+
+// AttachmentURLValidity is how long signed download URL of attachment can be used
+const AttachmentURLValidity = 15 * time.Minute
+
+// AttachmentSerializer is used to serialize attachment with its signed download URL
+type AttachmentSerializer struct {
+	ID           uint
+	Kind         models.AttachmentKind
+	FileName     string
+	ContentType  string
+	Size         int64
+	UploadedBy   *UserMaintenanceSerializer
+	CreatedAt    time.Time
+	URL          string
+	URLExpiresAt time.Time
+}
+
+// AttachmentCreateSerializer is used to serialize uploaded file with kind of attachment
+type AttachmentCreateSerializer struct {
+	Kind          models.AttachmentKind
+	File          *multipart.FileHeader
+	ContentType   string // detected from content of file by Valid
+	ValidatorErrs []validators.ValidatorErr
+}
+
+func (a *AttachmentSerializer) FromModel(attachment *models.Attachment) (err error) {
+	a.ID = attachment.ID
+	a.Kind = attachment.Kind
+	a.FileName = attachment.FileName
+	a.ContentType = attachment.ContentType
+	a.Size = attachment.Size
+	a.CreatedAt = attachment.CreatedAt
+	a.URLExpiresAt = time.Now().Add(AttachmentURLValidity).Truncate(time.Second)
+	a.URL = Attachment_url(attachment.ID, a.URLExpiresAt)
+
+	if attachment.UploadedBy == nil {
+		attachment.UploadedBy = &models.User{}
+		if result := utils.DB.Unscoped().First(attachment.UploadedBy, attachment.UploadedByRef); result.Error != nil {
+			return result.Error
+		}
+	}
+	a.UploadedBy = &UserMaintenanceSerializer{}
+
+	return a.UploadedBy.FromModel(attachment.UploadedBy)
+}
+
+// Valid detects type of uploaded file and checks it can be attached as given kind
+func (a *AttachmentCreateSerializer) Valid(allowed_kinds ...models.AttachmentKind) bool {
+	file, err := a.File.Open()
+	if err != nil {
+		a.ValidatorErrs = append(a.ValidatorErrs, validators.ValidatorErr{Name: "AttachmentErr", Desc: err.Error()})
+		return false
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		a.ValidatorErrs = append(a.ValidatorErrs, validators.ValidatorErr{Name: "AttachmentErr", Desc: err.Error()})
+		return false
+	}
+	a.ContentType = http.DetectContentType(head[:n])
+	validators.Attachment_validator(a.Kind, allowed_kinds, a.ContentType, a.File.Size, &a.ValidatorErrs)
+
+	return len(a.ValidatorErrs) == 0
+}
+
+// Store puts uploaded file into storage under prefix and creates its attachment
+// report which the attachment belongs to is set by attach, file is removed again when attachment can not be created
+func (a *AttachmentCreateSerializer) Store(prefix string, uploaded_by uint, attach func(*models.Attachment)) (*models.Attachment, error) {
+	files, err := storage.Default()
+	if err != nil {
+		return nil, err
+	}
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	extension := strings.ToLower(filepath.Ext(a.File.Filename))
+	if !regexp.MustCompile(`^\.[a-z0-9]{1,5}$`).MatchString(extension) {
+		extension = ""
+	}
+	file_name := filepath.Base(a.File.Filename)
+	if len(file_name) > 255 {
+		file_name = file_name[len(file_name)-255:]
+	}
+	attachment := &models.Attachment{
+		Kind:          a.Kind,
+		FileName:      file_name,
+		ContentType:   a.ContentType,
+		Size:          a.File.Size,
+		StorageKey:    prefix + "/" + hex.EncodeToString(random) + extension,
+		UploadedByRef: &uploaded_by,
+	}
+	attach(attachment)
+
+	file, err := a.File.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := files.PutObject(attachment.StorageKey, file, attachment.Size, attachment.ContentType); err != nil {
+		return nil, err
+	}
+	if result := utils.DB.Create(attachment); result.Error != nil {
+		files.DeleteObject(attachment.StorageKey)
+		return nil, result.Error
+	}
+
+	return attachment, nil
+}
+
+// Attachments_of loads attachments of malfunction or maintenance report given by column of their reference
+func Attachments_of(column string, id uint) ([]AttachmentSerializer, error) {
+	var attachments []models.Attachment
+	if result := utils.DB.Preload("UploadedBy").Where(column+" = ?", id).Order("created_at").Find(&attachments); result.Error != nil {
+		return nil, result.Error
+	}
+	serialized := []AttachmentSerializer{}
+	for i := range attachments {
+		attachment := AttachmentSerializer{}
+		if err := attachment.FromModel(&attachments[i]); err != nil {
+			return nil, err
+		}
+		serialized = append(serialized, attachment)
+	}
+	return serialized, nil
+}
+
+// Remove_attachment_files removes files of deleted attachments from storage
+// attachments are already deleted, so files which can not be removed are only logged
+func Remove_attachment_files(attachments []models.Attachment) {
+	if len(attachments) == 0 {
+		return
+	}
+	files, err := storage.Default()
+	if err != nil {
+		log.Printf("attachment files not removed: %v", err)
+		return
+	}
+	for _, attachment := range attachments {
+		if err := files.DeleteObject(attachment.StorageKey); err != nil {
+			log.Printf("attachment file %s not removed: %v", attachment.StorageKey, err)
+		}
+	}
+}
+
+// Attachment_url returns download URL of attachment signed until expires, it can be used without login
+func Attachment_url(id uint, expires time.Time) string {
+	return fmt.Sprintf("/api/attachments/download/%d?expires=%d&signature=%s", id, expires.Unix(), attachment_signature(id, expires.Unix()))
+}
+
+// Valid_attachment_signature checks signature of download URL of attachment and that it has not expired
+func Valid_attachment_signature(id uint, expires string, signature string) bool {
+	expires_unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expires_unix {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(attachment_signature(id, expires_unix)))
+}
+
+// attachment_signature signs attachment and expiration of its URL by SECRET used for login tokens
+func attachment_signature(id uint, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SECRET")))
+	fmt.Fprintf(mac, "attachment:%d:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Find_attachments returns attachments matching condition, used to remove files of attachments deleted with their reports
+func Find_attachments(condition string, args ...interface{}) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	if result := utils.DB.Where(condition, args...).Find(&attachments); result.Error != nil {
+		return nil, result.Error
+	}
+	return attachments, nil
+}
@@ -0,0 +1,227 @@
+// package serializers holds structures and functions for serializing data
+// this file contains serializers for availability of drivers and technicians
+package serializers
+
+import (
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+	"gorm.io/gorm"
+)
+
+// AbsenceSerializer is used to serialize absence of user
+// conflicts are connections and maintenance requests already assigned to user during absence
+type AbsenceSerializer struct {
+	ID                     uint
+	UserID                 uint
+	UserName               string
+	Type                   string
+	StartTime              string
+	EndTime                string
+	Note                   *string
+	ConflictingConnections []uint
+	ConflictingMaintenReqs []uint
+}
+
+// AbsenceCreateSerializer is used to serialize absence of user
+// it is used in POST request to record time off, sick leave or other unavailability
+// drivers and technicians record their own absences, UserID is needed only for absences recorded by dispatcher
+type AbsenceCreateSerializer struct {
+	UserID        *uint
+	Type          string `binding:"required"`
+	StartTime     string `binding:"required"` // 2006-01-02 15:04
+	EndTime       string `binding:"required"` // 2006-01-02 15:04
+	Note          *string
+	ValidatorErrs []validators.ValidatorErr
+	start         time.Time
+	end           time.Time
+}
+
+// PreferredShiftSerializer is used to serialize part of week user prefers to work in
+// Weekday is 0 for sunday to 6 for saturday, shift ending before its start ends next day
+type PreferredShiftSerializer struct {
+	Weekday   time.Weekday
+	StartTime string `binding:"required"` // 15:04
+	EndTime   string `binding:"required"` // 15:04
+}
+
+// PreferredShiftsSerializer is used to serialize all preferred shifts of user
+// it is used in PUT request to replace preferred shifts, UserID is needed only for shifts set by dispatcher
+type PreferredShiftsSerializer struct {
+	UserID        *uint
+	Shifts        []PreferredShiftSerializer
+	ValidatorErrs []validators.ValidatorErr
+}
+
+// AvailabilitySerializer is used to serialize calendar of user with absences and preferred shifts
+type AvailabilitySerializer struct {
+	UserID          uint
+	UserName        string
+	Role            models.Role
+	Absences        []AbsenceSerializer
+	PreferredShifts []PreferredShiftSerializer
+}
+
+// availability_user returns id of user whose availability is changed by logged user, logged user when not given
+// only drivers and technicians have availability, they can change only their own
+func availability_user(user_id *uint, logged_user *models.User, validator_errs *[]validators.ValidatorErr) *uint {
+	if user_id == nil {
+		user_id = &logged_user.ID
+	}
+	if *user_id != logged_user.ID && (logged_user.Role == models.DriverRole || logged_user.Role == models.TechnicianRole) {
+		*validator_errs = append(*validator_errs, validators.ValidatorErr{Name: "PermissionErr", Desc: "Only own availability can be changed"})
+		return user_id
+	}
+	validators.HasRoleValidator(*user_id, validator_errs, models.DriverRole, models.TechnicianRole)
+	return user_id
+}
+
+// Valid checks if absence is valid for logged user and does not overlap other absence of user
+func (a *AbsenceCreateSerializer) Valid(logged_user *models.User) bool {
+	a.UserID = availability_user(a.UserID, logged_user, &a.ValidatorErrs)
+	validators.Absence_type_validator(a.Type, &a.ValidatorErrs)
+	var err error
+	if a.start, err = time.Parse("2006-01-02 15:04", a.StartTime); err != nil {
+		a.ValidatorErrs = append(a.ValidatorErrs, validators.ValidatorErr{Name: "TimeParse", Desc: err.Error()})
+	}
+	if a.end, err = time.Parse("2006-01-02 15:04", a.EndTime); err != nil {
+		a.ValidatorErrs = append(a.ValidatorErrs, validators.ValidatorErr{Name: "TimeParse", Desc: err.Error()})
+	}
+	if len(a.ValidatorErrs) != 0 {
+		return false
+	}
+	if !a.end.After(a.start) {
+		a.ValidatorErrs = append(a.ValidatorErrs, validators.ValidatorErr{Name: "TimeErr", Desc: "End of absence must be after its start"})
+		return false
+	}
+	validators.Absence_validator(a.UserID, a.start, a.end, &a.ValidatorErrs)
+	return len(a.ValidatorErrs) == 0
+}
+
+// CreateModel creates absence model from serializer
+// Valid has to be called before
+func (a *AbsenceCreateSerializer) CreateModel() models.Absence {
+	return models.Absence{
+		UserID:    *a.UserID,
+		Type:      models.AbsenceType(a.Type),
+		StartTime: a.start,
+		EndTime:   a.end,
+		Note:      a.Note,
+	}
+}
+
+// FromModel loads absence model into serializer together with its conflicts
+// user of absence has to be preloaded to fill UserName
+func (a *AbsenceSerializer) FromModel(absence *models.Absence) error {
+	a.ID = absence.ID
+	a.UserID = absence.UserID
+	if absence.User != nil {
+		a.UserName = absence.User.FullName
+	}
+	a.Type = string(absence.Type)
+	a.StartTime = absence.StartTime.Format("2006-01-02 15:04")
+	a.EndTime = absence.EndTime.Format("2006-01-02 15:04")
+	a.Note = absence.Note
+	a.ConflictingConnections = []uint{}
+	a.ConflictingMaintenReqs = []uint{}
+	res := utils.DB.Model(&models.Connection{}).Order("departure_time").
+		Where("driver_id = ? AND status <> ? AND departure_time < ? AND arrival_time > ?",
+			absence.UserID, models.CancelledConnection, absence.EndTime, absence.StartTime).
+		Pluck("id", &a.ConflictingConnections)
+	if res.Error != nil {
+		return res.Error
+	}
+	// unfinished requests are conflicting when they should be resolved during absence
+	res = utils.DB.Model(&models.MaintenanceRequest{}).Order("id").
+		Where("resolved_by_ref = ? AND status NOT IN ? AND deadline >= ? AND deadline <= ?",
+			absence.UserID, models.ClosedStatuses, absence.StartTime, absence.EndTime).
+		Pluck("id", &a.ConflictingMaintenReqs)
+	return res.Error
+}
+
+// Valid checks if preferred shifts are valid for logged user
+func (p *PreferredShiftsSerializer) Valid(logged_user *models.User) bool {
+	p.UserID = availability_user(p.UserID, logged_user, &p.ValidatorErrs)
+	for _, shift := range p.Shifts {
+		if shift.Weekday < time.Sunday || shift.Weekday > time.Saturday {
+			p.ValidatorErrs = append(p.ValidatorErrs, validators.ValidatorErr{Name: "WeekdayErr", Desc: "Weekday must be between 0 (sunday) and 6 (saturday)"})
+		}
+		start, err := time.Parse("15:04", shift.StartTime)
+		if err != nil {
+			p.ValidatorErrs = append(p.ValidatorErrs, validators.ValidatorErr{Name: "TimeParse", Desc: err.Error()})
+			continue
+		}
+		end, err := time.Parse("15:04", shift.EndTime)
+		if err != nil {
+			p.ValidatorErrs = append(p.ValidatorErrs, validators.ValidatorErr{Name: "TimeParse", Desc: err.Error()})
+			continue
+		}
+		if start.Equal(end) {
+			p.ValidatorErrs = append(p.ValidatorErrs, validators.ValidatorErr{Name: "TimeErr", Desc: "Preferred shift must not start and end at same time"})
+		}
+	}
+	return len(p.ValidatorErrs) == 0
+}
+
+// Replace replaces all preferred shifts of user with serialized ones
+// Valid has to be called before
+func (p *PreferredShiftsSerializer) Replace() ([]models.PreferredShift, error) {
+	shifts := []models.PreferredShift{}
+	for _, shift := range p.Shifts {
+		shifts = append(shifts, models.PreferredShift{
+			UserID:    *p.UserID,
+			Weekday:   shift.Weekday,
+			StartTime: shift.StartTime,
+			EndTime:   shift.EndTime,
+		})
+	}
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", *p.UserID).Delete(&models.PreferredShift{}).Error; err != nil {
+			return err
+		}
+		if len(shifts) == 0 {
+			return nil
+		}
+		return tx.Create(&shifts).Error
+	})
+	return shifts, err
+}
+
+// FromModel loads preferred shift model into serializer
+func (p *PreferredShiftSerializer) FromModel(shift *models.PreferredShift) {
+	p.Weekday = shift.Weekday
+	p.StartTime = shift.StartTime
+	p.EndTime = shift.EndTime
+}
+
+// Get_availability serializes calendar of users
+// absences and preferred shifts of users have to be preloaded
+func Get_availability(users []models.User) ([]AvailabilitySerializer, error) {
+	calendar := []AvailabilitySerializer{}
+	for _, user := range users {
+		availability := AvailabilitySerializer{
+			UserID:          user.ID,
+			UserName:        user.FullName,
+			Role:            user.Role,
+			Absences:        []AbsenceSerializer{},
+			PreferredShifts: []PreferredShiftSerializer{},
+		}
+		for i := range user.Absences {
+			absence := AbsenceSerializer{}
+			user.Absences[i].User = &user
+			if err := absence.FromModel(&user.Absences[i]); err != nil {
+				return nil, err
+			}
+			availability.Absences = append(availability.Absences, absence)
+		}
+		for i := range user.PreferredShifts {
+			shift := PreferredShiftSerializer{}
+			shift.FromModel(&user.PreferredShifts[i])
+			availability.PreferredShifts = append(availability.PreferredShifts, shift)
+		}
+		calendar = append(calendar, availability)
+	}
+	return calendar, nil
+}
@@ -25,33 +25,51 @@ type ConnectionSerializer struct {
 	DriverID         *uint
 	DriverName       string
 	VehicleType      string
+	Status           string
+	StatusReason     *string
+	MalfuncRepID     *uint
 	StopInConnection *[]StopInConnection
+	// vehicle of future connection is out of service for maintenance and has to be replaced
+	NeedsReassignment bool
 }
 
 // ConnectionUserSerializer is used to serialize data about connection for not registered user
 // it is used in GET request to get data about connection
+// delay and expected times are nil without real-time data
 type ConnectionUserSerializer struct {
-	ConnectionID  uint
-	LineName      string
-	DepartureTime string
-	ArrivalTime   string
-	Direction     bool
-	InitialStop   string
-	FinalStop     string
-	VehicleType   string
+	ConnectionID          uint
+	LineName              string
+	DepartureTime         string
+	ArrivalTime           string
+	ExpectedDepartureTime *string
+	ExpectedArrivalTime   *string
+	DelayMinutes          *int
+	Status                string
+	StatusReason          *string
+	Direction             bool
+	InitialStop           string
+	FinalStop             string
+	VehicleType           string
+	VehicleTypeIcon       *string // URL of icon of vehicle type, nil when type has no icon
 }
 
 // ConnectionCreateSerializer is used to serialize data for creating connection
 // it is used in POST request to create a new connection
+// connection is created as recurring service running on Weekdays until ValidTo,
+// NumberOfDays can be used instead of ValidTo, without both the service has no end
 type ConnectionCreateSerializer struct {
 	LineName      string `binding:"required"`
 	DepartureTime string `binding:"required"`
 	VehicleReg    *string
 	Direction     bool
 	DriverID      *uint
-	NumberOfDays  int       `binding:"required"`
+	NumberOfDays  int
+	Weekdays      []string
+	ValidTo       string
+	Exceptions    []ServiceExceptionSerializer
 	ArrivalTime   time.Time //neplnit z fe
 	ValidatorErrs []validators.ValidatorErr
+	connections   []models.Connection
 }
 
 // ConnectionAssignSerializer is used to serialize data for assigning driver and vehicle
@@ -62,6 +80,7 @@ type ConnectionAssignSerializer struct {
 	NumberOfDays  int       `binding:"required"`
 	DepartureTime string    //neplnit z fe
 	ArrivalTime   time.Time //neplnit z fe
+	LineName      string    //neplnit z fe
 	ValidatorErrs []validators.ValidatorErr
 }
 
@@ -81,45 +100,145 @@ type ConnectionUpdateSerializer struct {
 // ConnectionDetailsSerializer is used to serialize data about connection for not registered user
 // it is used in GET request to get data about connection
 type ConnectionDetailsSerializer struct {
-	ID        uint
-	LineName  string
-	Type      string
-	ListStops *[]StopInConnection
+	ID           uint
+	LineName     string
+	Type         string
+	TypeIcon     *string // URL of icon of vehicle type, nil when type has no icon
+	Status       string
+	StatusReason *string
+	ListStops    *[]StopInConnection
 }
 
 // StopInConnection is used to serialize data about stop in connection
+// expected times are nil without real-time data, cancelled stops are not served
 type StopInConnection struct {
-	DepartureTime string
-	StopName      string
+	ArrivalTime           string
+	DepartureTime         string
+	ExpectedArrivalTime   *string
+	ExpectedDepartureTime *string
+	StopName              string
+	Cancelled             bool
 }
 
-// Get_arrival_time calculates arrival time from departure time depending on line
-func Get_arrival_time(dep_time time.Time, line_name string) (arrival_time time.Time) {
-	line := models.Line{}
-	utils.DB.Preload("Segments").First(&line, "name=?", line_name)
-	var duration time.Duration
-	for _, segment := range line.Segments {
-		duration += time.Minute * time.Duration(segment.Time)
+// ConnectionStop holds stop of connection with its scheduled arrival and departure time
+// and expected times when real-time data are known
+type ConnectionStop struct {
+	StopName              string
+	ArrivalTime           time.Time
+	DepartureTime         time.Time
+	ExpectedArrivalTime   *time.Time
+	ExpectedDepartureTime *time.Time
+	Cancelled             bool
+}
+
+// Get_connection_stops calculates stops of connection and their arrival and departure times
+// stops are ordered in direction of the connection
+func Get_connection_stops(line_name string, direction bool, departure time.Time) ([]ConnectionStop, error) {
+	line, err := Get_line(line_name)
+	if err != nil {
+		return nil, err
+	}
+	stops := []ConnectionStop{}
+	for _, stop := range Line_stops(line.Segments, direction) {
+		stops = append(stops, ConnectionStop{
+			StopName:      stop.StopName,
+			ArrivalTime:   departure.Add(stop.Arrival),
+			DepartureTime: departure.Add(stop.Departure),
+		})
 	}
-	arrival_time = dep_time.Add(duration)
+	return stops, nil
+}
+
+// Get_arrival_time calculates arrival time from departure time depending on line and direction
+func Get_arrival_time(dep_time time.Time, line_name string, direction bool) (arrival_time time.Time) {
+	line, _ := Get_line(line_name)
+	arrival_time = dep_time.Add(Line_duration(line.Segments, direction))
 	return
 }
 
 // Valid checks if connection data for creating are valid
+// availability of driver and vehicle is checked for every generated connection
 func (conn *ConnectionCreateSerializer) Valid() bool {
 	validators.Line_name_validator(conn.LineName, &conn.ValidatorErrs)
 	validators.Vehicle_registration_validator(conn.VehicleReg, &conn.ValidatorErrs)
 	validators.Driver_id_validator(conn.DriverID, &conn.ValidatorErrs)
+	validators.Weekdays_validator(conn.Weekdays, &conn.ValidatorErrs)
+	for _, exception := range conn.Exceptions {
+		validators.Service_exception_validator(exception.Date, exception.Type, &conn.ValidatorErrs)
+	}
+	dep_time, err := time.Parse("2006-01-02 15:04", conn.DepartureTime)
+	if err != nil {
+		conn.ValidatorErrs = append(conn.ValidatorErrs, validators.ValidatorErr{Name: "TimeParse", Desc: err.Error()})
+	}
+	if len(conn.ValidatorErrs) != 0 {
+		return false
+	}
+	validators.Line_vehicle_validator(conn.LineName, conn.VehicleReg, &conn.ValidatorErrs)
+	validators.Vehicle_maintenance_validator(conn.VehicleReg, &conn.ValidatorErrs)
+	if conn.ValidTo == "" && conn.NumberOfDays > 0 {
+		conn.ValidTo = dep_time.AddDate(0, 0, conn.NumberOfDays-1).Format("2006-01-02")
+	}
+	validators.Service_dates_validator(dep_time.Format("2006-01-02"), conn.ValidTo, &conn.ValidatorErrs)
 	if len(conn.ValidatorErrs) != 0 {
 		return false
 	}
 
-	dep_time, _ := time.Parse("2006-01-02 15:04", conn.DepartureTime)
-	conn.ArrivalTime = Get_arrival_time(dep_time, conn.LineName)
-	validators.Vehicle_availability(-1, conn.VehicleReg, conn.DepartureTime, conn.ArrivalTime, conn.NumberOfDays, &conn.ValidatorErrs)
-	validators.Driver_availability(-1, conn.DriverID, conn.DepartureTime, conn.ArrivalTime, conn.NumberOfDays, &conn.ValidatorErrs)
+	service := conn.service()
+	from, to := service.ValidFrom, service_horizon(service)
+	conn.connections, err = Service_connections(service, from, to)
+	if err != nil {
+		conn.ValidatorErrs = append(conn.ValidatorErrs, validators.ValidatorErr{Name: "DatabaseErr", Desc: err.Error()})
+		return false
+	}
+	if len(conn.connections) == 0 {
+		conn.ValidatorErrs = append(conn.ValidatorErrs, validators.ValidatorErr{Name: "CreatingConnErr", Desc: "Service does not run on any day"})
+		return false
+	}
+	conn.ArrivalTime = conn.connections[0].ArrivalTime
+	for _, connection := range conn.connections {
+		departure := connection.DepartureTime.Format("2006-01-02 15:04")
+		validators.Vehicle_availability(-1, conn.VehicleReg, departure, connection.ArrivalTime, 1, &conn.ValidatorErrs)
+		validators.Driver_availability(-1, conn.DriverID, departure, connection.ArrivalTime, 1, &conn.ValidatorErrs)
+		validators.Driver_qualification_validator(conn.DriverID, conn.VehicleReg, conn.LineName, connection.DepartureTime, connection.ArrivalTime, &conn.ValidatorErrs)
+		if len(conn.ValidatorErrs) != 0 {
+			return false
+		}
+	}
+	validators.Connections_working_time(conn.connections, &conn.ValidatorErrs)
 	return len(conn.ValidatorErrs) == 0
+}
 
+// service creates service model from serializer
+func (conn ConnectionCreateSerializer) service() *models.Service {
+	dep_time, _ := time.Parse("2006-01-02 15:04", conn.DepartureTime)
+	service := &models.Service{
+		LineName:            conn.LineName,
+		DepartureTime:       dep_time.Format("15:04"),
+		Direction:           conn.Direction,
+		Weekdays:            Weekday_mask(conn.Weekdays),
+		ValidFrom:           Service_day(dep_time),
+		VehicleRegistration: conn.VehicleReg,
+		DriverID:            conn.DriverID,
+		Exceptions:          Service_exceptions(conn.Exceptions),
+	}
+	if conn.ValidTo != "" {
+		valid_to, _ := time.Parse("2006-01-02", conn.ValidTo)
+		service.ValidTo = &valid_to
+	}
+	return service
+}
+
+// service_horizon returns last day connections of new service are generated for
+// services without end are generated only ServiceHorizonDays ahead
+func service_horizon(service *models.Service) time.Time {
+	if service.ValidTo != nil {
+		return *service.ValidTo
+	}
+	horizon := Service_day(time.Now()).AddDate(0, 0, ServiceHorizonDays)
+	if horizon.Before(service.ValidFrom) {
+		return service.ValidFrom
+	}
+	return horizon
 }
 
 // Valid checks if connection data for assign are valid
@@ -129,19 +248,21 @@ func (conn *ConnectionAssignSerializer) Valid(id int) bool {
 	if len(conn.ValidatorErrs) != 0 {
 		return false
 	}
+	validators.Line_vehicle_validator(conn.LineName, conn.VehicleReg, &conn.ValidatorErrs)
+	validators.Vehicle_maintenance_validator(conn.VehicleReg, &conn.ValidatorErrs)
 	validators.Vehicle_availability(id, conn.VehicleReg, conn.DepartureTime, conn.ArrivalTime, 1, &conn.ValidatorErrs)
 	validators.Driver_availability(id, conn.DriverID, conn.DepartureTime, conn.ArrivalTime, 1, &conn.ValidatorErrs)
+	if departure, err := time.Parse("2006-01-02 15:04", conn.DepartureTime); err == nil {
+		validators.Driver_qualification_validator(conn.DriverID, conn.VehicleReg, conn.LineName, departure, conn.ArrivalTime, &conn.ValidatorErrs)
+	}
 	return len(conn.ValidatorErrs) == 0
 }
 
-// CreateModel creates model from serializer
-func (conn ConnectionCreateSerializer) CreateModel() (connection_model []models.Connection, err error) {
-	dep_time, err := time.Parse("2006-01-02 15:04", conn.DepartureTime)
-	if err != nil {
-		return
-	}
-	for i := 0; i < int(conn.NumberOfDays); i++ {
-		res := utils.DB.Where("line_name = ? AND departure_time = ?", conn.LineName, dep_time).Find(&models.Connection{})
+// CreateModel creates service model with its generated connections from serializer
+// Valid has to be called before
+func (conn ConnectionCreateSerializer) CreateModel() (service_model *models.Service, err error) {
+	for _, connection := range conn.connections {
+		res := utils.DB.Where("line_name = ? AND departure_time = ?", conn.LineName, connection.DepartureTime).Find(&models.Connection{})
 		if res.Error != nil {
 			err = res.Error
 			return
@@ -150,16 +271,112 @@ func (conn ConnectionCreateSerializer) CreateModel() (connection_model []models.
 			err = fmt.Errorf("Connection at same time for this line already exists")
 			return
 		}
-		connection_model = append(connection_model, models.Connection{
-			LineName:            conn.LineName,
-			DepartureTime:       dep_time,
-			ArrivalTime:         conn.ArrivalTime,
-			VehicleRegistration: conn.VehicleReg,
-			Direction:           conn.Direction,
-			DriverID:            conn.DriverID,
-		})
-		dep_time = dep_time.Add(time.Hour * 24)
-		conn.ArrivalTime = conn.ArrivalTime.Add(time.Hour * 24)
 	}
+	service_model = conn.service()
+	service_model.Connections = conn.connections
 	return
 }
+
+// ReassignmentSerializer is used to serialize future connection whose vehicle has blocking maintenance request
+// or which was flagged by malfunction report of its vehicle
+type ReassignmentSerializer struct {
+	ConnectionID     uint
+	LineName         string
+	DepartureTime    string
+	ArrivalTime      string
+	VehicleReg       string
+	DriverID         *uint
+	ServiceID        *uint
+	DutyID           *uint
+	MaintenReqID     *uint
+	MaintenReqStatus *models.Status
+	Deadline         *time.Time
+	MalfuncRepID     *uint
+}
+
+// Needs_reassignment checks if connection which did not run yet has vehicle with blocking maintenance request
+// or was flagged by malfunction report of its vehicle, ReassignMalfunc of connection has to be loaded
+func Needs_reassignment(connection *models.Connection, in_maintenance map[string]bool) bool {
+	if connection.VehicleRegistration == nil {
+		return false
+	}
+	if !in_maintenance[*connection.VehicleRegistration] && !Malfunction_flagged(connection) {
+		return false
+	}
+	if connection.Status == models.CancelledConnection || connection.Status == models.CompletedConnection {
+		return false
+	}
+	return connection.DepartureTime.After(utils.Wall_clock_now())
+}
+
+// Malfunction_flagged checks if connection is linked to malfunction report of vehicle which still serves it,
+// flag is cleared by assigning other vehicle
+func Malfunction_flagged(connection *models.Connection) bool {
+	return connection.ReassignMalfunc != nil && connection.ReassignMalfunc.VehicleRef != nil &&
+		connection.VehicleRegistration != nil && *connection.ReassignMalfunc.VehicleRef == *connection.VehicleRegistration
+}
+
+// Connections_to_reassign lists connections departing after given time whose vehicle has blocking maintenance request
+// or which were flagged by malfunction report of their vehicle
+// only connections of given vehicle are listed when registration is not empty
+func Connections_to_reassign(from time.Time, registration string) ([]ReassignmentSerializer, error) {
+	var requests []models.MaintenanceRequest
+	query := utils.DB.Scopes(validators.Blocking_maintenance).Where("vehicle_ref IS NOT NULL").Order("created_at")
+	if registration != "" {
+		query = query.Where("vehicle_ref = ?", registration)
+	}
+	if res := query.Find(&requests); res.Error != nil {
+		return nil, res.Error
+	}
+	vehicle_requests := map[string]*models.MaintenanceRequest{}
+	registrations := []string{}
+	for i := range requests {
+		if _, ok := vehicle_requests[*requests[i].VehicleRef]; !ok {
+			vehicle_requests[*requests[i].VehicleRef] = &requests[i]
+			registrations = append(registrations, *requests[i].VehicleRef)
+		}
+	}
+	var connections []models.Connection
+	query = utils.DB.Preload("ReassignMalfunc").Where("vehicle_registration IS NOT NULL AND departure_time > ? AND status NOT IN ?", from,
+		[]models.ConnectionStatus{models.CancelledConnection, models.CompletedConnection})
+	if len(registrations) != 0 {
+		query = query.Where("vehicle_registration IN ? OR reassign_malfunc_ref IS NOT NULL", registrations)
+	} else {
+		query = query.Where("reassign_malfunc_ref IS NOT NULL")
+	}
+	if registration != "" {
+		query = query.Where("vehicle_registration = ?", registration)
+	}
+	if res := query.Order("departure_time").Find(&connections); res.Error != nil {
+		return nil, res.Error
+	}
+	reassignments := []ReassignmentSerializer{}
+	for i := range connections {
+		connection := &connections[i]
+		request, in_maintenance := vehicle_requests[*connection.VehicleRegistration]
+		flagged := Malfunction_flagged(connection)
+		if !in_maintenance && !flagged {
+			continue
+		}
+		reassignment := ReassignmentSerializer{
+			ConnectionID:  connection.ID,
+			LineName:      connection.LineName,
+			DepartureTime: connection.DepartureTime.Format("2006-01-02 15:04"),
+			ArrivalTime:   connection.ArrivalTime.Format("2006-01-02 15:04"),
+			VehicleReg:    *connection.VehicleRegistration,
+			DriverID:      connection.DriverID,
+			ServiceID:     connection.ServiceID,
+			DutyID:        connection.DutyID,
+		}
+		if in_maintenance {
+			reassignment.MaintenReqID = &request.ID
+			reassignment.MaintenReqStatus = &request.Status
+			reassignment.Deadline = request.Deadline
+		}
+		if flagged {
+			reassignment.MalfuncRepID = connection.ReassignMalfuncRef
+		}
+		reassignments = append(reassignments, reassignment)
+	}
+	return reassignments, nil
+}
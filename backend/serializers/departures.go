@@ -0,0 +1,25 @@
+// package serializers holds structures and functions for serializing data
+// this file contains serializers for departure boards
+package serializers
+
+// DepartureBoardSerializer is used to serialize next departures from stop or whole station
+// it is used in GET request to get departure board of stop
+type DepartureBoardSerializer struct {
+	StopID     uint
+	StopName   string
+	Departures []DepartureSerializer
+}
+
+// DepartureSerializer is used to serialize one departure of connection from stop
+// expected departure is nil without real-time data, cancelled departures are shown too
+type DepartureSerializer struct {
+	ConnectionID          uint
+	LineName              string
+	Destination           string
+	StopName              string  // platform or stop of station the connection departs from
+	Platform              *string // platform code of the stop
+	DepartureTime         string
+	ExpectedDepartureTime *string
+	Cancelled             bool
+	VehicleType           string
+}
@@ -0,0 +1,334 @@
+// package serializers holds structures and functions for serializing data
+// this file contains serializers for duties of drivers
+package serializers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+	"gorm.io/gorm"
+)
+
+// duty item types
+const (
+	SignOnItem   = "sign-on"
+	TripItem     = "trip"
+	DeadheadItem = "deadhead"
+	BreakItem    = "break"
+	SignOffItem  = "sign-off"
+)
+
+// DutyCreateSerializer is used to serialize data for creating duty
+// it is used in POST request to create duty from connections,
+// driver and vehicle of duty replace ones assigned to its connections
+type DutyCreateSerializer struct {
+	DepotName     string `binding:"required"`
+	SignOn        string `binding:"required"` // 2006-01-02 15:04
+	SignOff       string `binding:"required"` // 2006-01-02 15:04
+	ConnectionIDs []uint `binding:"required"`
+	Deadheads     []DeadheadSerializer
+	DriverID      *uint
+	VehicleReg    *string
+	ValidatorErrs []validators.ValidatorErr
+	connections   []models.Connection
+}
+
+// DeadheadSerializer is used to serialize ride of empty vehicle within duty
+type DeadheadSerializer struct {
+	FromStop      string `binding:"required"`
+	ToStop        string `binding:"required"`
+	DepartureTime string `binding:"required"` // 2006-01-02 15:04
+	ArrivalTime   string `binding:"required"` // 2006-01-02 15:04
+}
+
+// DutyAssignSerializer is used to serialize driver and vehicle assigned to whole duty
+// it is used in PATCH request to assign duty, nil driver or vehicle unassigns it
+type DutyAssignSerializer struct {
+	DriverID      *uint
+	VehicleReg    *string
+	ValidatorErrs []validators.ValidatorErr
+}
+
+// DutySerializer is used to serialize duty with its items in order
+// connections of driver without duty are serialized as duty without DutyID and depot
+type DutySerializer struct {
+	DutyID     *uint
+	DepotName  string
+	SignOn     string
+	SignOff    string
+	DriverID   *uint
+	DriverName string
+	VehicleReg *string
+	Items      []DutyItemSerializer
+}
+
+// DutyItemSerializer is used to serialize one item of duty
+// Connection is set only for trips
+type DutyItemSerializer struct {
+	Type       string
+	StartTime  string
+	EndTime    string
+	FromStop   string
+	ToStop     string
+	Minutes    int
+	Connection *ConnectionSerializer
+}
+
+// DutySheetSerializer is used to serialize duties of driver
+// it is used in GET request to get duty sheet of driver
+type DutySheetSerializer struct {
+	DriverID   uint
+	DriverName string
+	Duties     []DutySerializer
+}
+
+// DutyActivity is trip or deadhead leg of duty
+type DutyActivity struct {
+	Type       string
+	Start      time.Time
+	End        time.Time
+	FromStop   string
+	ToStop     string
+	Connection *models.Connection
+}
+
+// Valid checks if duty data for creating are valid
+// activities must not overlap, fit between sign-on and sign-off
+// and vehicle has to be moved between stops by trips or deadhead legs starting and ending in depot
+func (d *DutyCreateSerializer) Valid() bool {
+	validators.Stop_name_validator(d.DepotName, &d.ValidatorErrs)
+	sign_on, sign_off := validators.Duty_times_validator(d.SignOn, d.SignOff, &d.ValidatorErrs)
+	if len(d.ConnectionIDs) == 0 {
+		d.ValidatorErrs = append(d.ValidatorErrs, validators.ValidatorErr{Name: "DutyErr", Desc: "Duty has to contain at least one connection"})
+	}
+	for _, deadhead := range d.Deadheads {
+		validators.Stop_name_validator(deadhead.FromStop, &d.ValidatorErrs)
+		validators.Stop_name_validator(deadhead.ToStop, &d.ValidatorErrs)
+		validators.Duty_times_validator(deadhead.DepartureTime, deadhead.ArrivalTime, &d.ValidatorErrs)
+	}
+	if len(d.ValidatorErrs) != 0 {
+		return false
+	}
+
+	res := utils.DB.Order("departure_time").Find(&d.connections, "id IN ?", d.ConnectionIDs)
+	if res.Error != nil {
+		d.ValidatorErrs = append(d.ValidatorErrs, validators.ValidatorErr{Name: "DatabaseErr", Desc: res.Error.Error()})
+		return false
+	}
+	if len(d.connections) != len(d.ConnectionIDs) {
+		d.ValidatorErrs = append(d.ValidatorErrs, validators.ValidatorErr{Name: "DutyErr", Desc: "Some connections do not exist or are given more than once"})
+		return false
+	}
+	for _, connection := range d.connections {
+		if connection.DutyID != nil {
+			d.ValidatorErrs = append(d.ValidatorErrs, validators.ValidatorErr{Name: "DutyErr", Desc: fmt.Sprintf("Connection %d is already part of duty %d", connection.ID, *connection.DutyID)})
+		}
+		if connection.Status == models.CancelledConnection || connection.Status == models.CompletedConnection {
+			d.ValidatorErrs = append(d.ValidatorErrs, validators.ValidatorErr{Name: "DutyErr", Desc: fmt.Sprintf("Connection %d is %s", connection.ID, connection.Status)})
+		}
+	}
+	if len(d.ValidatorErrs) != 0 {
+		return false
+	}
+
+	activities, err := Duty_activities(d.connections, d.deadheads())
+	if err != nil {
+		d.ValidatorErrs = append(d.ValidatorErrs, validators.ValidatorErr{Name: "DatabaseErr", Desc: err.Error()})
+		return false
+	}
+	location := d.DepotName
+	previous_end := sign_on
+	for _, activity := range activities {
+		if activity.Start.Before(previous_end) {
+			d.ValidatorErrs = append(d.ValidatorErrs, validators.ValidatorErr{Name: "DutyErr", Desc: fmt.Sprintf("%s at %s starts before sign-on or previous item ends", activity.Type, activity.Start.Format("2006-01-02 15:04"))})
+			return false
+		}
+		if activity.FromStop != location {
+			d.ValidatorErrs = append(d.ValidatorErrs, validators.ValidatorErr{Name: "DutyContinuityErr", Desc: fmt.Sprintf("%s at %s starts in %s but vehicle is in %s, add deadhead leg", activity.Type, activity.Start.Format("2006-01-02 15:04"), activity.FromStop, location)})
+			return false
+		}
+		location = activity.ToStop
+		previous_end = activity.End
+	}
+	if previous_end.After(sign_off) {
+		d.ValidatorErrs = append(d.ValidatorErrs, validators.ValidatorErr{Name: "DutyErr", Desc: "Last item of duty ends after sign-off"})
+		return false
+	}
+	if location != d.DepotName {
+		d.ValidatorErrs = append(d.ValidatorErrs, validators.ValidatorErr{Name: "DutyContinuityErr", Desc: fmt.Sprintf("Duty ends in %s instead of depot, add deadhead leg", location)})
+		return false
+	}
+
+	assign := DutyAssignSerializer{DriverID: d.DriverID, VehicleReg: d.VehicleReg}
+	if !assign.Valid(&models.Duty{SignOn: sign_on, SignOff: sign_off, Deadheads: d.deadheads()}, d.connections) {
+		d.ValidatorErrs = append(d.ValidatorErrs, assign.ValidatorErrs...)
+		return false
+	}
+	return true
+}
+
+// deadheads converts serialized deadhead legs into models
+func (d *DutyCreateSerializer) deadheads() []models.DeadheadLeg {
+	deadheads := []models.DeadheadLeg{}
+	for _, deadhead := range d.Deadheads {
+		departure, _ := time.Parse("2006-01-02 15:04", deadhead.DepartureTime)
+		arrival, _ := time.Parse("2006-01-02 15:04", deadhead.ArrivalTime)
+		deadheads = append(deadheads, models.DeadheadLeg{
+			FromStopName:  deadhead.FromStop,
+			ToStopName:    deadhead.ToStop,
+			DepartureTime: departure,
+			ArrivalTime:   arrival,
+		})
+	}
+	return deadheads
+}
+
+// Create creates duty with its deadhead legs and moves connections into it in one transaction
+// connections get driver and vehicle of duty
+// Valid has to be called before
+func (d *DutyCreateSerializer) Create() (*models.Duty, error) {
+	sign_on, _ := time.Parse("2006-01-02 15:04", d.SignOn)
+	sign_off, _ := time.Parse("2006-01-02 15:04", d.SignOff)
+	duty := &models.Duty{
+		DepotName:           d.DepotName,
+		SignOn:              sign_on,
+		SignOff:             sign_off,
+		DriverID:            d.DriverID,
+		VehicleRegistration: d.VehicleReg,
+		Deadheads:           d.deadheads(),
+	}
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(duty).Error; err != nil {
+			return err
+		}
+		return Assign_duty(tx, duty, d.connections)
+	})
+	return duty, err
+}
+
+// Assign_duty moves connections into duty and assigns them driver and vehicle of duty
+func Assign_duty(tx *gorm.DB, duty *models.Duty, connections []models.Connection) error {
+	for i := range connections {
+		connections[i].DutyID = &duty.ID
+		connections[i].DriverID = duty.DriverID
+		connections[i].VehicleRegistration = duty.VehicleRegistration
+		res := tx.Model(&connections[i]).Select("DutyID", "DriverID", "VehicleRegistration").Updates(&connections[i])
+		if res.Error != nil {
+			return res.Error
+		}
+	}
+	duty.Connections = connections
+	return nil
+}
+
+// Valid checks if driver and vehicle can be assigned to all connections of duty
+// duty must not overlap other duties of driver or vehicle, deadhead legs of duty count into working time of driver
+func (d *DutyAssignSerializer) Valid(duty *models.Duty, connections []models.Connection) bool {
+	validators.Driver_id_validator(d.DriverID, &d.ValidatorErrs)
+	validators.Vehicle_registration_validator(d.VehicleReg, &d.ValidatorErrs)
+	if len(d.ValidatorErrs) != 0 {
+		return false
+	}
+	validators.Duty_overlap_validator(duty.ID, d.DriverID, d.VehicleReg, duty.SignOn, duty.SignOff, &d.ValidatorErrs)
+	validators.Vehicle_maintenance_validator(d.VehicleReg, &d.ValidatorErrs)
+	validators.Absence_validator(d.DriverID, duty.SignOn, duty.SignOff, &d.ValidatorErrs)
+	trips := []validators.WorkingTrip{}
+	for _, connection := range connections {
+		departure := connection.DepartureTime.Format("2006-01-02 15:04")
+		validators.Line_vehicle_validator(connection.LineName, d.VehicleReg, &d.ValidatorErrs)
+		validators.Driver_availability(int(connection.ID), d.DriverID, departure, connection.ArrivalTime, 1, &d.ValidatorErrs)
+		validators.Driver_qualification_validator(d.DriverID, d.VehicleReg, connection.LineName, connection.DepartureTime, connection.ArrivalTime, &d.ValidatorErrs)
+		validators.Vehicle_availability(int(connection.ID), d.VehicleReg, departure, connection.ArrivalTime, 1, &d.ValidatorErrs)
+		if len(d.ValidatorErrs) != 0 {
+			return false
+		}
+		if connection.Status != models.CancelledConnection {
+			trips = append(trips, validators.WorkingTrip{ConnectionID: connection.ID, Departure: connection.DepartureTime, Arrival: connection.ArrivalTime})
+		}
+	}
+	for _, deadhead := range duty.Deadheads {
+		trips = append(trips, validators.WorkingTrip{Departure: deadhead.DepartureTime, Arrival: deadhead.ArrivalTime})
+	}
+	validators.Driver_working_time(d.DriverID, trips, &d.ValidatorErrs)
+	return len(d.ValidatorErrs) == 0
+}
+
+// Duty_activities orders trips of connections and deadhead legs of duty by time
+// trips start in initial stop of connection and end in its final stop
+func Duty_activities(connections []models.Connection, deadheads []models.DeadheadLeg) ([]DutyActivity, error) {
+	activities := []DutyActivity{}
+	for i := range connections {
+		stops, err := Get_connection_stops(connections[i].LineName, connections[i].Direction, connections[i].DepartureTime)
+		if err != nil {
+			return nil, err
+		}
+		if len(stops) == 0 {
+			continue
+		}
+		activities = append(activities, DutyActivity{
+			Type:       TripItem,
+			Start:      connections[i].DepartureTime,
+			End:        connections[i].ArrivalTime,
+			FromStop:   stops[0].StopName,
+			ToStop:     stops[len(stops)-1].StopName,
+			Connection: &connections[i],
+		})
+	}
+	for _, deadhead := range deadheads {
+		activities = append(activities, DutyActivity{
+			Type:     DeadheadItem,
+			Start:    deadhead.DepartureTime,
+			End:      deadhead.ArrivalTime,
+			FromStop: deadhead.FromStopName,
+			ToStop:   deadhead.ToStopName,
+		})
+	}
+	sort.SliceStable(activities, func(i, j int) bool {
+		return activities[i].Start.Before(activities[j].Start)
+	})
+	return activities, nil
+}
+
+// Duty_items creates items of duty from its activities, trips get serialized connections by their id
+// gaps between activities are breaks, sign-on and sign-off are added when duty has depot
+func Duty_items(activities []DutyActivity, trips map[uint]*ConnectionSerializer, depot string, sign_on time.Time, sign_off time.Time) []DutyItemSerializer {
+	items := []DutyItemSerializer{}
+	item := func(item_type string, start time.Time, end time.Time, from string, to string) DutyItemSerializer {
+		return DutyItemSerializer{
+			Type:      item_type,
+			StartTime: start.Format("2006-01-02 15:04"),
+			EndTime:   end.Format("2006-01-02 15:04"),
+			FromStop:  from,
+			ToStop:    to,
+			Minutes:   int(end.Sub(start).Minutes()),
+		}
+	}
+	location := depot
+	previous_end := sign_on
+	if depot != "" {
+		items = append(items, item(SignOnItem, sign_on, sign_on, depot, depot))
+	}
+	for i, activity := range activities {
+		if (i > 0 || depot != "") && activity.Start.After(previous_end) {
+			items = append(items, item(BreakItem, previous_end, activity.Start, location, location))
+		}
+		activity_item := item(activity.Type, activity.Start, activity.End, activity.FromStop, activity.ToStop)
+		if activity.Connection != nil {
+			activity_item.Connection = trips[activity.Connection.ID]
+		}
+		items = append(items, activity_item)
+		location = activity.ToStop
+		previous_end = activity.End
+	}
+	if depot != "" {
+		if sign_off.After(previous_end) {
+			items = append(items, item(BreakItem, previous_end, sign_off, location, location))
+		}
+		items = append(items, item(SignOffItem, sign_off, sign_off, depot, depot))
+	}
+	return items
+}
@@ -0,0 +1,157 @@
+// package serializers holds structures and functions for serializing data
+// this file contains GeoJSON serializers of stops and lines and search of nearest stops
+package serializers
+
+import (
+	"math"
+	"sort"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// earth_radius is mean radius of Earth in meters used for distances between stops
+const earth_radius = 6371000.0
+
+// GeoJSONFeatureCollection is used to serialize stops or lines as GeoJSON (RFC 7946)
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSONFeature is one stop or one direction of line
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONGeometry is point of stop or line string of line, coordinates are longitude and latitude
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// NearestStopSerializer is used to serialize stop with its distance from searched place
+type NearestStopSerializer struct {
+	StopSerializer
+	DistanceMeters float64
+}
+
+// Stops_geojson creates feature collection of points of stops, stops without coordinates are left out
+func Stops_geojson(stops []models.Stop) GeoJSONFeatureCollection {
+	collection := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []GeoJSONFeature{}}
+	for _, stop := range stops {
+		if stop.Latitude == nil || stop.Longitude == nil {
+			continue
+		}
+		collection.Features = append(collection.Features, GeoJSONFeature{
+			Type: "Feature",
+			Geometry: GeoJSONGeometry{
+				Type:        "Point",
+				Coordinates: []float64{*stop.Longitude, *stop.Latitude},
+			},
+			Properties: map[string]interface{}{
+				"ID":         stop.ID,
+				"Name":       stop.Name,
+				"Platform":   stop.Platform,
+				"Accessible": stop.Accessible,
+				"Zone":       stop.Zone,
+				"ParentID":   stop.ParentID,
+			},
+		})
+	}
+	return collection
+}
+
+// Lines_geojson creates line string of each direction of lines from their ordered segments
+// reverse direction of line without its own segments is the same and is left out,
+// stops without coordinates are skipped and listed in property MissingStops
+func Lines_geojson(lines []models.Line, stops []models.Stop) GeoJSONFeatureCollection {
+	stops_by_name := map[string]models.Stop{}
+	for _, stop := range stops {
+		stops_by_name[stop.Name] = stop
+	}
+	collection := GeoJSONFeatureCollection{Type: "FeatureCollection", Features: []GeoJSONFeature{}}
+	for _, line := range lines {
+		directions := []bool{false}
+		if Has_reverse_segments(line.Segments) {
+			directions = append(directions, true)
+		}
+		for _, direction := range directions {
+			line_stops := Line_stops(line.Segments, direction)
+			if len(line_stops) == 0 {
+				continue
+			}
+			coordinates := [][]float64{}
+			stop_names := []string{}
+			missing_stops := []string{}
+			for _, line_stop := range line_stops {
+				stop_names = append(stop_names, line_stop.StopName)
+				stop := stops_by_name[line_stop.StopName]
+				if stop.Latitude == nil || stop.Longitude == nil {
+					missing_stops = append(missing_stops, line_stop.StopName)
+					continue
+				}
+				coordinates = append(coordinates, []float64{*stop.Longitude, *stop.Latitude})
+			}
+			collection.Features = append(collection.Features, GeoJSONFeature{
+				Type: "Feature",
+				Geometry: GeoJSONGeometry{
+					Type:        "LineString",
+					Coordinates: coordinates,
+				},
+				Properties: map[string]interface{}{
+					"Line":         line.Name,
+					"Direction":    direction,
+					"Stops":        stop_names,
+					"MissingStops": missing_stops,
+				},
+			})
+		}
+	}
+	return collection
+}
+
+// Nearest_stops finds at most limit stops closest to given place ordered by distance
+// radius in meters limits distance of stops, zero radius means no limit
+func Nearest_stops(latitude float64, longitude float64, limit int, radius float64) ([]NearestStopSerializer, error) {
+	var stops []models.Stop
+	if res := utils.DB.Where("latitude IS NOT NULL AND longitude IS NOT NULL").Find(&stops); res.Error != nil {
+		return nil, res.Error
+	}
+	distances := make([]float64, len(stops))
+	for i, stop := range stops {
+		distances[i] = Distance_meters(latitude, longitude, *stop.Latitude, *stop.Longitude)
+	}
+	order := make([]int, len(stops))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return distances[order[i]] < distances[order[j]]
+	})
+
+	nearest := []NearestStopSerializer{}
+	for _, i := range order {
+		if len(nearest) == limit || (radius > 0 && distances[i] > radius) {
+			break
+		}
+		stop := NearestStopSerializer{DistanceMeters: math.Round(distances[i])}
+		if err := stop.FromModel(stops[i]); err != nil {
+			return nil, err
+		}
+		nearest = append(nearest, stop)
+	}
+	return nearest, nil
+}
+
+// Distance_meters calculates great-circle distance between two places by haversine formula
+func Distance_meters(latitude1 float64, longitude1 float64, latitude2 float64, longitude2 float64) float64 {
+	radians := math.Pi / 180
+	d_latitude := (latitude2 - latitude1) * radians
+	d_longitude := (longitude2 - longitude1) * radians
+	a := math.Sin(d_latitude/2)*math.Sin(d_latitude/2) +
+		math.Cos(latitude1*radians)*math.Cos(latitude2*radians)*math.Sin(d_longitude/2)*math.Sin(d_longitude/2)
+	return 2 * earth_radius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
@@ -0,0 +1,146 @@
+// package serializers contains serializers used for serializing data
+// this file contains storing and URLs of vehicle photos and vehicle type icons
+package serializers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/images"
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/storage"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// image_size is largest size of stored image and of its thumbnail, encode selects format of both
+type image_size struct {
+	width, height             int
+	thumb_width, thumb_height int
+	extension                 string
+	content_type              string
+	encode                    func(image.Image) ([]byte, error)
+}
+
+var (
+	vehicle_image_size = image_size{1600, 1200, 320, 240, ".jpg", "image/jpeg", images.EncodeJPEG}
+	vehicle_icon_size  = image_size{128, 128, 32, 32, ".png", "image/png", images.EncodePNG}
+)
+
+// Save_vehicle_image stores photo of vehicle with its thumbnail and replaces previous photo
+func Save_vehicle_image(vehicle *models.Vehicle, data []byte) error {
+	key, err := store_image("vehicles", data, vehicle_image_size)
+	if err != nil {
+		return err
+	}
+	previous, now := vehicle.ImageKey, time.Now()
+	result := utils.DB.Model(vehicle).Updates(map[string]interface{}{"image_key": key, "image_updated_at": now})
+	if result.Error != nil {
+		Remove_image(&key)
+		return result.Error
+	}
+	vehicle.ImageKey, vehicle.ImageUpdatedAt = &key, &now
+	Remove_image(previous)
+	return nil
+}
+
+// Save_vehicle_type_icon stores icon of vehicle type with its thumbnail and replaces previous icon
+func Save_vehicle_type_icon(vehicle_type *models.VehicleType, data []byte) error {
+	key, err := store_image("vehicle-types", data, vehicle_icon_size)
+	if err != nil {
+		return err
+	}
+	previous, now := vehicle_type.IconKey, time.Now()
+	result := utils.DB.Model(vehicle_type).Updates(map[string]interface{}{"icon_key": key, "icon_updated_at": now})
+	if result.Error != nil {
+		Remove_image(&key)
+		return result.Error
+	}
+	vehicle_type.IconKey, vehicle_type.IconUpdatedAt = &key, &now
+	Remove_image(previous)
+	return nil
+}
+
+// Remove_image removes image and its thumbnail from storage, failures are only logged
+func Remove_image(key *string) {
+	if key == nil {
+		return
+	}
+	files, err := storage.Default()
+	if err != nil {
+		log.Printf("image %s not removed: %v", *key, err)
+		return
+	}
+	for _, object := range []string{*key, images.Thumbnail_key(*key)} {
+		if err := files.DeleteObject(object); err != nil {
+			log.Printf("image %s not removed: %v", object, err)
+		}
+	}
+}
+
+// Vehicle_image_url returns public URL of photo of vehicle or its thumbnail, nil when vehicle has no photo
+func Vehicle_image_url(vehicle *models.Vehicle, thumbnail bool) *string {
+	if vehicle.ImageKey == nil {
+		return nil
+	}
+	return image_url("/api/vehicles/image/"+url.PathEscape(vehicle.Registration), vehicle.ImageUpdatedAt, thumbnail)
+}
+
+// Vehicle_type_icon_url returns public URL of icon of vehicle type or its thumbnail, nil when type has no icon
+func Vehicle_type_icon_url(vehicle_type *models.VehicleType, thumbnail bool) *string {
+	if vehicle_type.IconKey == nil {
+		return nil
+	}
+	return image_url("/api/vehicletypes/icon/"+url.PathEscape(vehicle_type.Type), vehicle_type.IconUpdatedAt, thumbnail)
+}
+
+// image_url adds version to URL of image, so it can be cached until image is replaced
+func image_url(path string, updated_at *time.Time, thumbnail bool) *string {
+	version := int64(0)
+	if updated_at != nil {
+		version = updated_at.Unix()
+	}
+	result := fmt.Sprintf("%s?v=%d", path, version)
+	if thumbnail {
+		result += "&size=thumb"
+	}
+	return &result
+}
+
+// store_image scales image down to its size and thumbnail size and puts both into storage under prefix
+func store_image(prefix string, data []byte, size image_size) (string, error) {
+	img, err := images.Decode(data)
+	if err != nil {
+		return "", err
+	}
+	full, err := size.encode(images.Fit(img, size.width, size.height))
+	if err != nil {
+		return "", err
+	}
+	thumbnail, err := size.encode(images.Fit(img, size.thumb_width, size.thumb_height))
+	if err != nil {
+		return "", err
+	}
+	files, err := storage.Default()
+	if err != nil {
+		return "", err
+	}
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	key := prefix + "/" + hex.EncodeToString(random) + size.extension
+	if err := files.PutObject(key, bytes.NewReader(full), int64(len(full)), size.content_type); err != nil {
+		return "", err
+	}
+	if err := files.PutObject(images.Thumbnail_key(key), bytes.NewReader(thumbnail), int64(len(thumbnail)), size.content_type); err != nil {
+		files.DeleteObject(key)
+		return "", err
+	}
+	return key, nil
+}
@@ -3,8 +3,12 @@
 package serializers
 
 import (
+	"time"
+
 	"github.com/AdamPekny/IIS/backend/models"
 	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+	"gorm.io/gorm"
 )
 
 // LineInList is used to serialize data about line
@@ -17,58 +21,279 @@ type LineInList struct {
 
 // LineSerializer is used to serialize data about line
 // it is used in GET request to get data about line
+// ReverseStopsSequence is empty for lines driven the same way in both directions
+// empty VehicleTypes allow vehicles of any type
 type LineSerializer struct {
-	Name          string
-	StopsSequence []CreateSeqStops
+	Name                 string
+	StopsSequence        []CreateSeqStops
+	ReverseStopsSequence []CreateSeqStops
+	MinCapacity          uint
+	VehicleTypes         []string
 }
 
 // LineCreateSerializer is used to serialize data about line
 // it is used in POST request to create a new line
+// ReverseStopsSequence is optional sequence from final to initial stop,
+// without it connections in reverse direction use StopsSequence backwards
+// only vehicles of VehicleTypes with at least MinCapacity can operate line, without VehicleTypes any type can
 type LineCreateSerializer struct {
-	Name          string `binding:"required"`
-	StopsSequence []CreateSeqStops
+	Name                 string `binding:"required"`
+	StopsSequence        []CreateSeqStops
+	ReverseStopsSequence []CreateSeqStops
+	MinCapacity          uint
+	VehicleTypes         []string
+	ValidatorErrs        []validators.ValidatorErr
 }
 
 // CreateSeqStops is used to serialize stops in line
 // it is used in POST request to create line segments
+// Duration is travel time to next stop, DwellTime is time spent in stop
+// dwell time of initial and final stop is ignored
 type CreateSeqStops struct {
-	StopName string `binding:"required"`
-	Duration uint   `binding:"required"`
+	StopName  string `binding:"required"`
+	Duration  uint   `binding:"required"`
+	DwellTime uint
+}
+
+// LineStop holds stop of line with its arrival and departure offset from departure of connection
+type LineStop struct {
+	StopName  string
+	Arrival   time.Duration
+	Departure time.Duration
 }
 
 // LineUpdateSerializer is used to serialize stops for line update
 // it is used in PATCH request to update line segments
+// MinCapacity and VehicleTypes are kept when not given, empty VehicleTypes allow any type
 type LineUpdateSerializer struct {
-	StopsSequence []CreateSeqStops
+	StopsSequence        []CreateSeqStops
+	ReverseStopsSequence []CreateSeqStops
+	MinCapacity          *uint
+	VehicleTypes         *[]string
+	ValidatorErrs        []validators.ValidatorErr
 }
 
-// GetStops gets serializes stops for line
+// GetStops gets serializes stops and allowed vehicles for line
 func (line_s *LineSerializer) GetStops(line_name string) error {
-	var line models.Line
-	if err := utils.DB.Model(&line).Preload("Segments").First(&line, "Name = ?", line_name).Error; err != nil {
+	line, err := Get_line(line_name)
+	if err != nil {
 		return err
 	}
-	for i := 0; i < len(line.Segments); i++ {
-		if line.Segments[i].StopName2 == line.FinalStop {
-			line_s.StopsSequence = append(line_s.StopsSequence, CreateSeqStops{
-				StopName: line.Segments[i].StopName1,
-				Duration: line.Segments[i].Time,
-			})
-			line_s.StopsSequence = append(line_s.StopsSequence, CreateSeqStops{
-				StopName: line.Segments[i].StopName2,
-				Duration: 0,
-			})
-			break
-		}
-		line_s.StopsSequence = append(line_s.StopsSequence, CreateSeqStops{
-			StopName: line.Segments[i].StopName1,
-			Duration: line.Segments[i].Time,
-		})
+	var vehicle_types []models.VehicleType
+	if err := utils.DB.Model(&line).Association("VehicleTypes").Find(&vehicle_types); err != nil {
+		return err
+	}
+	line_s.MinCapacity = line.MinCapacity
+	line_s.VehicleTypes = []string{}
+	for _, vehicle_type := range vehicle_types {
+		line_s.VehicleTypes = append(line_s.VehicleTypes, vehicle_type.Type)
+	}
+	line_s.StopsSequence = sequence_stops(Direction_segments(line.Segments, false))
+	if Has_reverse_segments(line.Segments) {
+		line_s.ReverseStopsSequence = sequence_stops(Direction_segments(line.Segments, true))
+	}
+	return nil
+}
+
+// Valid checks if stop sequences and vehicle types of new line are valid
+func (line_s *LineCreateSerializer) Valid() bool {
+	validators.Line_sequence_validator(sequence_names(line_s.StopsSequence), sequence_names(line_s.ReverseStopsSequence), &line_s.ValidatorErrs)
+	validators.Line_stations_validator(append(sequence_names(line_s.StopsSequence), sequence_names(line_s.ReverseStopsSequence)...), &line_s.ValidatorErrs)
+	validators.Line_vehicle_types_validator(line_s.VehicleTypes, &line_s.ValidatorErrs)
+	return len(line_s.ValidatorErrs) == 0
+}
+
+// Segments creates ordered segments of new line in both directions
+func (line_s *LineCreateSerializer) Segments() []models.Segment {
+	return line_direction_segments(line_s.Name, line_s.StopsSequence, line_s.ReverseStopsSequence)
+}
+
+// Valid checks if updated stop sequences and vehicle types of line are valid
+func (line_s *LineUpdateSerializer) Valid() bool {
+	validators.Line_sequence_validator(sequence_names(line_s.StopsSequence), sequence_names(line_s.ReverseStopsSequence), &line_s.ValidatorErrs)
+	validators.Line_stations_validator(append(sequence_names(line_s.StopsSequence), sequence_names(line_s.ReverseStopsSequence)...), &line_s.ValidatorErrs)
+	if line_s.VehicleTypes != nil {
+		validators.Line_vehicle_types_validator(*line_s.VehicleTypes, &line_s.ValidatorErrs)
+	}
+	return len(line_s.ValidatorErrs) == 0
+}
 
+// UpdateVehicles loads allowed vehicles into line model
+// vehicle types are replaced only when given
+func (line_s *LineUpdateSerializer) UpdateVehicles(line *models.Line) error {
+	if line_s.MinCapacity != nil {
+		line.MinCapacity = *line_s.MinCapacity
+	}
+	if line_s.VehicleTypes == nil {
+		return nil
+	}
+	vehicle_types, err := Get_vehicle_types(*line_s.VehicleTypes)
+	if err != nil {
+		return err
 	}
+	line.VehicleTypes = vehicle_types
 	return nil
 }
 
+// Get_vehicle_types loads vehicle types with given names
+func Get_vehicle_types(names []string) (vehicle_types []models.VehicleType, err error) {
+	vehicle_types = []models.VehicleType{}
+	if len(names) == 0 {
+		return
+	}
+	err = utils.DB.Where("type IN ?", names).Find(&vehicle_types).Error
+	return
+}
+
+// Segments creates ordered segments of updated line in both directions
+func (line_s *LineUpdateSerializer) Segments(line_name string) []models.Segment {
+	return line_direction_segments(line_name, line_s.StopsSequence, line_s.ReverseStopsSequence)
+}
+
+// line_direction_segments creates segments of line from forward and optional reverse sequence
+func line_direction_segments(line_name string, stops []CreateSeqStops, reverse_stops []CreateSeqStops) []models.Segment {
+	segments := Line_segments(line_name, stops, false)
+	if len(reverse_stops) != 0 {
+		segments = append(segments, Line_segments(line_name, reverse_stops, true)...)
+	}
+	return segments
+}
+
+// sequence_names returns names of stops in sequence
+func sequence_names(stops []CreateSeqStops) []string {
+	names := []string{}
+	for _, stop := range stops {
+		names = append(names, stop.StopName)
+	}
+	return names
+}
+
+// sequence_stops converts ordered segments of one direction back into sequence of stops
+func sequence_stops(segments []models.Segment) []CreateSeqStops {
+	stops := []CreateSeqStops{}
+	if len(segments) == 0 {
+		return stops
+	}
+	for i, segment := range segments {
+		stop := CreateSeqStops{
+			StopName: segment.StopName1,
+			Duration: segment.Time,
+		}
+		if i > 0 {
+			stop.DwellTime = segments[i-1].DwellTime
+		}
+		stops = append(stops, stop)
+	}
+	return append(stops, CreateSeqStops{
+		StopName: segments[len(segments)-1].StopName2,
+		Duration: 0,
+	})
+}
+
+// Get_line loads line with its segments ordered by sequence
+func Get_line(line_name string) (line models.Line, err error) {
+	err = utils.DB.Preload("Segments", func(db *gorm.DB) *gorm.DB {
+		return db.Order("direction, sequence, id")
+	}).First(&line, "name = ?", line_name).Error
+	return
+}
+
+// Line_segments creates ordered segments of line in given direction from sequence of its stops
+func Line_segments(line_name string, stops []CreateSeqStops, direction bool) []models.Segment {
+	segments := []models.Segment{}
+	for i := 0; i < len(stops)-1; i++ {
+		segment := models.Segment{
+			Sequence:  uint(i + 1),
+			Direction: direction,
+			StopName1: stops[i].StopName,
+			StopName2: stops[i+1].StopName,
+			Time:      stops[i].Duration,
+			LineName:  line_name,
+		}
+		if i+1 < len(stops)-1 {
+			segment.DwellTime = stops[i+1].DwellTime
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// Has_reverse_segments checks if line has own segments for reverse direction
+func Has_reverse_segments(segments []models.Segment) bool {
+	for _, segment := range segments {
+		if segment.Direction {
+			return true
+		}
+	}
+	return false
+}
+
+// Direction_segments returns ordered segments of line defined for given direction
+// for reverse direction of symmetric line segments of forward direction are returned
+func Direction_segments(segments []models.Segment, direction bool) []models.Segment {
+	if direction && !Has_reverse_segments(segments) {
+		direction = false
+	}
+	direction_segments := []models.Segment{}
+	for _, segment := range segments {
+		if segment.Direction == direction {
+			direction_segments = append(direction_segments, segment)
+		}
+	}
+	return direction_segments
+}
+
+// Line_stops calculates arrival and departure offsets of stops of line in given direction
+// segments have to be ordered by sequence, dwell time is applied only in intermediate stops
+// reverse direction uses its own segments or segments of forward direction backwards
+func Line_stops(segments []models.Segment, direction bool) []LineStop {
+	stops := []LineStop{}
+	if direction && Has_reverse_segments(segments) {
+		segments = Direction_segments(segments, true)
+		direction = false
+	} else {
+		segments = Direction_segments(segments, false)
+	}
+	if len(segments) == 0 {
+		return stops
+	}
+	var offset time.Duration
+	if !direction {
+		stops = append(stops, LineStop{StopName: segments[0].StopName1})
+		for i, segment := range segments {
+			offset += time.Minute * time.Duration(segment.Time)
+			stop := LineStop{StopName: segment.StopName2, Arrival: offset}
+			if i < len(segments)-1 {
+				offset += time.Minute * time.Duration(segment.DwellTime)
+			}
+			stop.Departure = offset
+			stops = append(stops, stop)
+		}
+		return stops
+	}
+	// forward segments driven backwards
+	stops = append(stops, LineStop{StopName: segments[len(segments)-1].StopName2})
+	for i := len(segments) - 1; i >= 0; i-- {
+		offset += time.Minute * time.Duration(segments[i].Time)
+		stop := LineStop{StopName: segments[i].StopName1, Arrival: offset}
+		if i > 0 {
+			offset += time.Minute * time.Duration(segments[i-1].DwellTime)
+		}
+		stop.Departure = offset
+		stops = append(stops, stop)
+	}
+	return stops
+}
+
+// Line_duration calculates time from departure to arrival of connection on line in given direction
+func Line_duration(segments []models.Segment, direction bool) time.Duration {
+	stops := Line_stops(segments, direction)
+	if len(stops) == 0 {
+		return 0
+	}
+	return stops[len(stops)-1].Arrival
+}
+
 // FromModel loads data from model into serializer
 func (l *LineInList) FromModel(line models.Line) {
 	l.Name = line.Name
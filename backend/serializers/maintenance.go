@@ -7,6 +7,7 @@ import (
 	"github.com/AdamPekny/IIS/backend/utils"
 	"github.com/AdamPekny/IIS/backend/validators"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 
@@ -38,6 +39,7 @@ type MalfuncRepPublicSerialzier struct {
 	CreatedBy *UserMaintenanceSerializer `binding:"required"`
 	Vehicle *VehicleMaintenanceSerializer `binding:"required"`
 	CreatedAt time.Time
+	Attachments []AttachmentSerializer // photos of malfunction with signed download URLs
 }
 
 func (m *MalfuncRepPublicSerialzier) FromModel(malfunc_report *models.MalfunctionReport) (err error) {
@@ -53,6 +55,10 @@ func (m *MalfuncRepPublicSerialzier) FromModel(malfunc_report *models.Malfunctio
 
 	m.Acknowledged = len(mainten_req_models) > 0
 
+	if m.Attachments, err = Attachments_of("malfunc_rep_ref", m.ID); err != nil {
+		return err
+	}
+
 	created_by_serializer := &UserMaintenanceSerializer{}
 
 	if malfunc_report.CreatedBy == nil {
@@ -131,7 +137,8 @@ func (m *MalfuncRepShortPublicSerialzier) FromModel(malfunc_report *models.Malfu
 type MaintenReqCreateSerializer struct {
 	Status models.Status
 	Deadline utils.CustomDate
-	MalfuncRepRef *uint `binding:"required"`
+	MalfuncRepRef *uint
+	VehicleRef *string // required for preventive maintenance without malfunction report
 	CreatedByRef *uint
 	ResolvedByRef *uint
 	ValidatorErrs []validators.ValidatorErr
@@ -139,6 +146,11 @@ type MaintenReqCreateSerializer struct {
 
 func (m *MaintenReqCreateSerializer) Valid() bool {
 	validators.StatusValidator(string(m.Status), &m.ValidatorErrs)
+	// new request always starts as pending, later changes are recorded in its history
+	if m.Status != "" && m.Status != models.PendingStatus {
+		m.ValidatorErrs = append(m.ValidatorErrs, validators.ValidatorErr{Name: "StatusErr", Desc: "New maintenance request has to be pending!"})
+	}
+	validators.Maintenance_subject_validator(m.MalfuncRepRef, m.VehicleRef, &m.ValidatorErrs)
 	if m.Deadline.Time != nil {
 		validators.DeadlineValidator(*m.Deadline.Time, &m.ValidatorErrs)
 	}
@@ -151,12 +163,17 @@ func (m *MaintenReqCreateSerializer) Valid() bool {
 
 func (m *MaintenReqCreateSerializer) ToModel(ctx *gin.Context) (*models.MaintenanceRequest, error) {
 	model := &models.MaintenanceRequest{
-		Status: m.Status,
+		Status: models.PendingStatus,
 		Deadline: m.Deadline.Time,
 		MalfuncRepRef: m.MalfuncRepRef,
+		VehicleRef: m.VehicleRef,
 		ResolvedByRef: m.ResolvedByRef,
 	}
 
+	if err := mainten_req_vehicle(model); err != nil {
+		return nil, err
+	}
+
 	user, err := models.GetUserFromCtx(ctx)
 	if err != nil {
 		return nil, err
@@ -172,7 +189,12 @@ type MaintenReqPublicSerializer struct {
 	Status models.Status `binding:"required"`
 	Deadline *time.Time `binding:"required"`
 	CreatedAt time.Time `binding:"required"`
-	MalfuncRep *MalfuncRepShortPublicSerialzier `binding:"required"`
+	Title string // title of malfunction report or maintenance plan
+	VehicleRef *string
+	VehicleType string
+	MalfuncRep *MalfuncRepShortPublicSerialzier // nil for preventive maintenance
+	MaintenPlanRef *uint
+	Mileage *float64
 	CreatedBy *UserMaintenanceSerializer `binding:"required"`
 	ResolvedBy *UserMaintenanceSerializer `binding:"required"`
 	ValidatorErrs []validators.ValidatorErr
@@ -189,14 +211,23 @@ func (m *MaintenReqPublicSerializer) FromModel(mainten_req_model *models.Mainten
 	m.Status = mainten_req_model.Status
 	m.Deadline = mainten_req_model.Deadline
 	m.CreatedAt = mainten_req_model.CreatedAt
-	
-	malfunc_rep_serializer := &MalfuncRepShortPublicSerialzier{}
+	m.VehicleRef = mainten_req_model.VehicleRef
+	m.MaintenPlanRef = mainten_req_model.MaintenPlanRef
+	m.Mileage = mainten_req_model.Mileage
 
-	if err := malfunc_rep_serializer.FromModel(mainten_req_model.MalfuncRep); err != nil {
+	if m.Title, m.VehicleType, err = mainten_req_subject(mainten_req_model); err != nil {
 		return err
 	}
 
-	m.MalfuncRep = malfunc_rep_serializer
+	if mainten_req_model.MalfuncRepRef != nil {
+		malfunc_rep_serializer := &MalfuncRepShortPublicSerialzier{}
+
+		if err := malfunc_rep_serializer.FromModel(mainten_req_model.MalfuncRep); err != nil {
+			return err
+		}
+
+		m.MalfuncRep = malfunc_rep_serializer
+	}
 
 	created_by_serializer := &UserMaintenanceSerializer{}
 
@@ -245,7 +276,11 @@ func (m *MaintenReqPublicSerializer) FromModel(mainten_req_model *models.Mainten
 type MaintenReqShortPublicSerializer struct {
 	ID uint `binding:"required"`
 	CreatedAt time.Time `binding:"required"`
-	MalfuncRep *MalfuncRepShortPublicSerialzier `binding:"required"`
+	Title string
+	VehicleRef *string
+	VehicleType string
+	MalfuncRep *MalfuncRepShortPublicSerialzier // nil for preventive maintenance
+	MaintenPlanRef *uint
 	CreatedBy *UserMaintenanceSerializer `binding:"required"`
 	ResolvedBy *UserMaintenanceSerializer
 	ValidatorErrs []validators.ValidatorErr
@@ -258,21 +293,22 @@ func (m *MaintenReqShortPublicSerializer) Valid() bool {
 func (m *MaintenReqShortPublicSerializer) FromModel(mainten_req_model *models.MaintenanceRequest) (err error) {
 	m.ID = mainten_req_model.ID
 	m.CreatedAt = mainten_req_model.CreatedAt
+	m.VehicleRef = mainten_req_model.VehicleRef
+	m.MaintenPlanRef = mainten_req_model.MaintenPlanRef
 
-	if mainten_req_model.MalfuncRep == nil {
-		mainten_req_model.MalfuncRep = &models.MalfunctionReport{} 
-		if result := utils.DB.First(mainten_req_model.MalfuncRep, mainten_req_model.MalfuncRepRef); result.Error != nil {
-			return result.Error
-		}
-	}
-	
-	malfunc_rep_serializer := &MalfuncRepShortPublicSerialzier{}
-
-	if err := malfunc_rep_serializer.FromModel(mainten_req_model.MalfuncRep); err != nil {
+	if m.Title, m.VehicleType, err = mainten_req_subject(mainten_req_model); err != nil {
 		return err
 	}
 
-	m.MalfuncRep = malfunc_rep_serializer
+	if mainten_req_model.MalfuncRepRef != nil {
+		malfunc_rep_serializer := &MalfuncRepShortPublicSerialzier{}
+
+		if err := malfunc_rep_serializer.FromModel(mainten_req_model.MalfuncRep); err != nil {
+			return err
+		}
+
+		m.MalfuncRep = malfunc_rep_serializer
+	}
 
 	created_by_serializer := &UserMaintenanceSerializer{}
 
@@ -321,10 +357,16 @@ func (m *MaintenReqShortPublicSerializer) FromModel(mainten_req_model *models.Ma
 type MaintenReqUpdateSerializer struct {
 	Status models.Status `binding:"required"`
 	Deadline utils.CustomDate
-	MalfuncRepRef *uint `binding:"required"`
+	MalfuncRepRef *uint // current malfunction report is kept when not given
 	CreatedByRef *uint
 	ResolvedByRef *uint
 	ValidatorErrs []validators.ValidatorErr
+	resolver_changed bool
+}
+
+// ResolverChanged reports if ToModel assigned request to other technician
+func (m *MaintenReqUpdateSerializer) ResolverChanged() bool {
+	return m.resolver_changed
 }
 
 func (m *MaintenReqUpdateSerializer) Valid() bool {
@@ -335,6 +377,7 @@ func (m *MaintenReqUpdateSerializer) Valid() bool {
 	if m.ResolvedByRef != nil {
 		validators.HasRoleValidator(*m.ResolvedByRef, &m.ValidatorErrs, models.TechnicianRole)
 	}
+	validators.Malfunction_report_validator(m.MalfuncRepRef, &m.ValidatorErrs)
 
 	return len(m.ValidatorErrs) == 0
 }
@@ -350,10 +393,18 @@ func (m *MaintenReqUpdateSerializer) ToModel(ctx *gin.Context) (*models.Maintena
 		return nil, result.Error
 	}
 
-	model.Status = m.Status
+	// status is changed only through MaintenReqStatusSerializer to keep its history
 	model.Deadline = m.Deadline.Time
-	model.MalfuncRepRef = m.MalfuncRepRef
+	m.resolver_changed = (model.ResolvedByRef == nil) != (m.ResolvedByRef == nil) ||
+		(m.ResolvedByRef != nil && *model.ResolvedByRef != *m.ResolvedByRef)
 	model.ResolvedByRef = m.ResolvedByRef
+	if m.MalfuncRepRef != nil {
+		model.MalfuncRepRef = m.MalfuncRepRef
+		model.MalfuncRep = nil
+		if err := mainten_req_vehicle(model); err != nil {
+			return nil, err
+		}
+	}
 
 	return model, nil
 }
@@ -376,7 +427,7 @@ func (m *MaintenReqAssignTechSerializer) ToModel(ctx *gin.Context) (*models.Main
 	}
 
 	model := &models.MaintenanceRequest{}
-	if result := utils.DB.Select("id").First(model, id); result.Error != nil {
+	if result := utils.DB.Select("id", "deadline").First(model, id); result.Error != nil {
 		return nil, result.Error
 	}
 
@@ -388,13 +439,14 @@ func (m *MaintenReqAssignTechSerializer) ToModel(ctx *gin.Context) (*models.Main
 type MaintenRepCreateSerializer struct {
 	Title string `binding:"required"`
 	Description string `binding:"required"`
-	Cost float64 
+	LabourHours float64
+	Items []ReportItemCreateSerializer // parts taken from stock, cost of report is derived from them and labour
 	MaintenReqRef *uint `binding:"required"`
 	ValidatorErrs []validators.ValidatorErr
 }
 
 func (m *MaintenRepCreateSerializer) Valid() bool {
-	validators.CostValidator(m.Cost, &m.ValidatorErrs)
+	Report_items_valid(m.LabourHours, m.Items, &m.ValidatorErrs)
 	validators.HasResolverValidator(m.MaintenReqRef, &m.ValidatorErrs)
 
 	return len(m.ValidatorErrs) == 0
@@ -404,7 +456,8 @@ func (m *MaintenRepCreateSerializer) ToModel() (*models.MaintenanceReport, error
 	model := &models.MaintenanceReport{
 		Title: m.Title,
 		Description: m.Description,
-		Cost: m.Cost,
+		LabourHours: m.LabourHours,
+		LabourRate: Maintenance_labour_rate(),
 		MaintenReqRef: m.MaintenReqRef,
 	}
 
@@ -416,6 +469,11 @@ type MaintenRepPublicSerializer struct {
 	Title string `binding:"required"`
 	Description string `binding:"required"`
 	Cost float64 `binding:"required"`
+	LabourHours float64
+	LabourRate float64
+	LegacyCost float64 // cost entered before it was derived from parts and labour
+	Items []ReportItemSerializer
+	Attachments []AttachmentSerializer // photos, invoices and documents with signed download URLs
 	CreatedAt time.Time `binding:"required"`
 	MaintenReq *MaintenReqShortPublicSerializer `binding:"required"`
 }
@@ -425,7 +483,28 @@ func (m *MaintenRepPublicSerializer) FromModel(mainten_rep_model *models.Mainten
 	m.Title = mainten_rep_model.Title
 	m.Description = mainten_rep_model.Description
 	m.Cost = mainten_rep_model.Cost
+	m.LabourHours = mainten_rep_model.LabourHours
+	m.LabourRate = mainten_rep_model.LabourRate
+	m.LegacyCost = mainten_rep_model.LegacyCost
 	m.CreatedAt = mainten_rep_model.CreatedAt
+
+	if mainten_rep_model.Items == nil {
+		if result := utils.DB.Preload("SparePart").Where("mainten_rep_ref = ?", mainten_rep_model.ID).Order("id").Find(&mainten_rep_model.Items); result.Error != nil {
+			return result.Error
+		}
+	}
+	if m.Attachments, err = Attachments_of("mainten_rep_ref", mainten_rep_model.ID); err != nil {
+		return err
+	}
+
+	m.Items = []ReportItemSerializer{}
+	for i := range mainten_rep_model.Items {
+		item := ReportItemSerializer{}
+		if err := item.FromModel(&mainten_rep_model.Items[i]); err != nil {
+			return err
+		}
+		m.Items = append(m.Items, item)
+	}
 	
 	mainten_req_serializer := &MaintenReqShortPublicSerializer{}
 
@@ -448,13 +527,14 @@ func (m *MaintenRepPublicSerializer) FromModel(mainten_rep_model *models.Mainten
 type MaintenRepUpdateSerializer struct {
 	Title string `binding:"required"`
 	Description string `binding:"required"`
-	Cost float64 
+	LabourHours float64
+	Items []ReportItemCreateSerializer // replaces parts used in report, previous ones are returned to stock
 	MaintenReqRef *uint `binding:"required"`
 	ValidatorErrs []validators.ValidatorErr
 }
 
 func (m *MaintenRepUpdateSerializer) Valid() bool {
-	validators.CostValidator(m.Cost, &m.ValidatorErrs)
+	Report_items_valid(m.LabourHours, m.Items, &m.ValidatorErrs)
 	validators.HasResolverValidator(m.MaintenReqRef, &m.ValidatorErrs)
 
 	return len(m.ValidatorErrs) == 0
@@ -474,8 +554,126 @@ func (m *MaintenRepUpdateSerializer) ToModel(ctx *gin.Context) (*models.Maintena
 
 	model.Title = m.Title
 	model.Description = m.Description
-	model.Cost = m.Cost
+	model.LabourHours = m.LabourHours
+	if model.LabourRate == 0 {
+		model.LabourRate = Maintenance_labour_rate()
+	}
 	model.MaintenReqRef = m.MaintenReqRef
 
 	return model, nil
 }
+
+// mainten_req_vehicle sets vehicle of maintenance request to vehicle of its malfunction report
+func mainten_req_vehicle(model *models.MaintenanceRequest) error {
+	if model.MalfuncRepRef == nil {
+		return nil
+	}
+	malfunc_report := &models.MalfunctionReport{}
+	if result := utils.DB.First(malfunc_report, model.MalfuncRepRef); result.Error != nil {
+		return result.Error
+	}
+	model.VehicleRef = malfunc_report.VehicleRef
+
+	return nil
+}
+
+// mainten_req_subject returns title of malfunction report or maintenance plan of request and type of its vehicle
+// malfunction report is loaded into model when it is not preloaded
+func mainten_req_subject(model *models.MaintenanceRequest) (title string, vehicle_type string, err error) {
+	if model.MalfuncRepRef != nil {
+		if model.MalfuncRep == nil {
+			model.MalfuncRep = &models.MalfunctionReport{}
+			if result := utils.DB.First(model.MalfuncRep, model.MalfuncRepRef); result.Error != nil {
+				return "", "", result.Error
+			}
+		}
+		title = model.MalfuncRep.Title
+	} else if model.MaintenPlanRef != nil {
+		plan := &models.MaintenancePlan{}
+		if result := utils.DB.First(plan, model.MaintenPlanRef); result.Error != nil {
+			return "", "", result.Error
+		}
+		title = plan.Title
+	}
+
+	if model.Vehicle == nil && model.VehicleRef != nil {
+		model.Vehicle = &models.Vehicle{}
+		if result := utils.DB.Where("registration = ?", model.VehicleRef).Find(model.Vehicle); result.Error != nil {
+			return "", "", result.Error
+		}
+	}
+	if model.Vehicle != nil {
+		vehicle_type = model.Vehicle.VehicleTypeName
+	}
+
+	return title, vehicle_type, nil
+}
+
+// MaintenReqStatusSerializer is used to serialize change of status of maintenance request
+// it is used in PATCH request, allowed changes depend on current status and role of user
+type MaintenReqStatusSerializer struct {
+	Status        models.Status `binding:"required"`
+	Note          *string
+	ValidatorErrs []validators.ValidatorErr
+}
+
+// MaintenStatusChangeSerializer is used to serialize record of status history of maintenance request
+type MaintenStatusChangeSerializer struct {
+	ID         uint
+	FromStatus models.Status
+	ToStatus   models.Status
+	ChangedBy  *UserMaintenanceSerializer
+	Note       *string
+	ChangedAt  time.Time
+}
+
+// Valid checks if user can change status of maintenance request
+func (m *MaintenReqStatusSerializer) Valid(request *models.MaintenanceRequest, user *models.User) bool {
+	validators.StatusValidator(string(m.Status), &m.ValidatorErrs)
+	if len(m.ValidatorErrs) != 0 {
+		return false
+	}
+	validators.Maintenance_status_validator(request, m.Status, user, &m.ValidatorErrs)
+
+	return len(m.ValidatorErrs) == 0
+}
+
+// Apply changes status of maintenance request and records the change into its history
+// nothing is changed when request already has the status, Valid has to be called before
+func (m *MaintenReqStatusSerializer) Apply(tx *gorm.DB, request *models.MaintenanceRequest, user *models.User) error {
+	if m.Status == request.Status {
+		return nil
+	}
+	change := models.MaintenanceStatusChange{
+		MaintenReqRef: request.ID,
+		FromStatus:    request.Status,
+		ToStatus:      m.Status,
+		ChangedByRef:  &user.ID,
+		Note:          m.Note,
+	}
+	if result := tx.Model(request).Update("status", m.Status); result.Error != nil {
+		return result.Error
+	}
+
+	return tx.Create(&change).Error
+}
+
+// FromModel loads status change model into serializer
+// user who changed status is loaded when it is not preloaded
+func (m *MaintenStatusChangeSerializer) FromModel(change *models.MaintenanceStatusChange) (err error) {
+	m.ID = change.ID
+	m.FromStatus = change.FromStatus
+	m.ToStatus = change.ToStatus
+	m.Note = change.Note
+	m.ChangedAt = change.ChangedAt
+
+	if change.ChangedBy == nil {
+		change.ChangedBy = &models.User{}
+		if result := utils.DB.Unscoped().First(change.ChangedBy, change.ChangedByRef); result.Error != nil {
+			return result.Error
+		}
+	}
+	m.ChangedBy = &UserMaintenanceSerializer{}
+
+	return m.ChangedBy.FromModel(change.ChangedBy)
+}
@@ -0,0 +1,225 @@
+// package serializers contains serializers used for serializing data
+// this file contains serializers for spare parts inventory and parts used in maintenance reports
+package serializers
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+	"gorm.io/gorm"
+)
+
+// SparePartSerializer is used to serialize part of catalogue with its stock
+type SparePartSerializer struct {
+	ID        uint
+	Number    string
+	Name      string
+	Unit      string
+	UnitPrice float64
+	Stock     float64
+	MinStock  float64
+	LowStock  bool
+}
+
+// SparePartCreateSerializer is used to serialize data for creating or updating part of catalogue
+// Stock is used only when part is created, later it changes by restocking and maintenance reports
+type SparePartCreateSerializer struct {
+	Number        string `binding:"required"`
+	Name          string `binding:"required"`
+	Unit          string
+	UnitPrice     float64
+	Stock         float64
+	MinStock      float64
+	ValidatorErrs []validators.ValidatorErr
+}
+
+// SparePartRestockSerializer is used to serialize delivery of parts into stock
+type SparePartRestockSerializer struct {
+	Quantity      float64 `binding:"required"`
+	ValidatorErrs []validators.ValidatorErr
+}
+
+// ReportItemCreateSerializer is used to serialize part used in maintenance report
+type ReportItemCreateSerializer struct {
+	SparePartRef uint    `binding:"required"`
+	Quantity     float64 `binding:"required"`
+}
+
+// ReportItemSerializer is used to serialize part used in maintenance report with its price
+type ReportItemSerializer struct {
+	ID           uint
+	SparePartRef uint
+	Number       string
+	Name         string
+	Unit         string
+	Quantity     float64
+	UnitPrice    float64
+	Cost         float64
+}
+
+func (s *SparePartSerializer) FromModel(part *models.SparePart) {
+	s.ID = part.ID
+	s.Number = part.Number
+	s.Name = part.Name
+	s.Unit = part.Unit
+	s.UnitPrice = part.UnitPrice
+	s.Stock = part.Stock
+	s.MinStock = part.MinStock
+	s.LowStock = part.Stock <= part.MinStock
+}
+
+// Valid validates part, id is nil when part is created
+func (s *SparePartCreateSerializer) Valid(id *uint) bool {
+	validators.Spare_part_validator(id, s.Number, s.UnitPrice, s.Stock, s.MinStock, &s.ValidatorErrs)
+	return len(s.ValidatorErrs) == 0
+}
+
+func (s *SparePartCreateSerializer) ToModel() *models.SparePart {
+	part := &models.SparePart{Stock: s.Stock}
+	s.UpdateModel(part)
+	return part
+}
+
+// UpdateModel loads catalogue data into part, stock is kept
+func (s *SparePartCreateSerializer) UpdateModel(part *models.SparePart) {
+	part.Number = s.Number
+	part.Name = s.Name
+	part.Unit = s.Unit
+	if part.Unit == "" {
+		part.Unit = "pcs"
+	}
+	part.UnitPrice = s.UnitPrice
+	part.MinStock = s.MinStock
+}
+
+func (s *SparePartRestockSerializer) Valid() bool {
+	if s.Quantity <= 0 {
+		s.ValidatorErrs = append(s.ValidatorErrs, validators.ValidatorErr{Name: "RestockErr", Desc: "Quantity must be positive"})
+	}
+	return len(s.ValidatorErrs) == 0
+}
+
+func (s *ReportItemSerializer) FromModel(item *models.MaintenanceReportItem) (err error) {
+	s.ID = item.ID
+	s.SparePartRef = item.SparePartRef
+	s.Quantity = item.Quantity
+	s.UnitPrice = item.UnitPrice
+	s.Cost = item.Cost()
+
+	if item.SparePart == nil {
+		item.SparePart = &models.SparePart{}
+		if result := utils.DB.First(item.SparePart, item.SparePartRef); result.Error != nil {
+			return result.Error
+		}
+	}
+	s.Number = item.SparePart.Number
+	s.Name = item.SparePart.Name
+	s.Unit = item.SparePart.Unit
+
+	return nil
+}
+
+// Report_items_valid validates labour hours and parts used in maintenance report
+func Report_items_valid(labour_hours float64, items []ReportItemCreateSerializer, validator_errs *[]validators.ValidatorErr) {
+	validators.Labour_hours_validator(labour_hours, validator_errs)
+	used_parts := map[uint]bool{}
+	for _, item := range items {
+		validators.Report_item_validator(item.SparePartRef, item.Quantity, used_parts, validator_errs)
+	}
+}
+
+// Maintenance_labour_rate returns price of one hour of labour used in cost of maintenance reports
+// it is set by MAINTENANCE_LABOUR_RATE environment variable, 0 by default
+func Maintenance_labour_rate() float64 {
+	if value, err := strconv.ParseFloat(os.Getenv("MAINTENANCE_LABOUR_RATE"), 64); err == nil && value >= 0 {
+		return value
+	}
+	return 0
+}
+
+// Save_report_items replaces parts used in saved maintenance report and derives its cost
+// parts of previous items are returned to stock first, parts of new items are taken from stock
+// part keeps unit price it had in report, new parts get their current price
+func Save_report_items(tx *gorm.DB, report *models.MaintenanceReport, items []ReportItemCreateSerializer) error {
+	prices := map[uint]float64{}
+	var old_items []models.MaintenanceReportItem
+	if result := tx.Where("mainten_rep_ref = ?", report.ID).Find(&old_items); result.Error != nil {
+		return result.Error
+	}
+	for _, item := range old_items {
+		prices[item.SparePartRef] = item.UnitPrice
+	}
+	if err := Return_report_items(tx, report); err != nil {
+		return err
+	}
+
+	report.Items = []models.MaintenanceReportItem{}
+	for _, item := range items {
+		part := models.SparePart{}
+		if result := tx.First(&part, item.SparePartRef); result.Error != nil {
+			return result.Error
+		}
+		result := tx.Model(&part).Where("stock >= ?", item.Quantity).Update("stock", gorm.Expr("stock - ?", item.Quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("not enough %s (%s) in stock, %.2f %s left", part.Name, part.Number, part.Stock, part.Unit)
+		}
+		price, ok := prices[part.ID]
+		if !ok {
+			price = part.UnitPrice
+		}
+		report_item := models.MaintenanceReportItem{
+			MaintenRepRef: report.ID,
+			SparePartRef:  part.ID,
+			Quantity:      item.Quantity,
+			UnitPrice:     price,
+		}
+		if result := tx.Create(&report_item); result.Error != nil {
+			return result.Error
+		}
+		report.Items = append(report.Items, report_item)
+	}
+
+	report.DeriveCost()
+	return tx.Model(report).Select("Cost", "LabourRate").Updates(report).Error
+}
+
+// Return_report_items returns parts used in maintenance report back to stock and removes them from report
+func Return_report_items(tx *gorm.DB, report *models.MaintenanceReport) error {
+	var items []models.MaintenanceReportItem
+	if result := tx.Where("mainten_rep_ref = ?", report.ID).Find(&items); result.Error != nil {
+		return result.Error
+	}
+	for _, item := range items {
+		result := tx.Model(&models.SparePart{}).Where("id = ?", item.SparePartRef).Update("stock", gorm.Expr("stock + ?", item.Quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	return tx.Where("mainten_rep_ref = ?", report.ID).Delete(&models.MaintenanceReportItem{}).Error
+}
+
+// Low_stock_parts returns parts of catalogue which dropped to their minimal stock
+func Low_stock_parts() ([]SparePartSerializer, error) {
+	var parts []models.SparePart
+	if result := utils.DB.Where("stock <= min_stock").Order("name").Find(&parts); result.Error != nil {
+		return nil, result.Error
+	}
+	serialized := []SparePartSerializer{}
+	for i := range parts {
+		part := SparePartSerializer{}
+		part.FromModel(&parts[i])
+		serialized = append(serialized, part)
+	}
+	return serialized, nil
+}
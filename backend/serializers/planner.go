@@ -0,0 +1,26 @@
+// package serializers holds structures and functions for serializing data
+// this file contains serializers for journey planner
+package serializers
+
+// ItinerarySerializer is used to serialize one journey found by planner
+// it is used in GET request to plan journey between two stops
+type ItinerarySerializer struct {
+	DepartureTime string
+	ArrivalTime   string
+	Duration      uint
+	Transfers     int
+	Legs          []ItineraryLegSerializer
+}
+
+// ItineraryLegSerializer is used to serialize part of journey made in one connection
+type ItineraryLegSerializer struct {
+	ConnectionID  uint
+	LineName      string
+	VehicleType   string
+	FromStop      string // platform or stop where passenger boards
+	FromStation   string
+	ToStop        string // platform or stop where passenger alights
+	ToStation     string
+	DepartureTime string
+	ArrivalTime   string
+}
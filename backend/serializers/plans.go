@@ -0,0 +1,392 @@
+// package serializers holds structures and functions for serializing data
+// this file contains serializers for preventive maintenance plans and mileage of vehicles
+package serializers
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaintenanceScheduleInterval is how often due maintenance plans are checked while server runs
+const MaintenanceScheduleInterval = time.Hour
+
+// schedule_mutex prevents creating same due request twice when plans are checked concurrently by this process,
+// other servers and commands are held off by lock of plan row
+var schedule_mutex sync.Mutex
+
+// MaintenPlanSerializer is used to serialize maintenance plan
+// Vehicles are filled only for single plan
+type MaintenPlanSerializer struct {
+	ID           uint
+	Title        string
+	Description  string
+	VehicleType  *string
+	VehicleRef   *string
+	IntervalDays *uint
+	IntervalKm   *uint
+	DeadlineDays uint
+	CreatedBy    *UserMaintenanceSerializer
+	CreatedAt    time.Time
+	Vehicles     []MaintenPlanVehicleSerializer
+}
+
+// MaintenPlanVehicleSerializer is used to serialize state of plan for one vehicle
+// plan is measured from last request it created, or from its creation
+type MaintenPlanVehicleSerializer struct {
+	Registration      string
+	Mileage           float64 // estimated current mileage in km
+	LastRequestID     *uint
+	LastRequestStatus *models.Status
+	DueAt             *time.Time
+	DueMileage        *float64
+	Due               bool
+	Open              bool // last request of plan is not done or rejected yet, no other is created
+}
+
+// MaintenPlanCreateSerializer is used to serialize maintenance plan
+// it is used in POST and PUT requests, exactly one of VehicleType and VehicleRef is required
+type MaintenPlanCreateSerializer struct {
+	Title         string `binding:"required"`
+	Description   string
+	VehicleType   *string
+	VehicleRef    *string
+	IntervalDays  *uint
+	IntervalKm    *uint
+	DeadlineDays  uint // 7 days when not given
+	ValidatorErrs []validators.ValidatorErr
+}
+
+// OdometerReadingSerializer is used to serialize manually entered mileage of vehicle
+type OdometerReadingSerializer struct {
+	ID         uint
+	VehicleRef string
+	Mileage    float64
+	RecordedAt time.Time
+}
+
+// OdometerReadingCreateSerializer is used to serialize manually entered mileage of vehicle
+// it is used in POST request, reading is recorded now when RecordedAt is not given
+type OdometerReadingCreateSerializer struct {
+	VehicleRef    string   `binding:"required"`
+	Mileage       *float64 `binding:"required"`
+	RecordedAt    string   // 2006-01-02 15:04
+	ValidatorErrs []validators.ValidatorErr
+	recorded_at   time.Time
+}
+
+// MileageSerializer is used to serialize estimated mileage of vehicle
+type MileageSerializer struct {
+	Registration string
+	Mileage      float64
+	AverageSpeed float64 // km/h used for estimation from completed connections
+	LastReading  *OdometerReadingSerializer
+}
+
+// Valid checks if plan data are valid
+func (m *MaintenPlanCreateSerializer) Valid() bool {
+	validators.Maintenance_plan_validator(m.VehicleType, m.VehicleRef, m.IntervalDays, m.IntervalKm, &m.ValidatorErrs)
+	return len(m.ValidatorErrs) == 0
+}
+
+// ToModel creates plan model from serializer
+// Valid has to be called before
+func (m *MaintenPlanCreateSerializer) ToModel(created_by uint) *models.MaintenancePlan {
+	model := &models.MaintenancePlan{CreatedByRef: &created_by}
+	m.UpdateModel(model)
+	return model
+}
+
+// UpdateModel loads serializer data into plan model
+// Valid has to be called before
+func (m *MaintenPlanCreateSerializer) UpdateModel(model *models.MaintenancePlan) {
+	model.Title = m.Title
+	model.Description = m.Description
+	model.VehicleTypeName = m.VehicleType
+	model.VehicleRef = m.VehicleRef
+	model.IntervalDays = m.IntervalDays
+	model.IntervalKm = m.IntervalKm
+	model.DeadlineDays = m.DeadlineDays
+	if model.DeadlineDays == 0 {
+		model.DeadlineDays = 7
+	}
+}
+
+// FromModel loads plan model into serializer
+// creator of plan has to be preloaded to fill CreatedBy
+func (m *MaintenPlanSerializer) FromModel(plan *models.MaintenancePlan) {
+	m.ID = plan.ID
+	m.Title = plan.Title
+	m.Description = plan.Description
+	m.VehicleType = plan.VehicleTypeName
+	m.VehicleRef = plan.VehicleRef
+	m.IntervalDays = plan.IntervalDays
+	m.IntervalKm = plan.IntervalKm
+	m.DeadlineDays = plan.DeadlineDays
+	m.CreatedAt = plan.CreatedAt
+	if plan.CreatedBy != nil {
+		m.CreatedBy = &UserMaintenanceSerializer{}
+		m.CreatedBy.FromModel(plan.CreatedBy)
+	}
+}
+
+// LoadVehicles fills state of plan for each of its vehicles at given time
+func (m *MaintenPlanSerializer) LoadVehicles(plan *models.MaintenancePlan, now time.Time) error {
+	registrations, err := plan_vehicles(plan)
+	if err != nil {
+		return err
+	}
+	estimator := mileage_estimator{}
+	m.Vehicles = []MaintenPlanVehicleSerializer{}
+	for _, registration := range registrations {
+		state, err := estimator.plan_state(plan, registration, now)
+		if err != nil {
+			return err
+		}
+		m.Vehicles = append(m.Vehicles, state)
+	}
+	return nil
+}
+
+// Valid checks if odometer reading data are valid
+func (o *OdometerReadingCreateSerializer) Valid() bool {
+	validators.Vehicle_registration_validator(&o.VehicleRef, &o.ValidatorErrs)
+	o.recorded_at = time.Now()
+	if o.RecordedAt != "" {
+		recorded_at, err := time.Parse("2006-01-02 15:04", o.RecordedAt)
+		if err != nil {
+			o.ValidatorErrs = append(o.ValidatorErrs, validators.ValidatorErr{Name: "TimeParse", Desc: err.Error()})
+			return false
+		}
+		o.recorded_at = recorded_at
+	}
+	if len(o.ValidatorErrs) != 0 {
+		return false
+	}
+	validators.Odometer_reading_validator(o.VehicleRef, *o.Mileage, o.recorded_at, &o.ValidatorErrs)
+	return len(o.ValidatorErrs) == 0
+}
+
+// ToModel creates odometer reading model from serializer
+// Valid has to be called before
+func (o *OdometerReadingCreateSerializer) ToModel(created_by uint) *models.OdometerReading {
+	return &models.OdometerReading{
+		VehicleRef:   o.VehicleRef,
+		Mileage:      *o.Mileage,
+		RecordedAt:   o.recorded_at,
+		CreatedByRef: &created_by,
+	}
+}
+
+// FromModel loads odometer reading model into serializer
+func (o *OdometerReadingSerializer) FromModel(reading *models.OdometerReading) {
+	o.ID = reading.ID
+	o.VehicleRef = reading.VehicleRef
+	o.Mileage = reading.Mileage
+	o.RecordedAt = reading.RecordedAt
+}
+
+// Get_mileage creates estimated mileage of vehicle at given time
+func Get_mileage(registration string, at time.Time) (*MileageSerializer, error) {
+	estimator := mileage_estimator{}
+	mileage, err := estimator.mileage(registration, at)
+	if err != nil {
+		return nil, err
+	}
+	response := &MileageSerializer{
+		Registration: registration,
+		Mileage:      mileage,
+		AverageSpeed: Vehicle_average_speed(),
+	}
+	reading := models.OdometerReading{}
+	res := utils.DB.Where("vehicle_ref = ? AND recorded_at <= ?", registration, at).Order("recorded_at DESC").Limit(1).Find(&reading)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected != 0 {
+		response.LastReading = &OdometerReadingSerializer{}
+		response.LastReading.FromModel(&reading)
+	}
+	return response, nil
+}
+
+// Vehicle_average_speed returns average speed in km/h used to estimate mileage from driving time
+// it is set by VEHICLE_AVERAGE_SPEED environment variable, 25 km/h by default
+func Vehicle_average_speed() float64 {
+	if value, err := strconv.ParseFloat(os.Getenv("VEHICLE_AVERAGE_SPEED"), 64); err == nil && value > 0 {
+		return value
+	}
+	return 25
+}
+
+// Schedule_maintenance creates maintenance requests of all plans which are due at given time
+// request is created by author of plan and is not created again until previous one is done,
+// requests of each plan are created in transaction holding lock of the plan
+func Schedule_maintenance(now time.Time) ([]models.MaintenanceRequest, error) {
+	schedule_mutex.Lock()
+	defer schedule_mutex.Unlock()
+
+	var plans []models.MaintenancePlan
+	if res := utils.DB.Order("id").Find(&plans); res.Error != nil {
+		return nil, res.Error
+	}
+	estimator := mileage_estimator{}
+	created := []models.MaintenanceRequest{}
+	for i := range plans {
+		plan := &plans[i]
+		plan_created := []models.MaintenanceRequest{}
+		err := utils.DB.Transaction(func(tx *gorm.DB) error {
+			// open requests are checked only after plan row is locked, so concurrent scheduler sees requests of the other
+			res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", plan.ID).Find(plan)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+			registrations, err := plan_vehicles(plan)
+			if err != nil {
+				return err
+			}
+			for _, registration := range registrations {
+				state, err := estimator.plan_state(plan, registration, now)
+				if err != nil {
+					return err
+				}
+				if !state.Due || state.Open {
+					continue
+				}
+				vehicle_ref := registration
+				mileage := state.Mileage
+				deadline := now.AddDate(0, 0, int(plan.DeadlineDays))
+				request := models.MaintenanceRequest{
+					Status:         models.PendingStatus,
+					Deadline:       &deadline,
+					VehicleRef:     &vehicle_ref,
+					MaintenPlanRef: &plan.ID,
+					Mileage:        &mileage,
+					CreatedByRef:   plan.CreatedByRef,
+				}
+				if res := tx.Create(&request); res.Error != nil {
+					return res.Error
+				}
+				plan_created = append(plan_created, request)
+			}
+			return nil
+		})
+		if err != nil {
+			return created, err
+		}
+		created = append(created, plan_created...)
+	}
+	return created, nil
+}
+
+// plan_vehicles returns registrations of vehicles maintained by plan
+func plan_vehicles(plan *models.MaintenancePlan) ([]string, error) {
+	if plan.VehicleRef != nil {
+		return []string{*plan.VehicleRef}, nil
+	}
+	var registrations []string
+	res := utils.DB.Model(&models.Vehicle{}).Where("vehicle_type_name = ?", plan.VehicleTypeName).Order("registration").Pluck("registration", &registrations)
+	return registrations, res.Error
+}
+
+// mileage_estimator estimates mileage of vehicles, driving time of lines is cached between vehicles
+type mileage_estimator struct {
+	minutes map[string]map[bool]uint
+}
+
+// mileage estimates mileage of vehicle at given time
+// last odometer reading before the time is increased by driving time of connections completed since
+func (e *mileage_estimator) mileage(registration string, at time.Time) (float64, error) {
+	reading := models.OdometerReading{}
+	res := utils.DB.Where("vehicle_ref = ? AND recorded_at <= ?", registration, at).Order("recorded_at DESC").Limit(1).Find(&reading)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	var connections []models.Connection
+	query := utils.DB.Where("vehicle_registration = ? AND status = ? AND arrival_time <= ?", registration, models.CompletedConnection, at)
+	if res.RowsAffected != 0 {
+		query = query.Where("arrival_time > ?", reading.RecordedAt)
+	}
+	if res := query.Find(&connections); res.Error != nil {
+		return 0, res.Error
+	}
+	var minutes uint
+	for _, connection := range connections {
+		line_minutes, err := e.line_minutes(connection.LineName, connection.Direction)
+		if err != nil {
+			return 0, err
+		}
+		minutes += line_minutes
+	}
+	return reading.Mileage + float64(minutes)/60*Vehicle_average_speed(), nil
+}
+
+// line_minutes returns time spent driving between stops of line in given direction
+func (e *mileage_estimator) line_minutes(line_name string, direction bool) (uint, error) {
+	if e.minutes == nil {
+		e.minutes = map[string]map[bool]uint{}
+	}
+	if _, ok := e.minutes[line_name]; !ok {
+		line, err := Get_line(line_name)
+		if err != nil {
+			return 0, err
+		}
+		e.minutes[line_name] = map[bool]uint{}
+		for _, dir := range []bool{false, true} {
+			for _, segment := range Direction_segments(line.Segments, dir) {
+				e.minutes[line_name][dir] += segment.Time
+			}
+		}
+	}
+	return e.minutes[line_name][direction], nil
+}
+
+// plan_state calculates state of plan for vehicle at given time
+func (e *mileage_estimator) plan_state(plan *models.MaintenancePlan, registration string, now time.Time) (MaintenPlanVehicleSerializer, error) {
+	state := MaintenPlanVehicleSerializer{Registration: registration}
+	var err error
+	if state.Mileage, err = e.mileage(registration, now); err != nil {
+		return state, err
+	}
+
+	since := plan.CreatedAt
+	var since_mileage *float64
+	last := models.MaintenanceRequest{}
+	res := utils.DB.Where("mainten_plan_ref = ? AND vehicle_ref = ?", plan.ID, registration).Order("created_at DESC").Limit(1).Find(&last)
+	if res.Error != nil {
+		return state, res.Error
+	}
+	if res.RowsAffected != 0 {
+		since = last.CreatedAt
+		since_mileage = last.Mileage
+		state.LastRequestID = &last.ID
+		state.LastRequestStatus = &last.Status
+		state.Open = !last.Status.Closed()
+	}
+
+	if plan.IntervalDays != nil && *plan.IntervalDays > 0 {
+		due_at := since.AddDate(0, 0, int(*plan.IntervalDays))
+		state.DueAt = &due_at
+		state.Due = !now.Before(due_at)
+	}
+	if plan.IntervalKm != nil && *plan.IntervalKm > 0 {
+		if since_mileage == nil {
+			mileage, err := e.mileage(registration, since)
+			if err != nil {
+				return state, err
+			}
+			since_mileage = &mileage
+		}
+		due_mileage := *since_mileage + float64(*plan.IntervalKm)
+		state.DueMileage = &due_mileage
+		state.Due = state.Due || state.Mileage >= due_mileage
+	}
+	return state, nil
+}
@@ -0,0 +1,225 @@
+// package serializers holds structures and functions for serializing data
+// this file contains serializers for qualifications of drivers
+package serializers
+
+import (
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+)
+
+// QualificationsDefaultDays is number of days ahead expiring qualifications are reported for
+const QualificationsDefaultDays = 30
+
+// LicenceSerializer is used to serialize licence of driver
+type LicenceSerializer struct {
+	ID          uint
+	DriverID    uint
+	DriverName  string
+	VehicleType string
+	Category    string
+	ValidUntil  string
+	Expired     bool
+}
+
+// LicenceCreateSerializer is used to serialize licence of driver
+// it is used in POST request to record new or renewed licence
+type LicenceCreateSerializer struct {
+	DriverID      uint   `binding:"required"`
+	VehicleType   string `binding:"required"`
+	Category      string `binding:"required"`
+	ValidUntil    string `binding:"required"` // 2006-01-02
+	ValidatorErrs []validators.ValidatorErr
+	valid_until   time.Time
+}
+
+// RouteKnowledgeSerializer is used to serialize route knowledge of driver
+// ValidUntil is nil for knowledge which does not expire
+type RouteKnowledgeSerializer struct {
+	ID         uint
+	DriverID   uint
+	DriverName string
+	LineName   string
+	ValidUntil *string
+	Expired    bool
+}
+
+// RouteKnowledgeCreateSerializer is used to serialize route knowledge of driver
+// it is used in POST request to record driver trained for line
+type RouteKnowledgeCreateSerializer struct {
+	DriverID      uint    `binding:"required"`
+	LineName      string  `binding:"required"`
+	ValidUntil    *string // 2006-01-02
+	ValidatorErrs []validators.ValidatorErr
+	valid_until   *time.Time
+}
+
+// QualificationsSerializer is used to serialize all qualifications of driver
+type QualificationsSerializer struct {
+	DriverID       uint
+	DriverName     string
+	Licences       []LicenceSerializer
+	RouteKnowledge []RouteKnowledgeSerializer
+}
+
+// ExpiringQualificationsSerializer is used to serialize report of qualifications expiring until given day
+// expired qualifications are reported too unless driver already has renewed one
+type ExpiringQualificationsSerializer struct {
+	Until          string
+	Licences       []LicenceSerializer
+	RouteKnowledge []RouteKnowledgeSerializer
+}
+
+// Valid checks if licence data are valid
+func (l *LicenceCreateSerializer) Valid() bool {
+	validators.HasRoleValidator(l.DriverID, &l.ValidatorErrs, models.DriverRole)
+	validators.Vehicle_type_validator(l.VehicleType, &l.ValidatorErrs)
+	validators.Licence_category_validator(l.Category, &l.ValidatorErrs)
+	var err error
+	if l.valid_until, err = time.Parse("2006-01-02", l.ValidUntil); err != nil {
+		l.ValidatorErrs = append(l.ValidatorErrs, validators.ValidatorErr{Name: "TimeParse", Desc: err.Error()})
+	}
+	return len(l.ValidatorErrs) == 0
+}
+
+// CreateModel creates licence model from serializer
+// Valid has to be called before
+func (l *LicenceCreateSerializer) CreateModel() models.Licence {
+	return models.Licence{
+		DriverID:        l.DriverID,
+		VehicleTypeName: l.VehicleType,
+		Category:        l.Category,
+		ValidUntil:      l.valid_until,
+	}
+}
+
+// Valid checks if route knowledge data are valid
+func (r *RouteKnowledgeCreateSerializer) Valid() bool {
+	validators.HasRoleValidator(r.DriverID, &r.ValidatorErrs, models.DriverRole)
+	validators.Line_name_validator(r.LineName, &r.ValidatorErrs)
+	if r.ValidUntil != nil {
+		valid_until, err := time.Parse("2006-01-02", *r.ValidUntil)
+		if err != nil {
+			r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "TimeParse", Desc: err.Error()})
+		}
+		r.valid_until = &valid_until
+	}
+	return len(r.ValidatorErrs) == 0
+}
+
+// CreateModel creates route knowledge model from serializer
+// Valid has to be called before
+func (r *RouteKnowledgeCreateSerializer) CreateModel() models.RouteKnowledge {
+	return models.RouteKnowledge{
+		DriverID:   r.DriverID,
+		LineName:   r.LineName,
+		ValidUntil: r.valid_until,
+	}
+}
+
+// FromModel loads licence model into serializer
+// driver of licence has to be preloaded to fill DriverName
+func (l *LicenceSerializer) FromModel(licence *models.Licence) {
+	l.ID = licence.ID
+	l.DriverID = licence.DriverID
+	if licence.Driver != nil {
+		l.DriverName = licence.Driver.FullName
+	}
+	l.VehicleType = licence.VehicleTypeName
+	l.Category = licence.Category
+	l.ValidUntil = licence.ValidUntil.Format("2006-01-02")
+	l.Expired = !licence.Valid(time.Now())
+}
+
+// FromModel loads route knowledge model into serializer
+// driver of route knowledge has to be preloaded to fill DriverName
+func (r *RouteKnowledgeSerializer) FromModel(knowledge *models.RouteKnowledge) {
+	r.ID = knowledge.ID
+	r.DriverID = knowledge.DriverID
+	if knowledge.Driver != nil {
+		r.DriverName = knowledge.Driver.FullName
+	}
+	r.LineName = knowledge.LineName
+	if knowledge.ValidUntil != nil {
+		valid_until := knowledge.ValidUntil.Format("2006-01-02")
+		r.ValidUntil = &valid_until
+	}
+	r.Expired = !knowledge.Valid(time.Now())
+}
+
+// FromModel loads driver with preloaded licences and route knowledge into serializer
+func (q *QualificationsSerializer) FromModel(driver *models.User) {
+	q.DriverID = driver.ID
+	q.DriverName = driver.FullName
+	q.Licences = []LicenceSerializer{}
+	q.RouteKnowledge = []RouteKnowledgeSerializer{}
+	for i := range driver.Licences {
+		licence := LicenceSerializer{}
+		driver.Licences[i].Driver = driver
+		licence.FromModel(&driver.Licences[i])
+		q.Licences = append(q.Licences, licence)
+	}
+	for i := range driver.RouteKnowledge {
+		knowledge := RouteKnowledgeSerializer{}
+		driver.RouteKnowledge[i].Driver = driver
+		knowledge.FromModel(&driver.RouteKnowledge[i])
+		q.RouteKnowledge = append(q.RouteKnowledge, knowledge)
+	}
+}
+
+// Expiring_qualifications creates report of licences and route knowledge expiring until given day
+// qualification is not reported when driver holds same one valid after that day
+func Expiring_qualifications(until time.Time) (*ExpiringQualificationsSerializer, error) {
+	report := &ExpiringQualificationsSerializer{
+		Until:          until.Format("2006-01-02"),
+		Licences:       []LicenceSerializer{},
+		RouteKnowledge: []RouteKnowledgeSerializer{},
+	}
+
+	var licences []models.Licence
+	if res := utils.DB.Preload("Driver").Order("valid_until, driver_id").Find(&licences); res.Error != nil {
+		return nil, res.Error
+	}
+	renewed := map[uint]map[string]bool{}
+	for _, licence := range licences {
+		if licence.ValidUntil.After(until) {
+			if renewed[licence.DriverID] == nil {
+				renewed[licence.DriverID] = map[string]bool{}
+			}
+			renewed[licence.DriverID][licence.VehicleTypeName] = true
+		}
+	}
+	for i := range licences {
+		if renewed[licences[i].DriverID][licences[i].VehicleTypeName] {
+			continue
+		}
+		licence := LicenceSerializer{}
+		licence.FromModel(&licences[i])
+		report.Licences = append(report.Licences, licence)
+	}
+
+	var knowledge []models.RouteKnowledge
+	if res := utils.DB.Preload("Driver").Order("valid_until, driver_id").Find(&knowledge); res.Error != nil {
+		return nil, res.Error
+	}
+	known := map[uint]map[string]bool{}
+	for _, item := range knowledge {
+		if item.ValidUntil == nil || item.ValidUntil.After(until) {
+			if known[item.DriverID] == nil {
+				known[item.DriverID] = map[string]bool{}
+			}
+			known[item.DriverID][item.LineName] = true
+		}
+	}
+	for i := range knowledge {
+		if known[knowledge[i].DriverID][knowledge[i].LineName] {
+			continue
+		}
+		item := RouteKnowledgeSerializer{}
+		item.FromModel(&knowledge[i])
+		report.RouteKnowledge = append(report.RouteKnowledge, item)
+	}
+	return report, nil
+}
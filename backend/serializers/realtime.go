@@ -0,0 +1,304 @@
+// package serializers holds structures and functions for serializing data
+// this file contains serializers for real-time vehicle data
+package serializers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+	"gorm.io/gorm"
+)
+
+// DelayedThreshold is delay in seconds from which connection is considered delayed
+const DelayedThreshold = 3 * 60
+
+// RealtimeSnapRadius is distance in meters from stop in which reported position is considered to be in the stop
+const RealtimeSnapRadius = 100.0
+
+// RealtimeEventSerializer is used to serialize position or departure reported for connection
+// it is used in POST request by drivers and AVL gateway, Time is wall-clock time same as times of timetable
+// and defaults to current time
+type RealtimeEventSerializer struct {
+	Type          string `binding:"required"`
+	StopName      *string
+	Latitude      *float64
+	Longitude     *float64
+	Time          string // 2006-01-02 15:04:05
+	ValidatorErrs []validators.ValidatorErr
+}
+
+// RealtimeSerializer is used to serialize current real-time state of connection
+// it is used in GET request to get delay and expected times of connection
+type RealtimeSerializer struct {
+	ConnectionID uint
+	Status       string
+	DelayMinutes *int
+	LastStop     *string
+	UpdatedAt    *string
+	Latitude     *float64
+	Longitude    *float64
+	Stops        []StopInConnection
+}
+
+// Valid checks if reported event is valid
+func (e *RealtimeEventSerializer) Valid() bool {
+	validators.Realtime_event_validator(e.Type, e.StopName, e.Latitude, e.Longitude, e.Time, &e.ValidatorErrs)
+	return len(e.ValidatorErrs) == 0
+}
+
+// CreateModel creates event model and updates delay and status of connection from it
+// departure from stop sets delay against scheduled departure, position in stop against scheduled arrival,
+// position without stop name is snapped to nearest upcoming stop within RealtimeSnapRadius,
+// connection is completed when vehicle reaches last stop it serves
+// Valid has to be called before
+func (e *RealtimeEventSerializer) CreateModel(connection *models.Connection) (*models.RealtimeEvent, error) {
+	if connection.Status == models.CancelledConnection || connection.Status == models.CompletedConnection {
+		return nil, fmt.Errorf("Connection is %s", connection.Status)
+	}
+	event_time := utils.Wall_clock_now()
+	if e.Time != "" {
+		event_time, _ = time.Parse("2006-01-02 15:04:05", e.Time)
+	}
+	event := &models.RealtimeEvent{
+		ConnectionID: connection.ID,
+		Type:         models.RealtimeEventType(e.Type),
+		StopName:     e.StopName,
+		Latitude:     e.Latitude,
+		Longitude:    e.Longitude,
+		Time:         event_time,
+	}
+	if connection.Delay != nil {
+		event.Delay = *connection.Delay
+	}
+	if e.StopName != nil || e.Latitude != nil {
+		stops, err := Get_connection_stops(connection.LineName, connection.Direction, connection.DepartureTime)
+		if err != nil {
+			return nil, err
+		}
+		after := -1
+		if connection.LastStopIndex != nil {
+			after = *connection.LastStopIndex
+		}
+		var index int
+		if e.StopName != nil {
+			index = Realtime_stop_index(stops, *e.StopName, after)
+			if index == -1 {
+				return nil, fmt.Errorf("Stop %s is not ahead of connection", *e.StopName)
+			}
+		} else {
+			if index, err = Realtime_nearest_stop_index(stops, *e.Latitude, *e.Longitude, after); err != nil {
+				return nil, err
+			}
+			// vehicle between stops does not change delay
+			if index == -1 {
+				connection.RealtimeUpdatedAt = &event_time
+				return event, nil
+			}
+			event.StopName = &stops[index].StopName
+		}
+		event.StopIndex = &index
+		if event.Type == models.DepartedEvent {
+			event.Delay = int(event_time.Sub(stops[index].DepartureTime).Seconds())
+			connection.LastStopIndex = &index
+		} else {
+			event.Delay = int(event_time.Sub(stops[index].ArrivalTime).Seconds())
+		}
+		connection.Delay = &event.Delay
+		// status set by dispatcher is kept
+		if !connection.StatusManual {
+			connection.Status = models.ScheduledConnection
+			if event.Delay >= DelayedThreshold {
+				connection.Status = models.DelayedConnection
+			}
+		}
+		// position snapped to final stop does not mean that vehicle arrived,
+		// only departure from final stop or position reported in it completes connection
+		if index == Final_stop_index(connection, len(stops)) && (event.Type == models.DepartedEvent || e.StopName != nil) {
+			connection.Status = models.CompletedConnection
+		}
+	}
+	connection.RealtimeUpdatedAt = &event_time
+	return event, nil
+}
+
+// FromModel loads real-time state of connection into serializer
+func (r *RealtimeSerializer) FromModel(connection models.Connection) error {
+	r.ConnectionID = connection.ID
+	r.Status = string(connection.Status)
+	r.DelayMinutes = Delay_minutes(connection.Delay)
+	r.UpdatedAt = format_time(connection.RealtimeUpdatedAt, "2006-01-02 15:04:05")
+	stops, err := Expected_connection_stops(connection)
+	if err != nil {
+		return err
+	}
+	if connection.LastStopIndex != nil && *connection.LastStopIndex < len(stops) {
+		r.LastStop = &stops[*connection.LastStopIndex].StopName
+	}
+	position := models.RealtimeEvent{}
+	res := utils.DB.Where("connection_id = ? AND latitude IS NOT NULL", connection.ID).Order("time DESC").Limit(1).Find(&position)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected != 0 {
+		r.Latitude = position.Latitude
+		r.Longitude = position.Longitude
+	}
+	r.Stops = Stops_in_connection(stops)
+	return nil
+}
+
+// Realtime_stop_index finds first occurrence of stop after given index, -1 if there is none
+func Realtime_stop_index(stops []ConnectionStop, stop_name string, after int) int {
+	for i := after + 1; i < len(stops); i++ {
+		if stops[i].StopName == stop_name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Realtime_nearest_stop_index finds stop after given index nearest to position within RealtimeSnapRadius,
+// -1 if there is none, stops without coordinates are skipped
+func Realtime_nearest_stop_index(stops []ConnectionStop, latitude float64, longitude float64, after int) (int, error) {
+	names := []string{}
+	for i := after + 1; i < len(stops); i++ {
+		names = append(names, stops[i].StopName)
+	}
+	if len(names) == 0 {
+		return -1, nil
+	}
+	var stop_models []models.Stop
+	if res := utils.DB.Where("name IN ? AND latitude IS NOT NULL AND longitude IS NOT NULL", names).Find(&stop_models); res.Error != nil {
+		return -1, res.Error
+	}
+	distances := map[string]float64{}
+	for _, stop := range stop_models {
+		distances[stop.Name] = Distance_meters(latitude, longitude, *stop.Latitude, *stop.Longitude)
+	}
+	nearest := -1
+	for i := after + 1; i < len(stops); i++ {
+		distance, ok := distances[stops[i].StopName]
+		if !ok || distance > RealtimeSnapRadius {
+			continue
+		}
+		if nearest == -1 || distance < distances[stops[nearest].StopName] {
+			nearest = i
+		}
+	}
+	return nearest, nil
+}
+
+// Expected_connection_stops calculates stops of connection with expected times from real-time data
+// delay is propagated to remaining stops, early vehicle waits for scheduled departure,
+// departed stops get times reported by vehicle, stops not served by connection are marked cancelled
+func Expected_connection_stops(connection models.Connection) ([]ConnectionStop, error) {
+	stops, err := Get_connection_stops(connection.LineName, connection.Direction, connection.DepartureTime)
+	if err != nil {
+		return nil, err
+	}
+	for i := range stops {
+		stops[i].Cancelled = connection.StopCancelled(i)
+	}
+	if connection.Delay == nil {
+		return stops, nil
+	}
+	var events []models.RealtimeEvent
+	res := utils.DB.Where("connection_id = ? AND stop_index IS NOT NULL", connection.ID).Order("time").Find(&events)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	last := -1
+	if connection.LastStopIndex != nil {
+		last = *connection.LastStopIndex
+	}
+	for _, event := range events {
+		index := *event.StopIndex
+		if index >= len(stops) {
+			continue
+		}
+		event_time := event.Time
+		if event.Type == models.DepartedEvent {
+			stops[index].ExpectedDepartureTime = &event_time
+		} else {
+			stops[index].ExpectedArrivalTime = &event_time
+		}
+	}
+	delay := time.Duration(*connection.Delay) * time.Second
+	for i := last + 1; i < len(stops); i++ {
+		if stops[i].ExpectedArrivalTime == nil {
+			arrival := stops[i].ArrivalTime.Add(delay)
+			stops[i].ExpectedArrivalTime = &arrival
+		}
+		if delay < 0 {
+			delay = 0
+		}
+		departure := stops[i].DepartureTime.Add(delay)
+		if departure.Before(*stops[i].ExpectedArrivalTime) {
+			departure = *stops[i].ExpectedArrivalTime
+		}
+		stops[i].ExpectedDepartureTime = &departure
+	}
+	return stops, nil
+}
+
+// Stops_in_connection converts stops of connection into serializers with times of day
+func Stops_in_connection(connection_stops []ConnectionStop) []StopInConnection {
+	stops := []StopInConnection{}
+	for _, stop := range connection_stops {
+		stops = append(stops, StopInConnection{
+			StopName:              stop.StopName,
+			ArrivalTime:           stop.ArrivalTime.Format("15:04"),
+			DepartureTime:         stop.DepartureTime.Format("15:04"),
+			ExpectedArrivalTime:   format_time(stop.ExpectedArrivalTime, "15:04"),
+			ExpectedDepartureTime: format_time(stop.ExpectedDepartureTime, "15:04"),
+			Cancelled:             stop.Cancelled,
+		})
+	}
+	return stops
+}
+
+// Realtime loads delay and expected departure and arrival of connection into serializer
+func (c *ConnectionUserSerializer) Realtime(connection models.Connection) error {
+	c.DelayMinutes = Delay_minutes(connection.Delay)
+	if connection.Delay == nil {
+		return nil
+	}
+	stops, err := Expected_connection_stops(connection)
+	if err != nil || len(stops) == 0 {
+		return err
+	}
+	c.ExpectedDepartureTime = format_time(stops[0].ExpectedDepartureTime, "2006-01-02 15:04")
+	c.ExpectedArrivalTime = format_time(stops[len(stops)-1].ExpectedArrivalTime, "2006-01-02 15:04")
+	return nil
+}
+
+// Delay_minutes converts delay in seconds into whole minutes
+func Delay_minutes(delay *int) *int {
+	if delay == nil {
+		return nil
+	}
+	minutes := *delay / 60
+	return &minutes
+}
+
+// format_time formats optional time
+func format_time(t *time.Time, layout string) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(layout)
+	return &formatted
+}
+
+// Record_realtime_event saves event and updated real-time state of connection
+func Record_realtime_event(connection *models.Connection, event *models.RealtimeEvent) error {
+	return utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(event).Error; err != nil {
+			return err
+		}
+		return tx.Model(connection).Select("Delay", "LastStopIndex", "RealtimeUpdatedAt", "Status").Updates(connection).Error
+	})
+}
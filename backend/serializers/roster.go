@@ -0,0 +1,593 @@
+// package serializers holds structures and functions for serializing data
+// this file contains serializers for automatic roster of drivers and vehicles
+package serializers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+	"gorm.io/gorm"
+)
+
+// RosterDefaultLayover is default turnaround time in minutes between two trips of driver or vehicle
+const RosterDefaultLayover = 10
+
+// RosterMaxDays is maximal number of days rostered at once
+const RosterMaxDays = 31
+
+// RosterPreviewSerializer is used to serialize range of days roster is proposed for
+// it is used in POST request to preview proposed assignments
+type RosterPreviewSerializer struct {
+	From          string `binding:"required"` // 2006-01-02
+	To            string `binding:"required"` // 2006-01-02
+	Layover       *int   // minutes, RosterDefaultLayover when not given
+	ValidatorErrs []validators.ValidatorErr
+}
+
+// RosterSerializer is used to serialize proposed roster
+// Unassigned holds connections which could not get driver or vehicle
+type RosterSerializer struct {
+	From        string
+	To          string
+	Layover     int
+	Assignments []RosterAssignmentSerializer
+	Unassigned  []uint
+	Drivers     []RosterDriverSerializer
+}
+
+// RosterAssignmentSerializer is used to serialize driver and vehicle assigned to connection
+// nil driver or vehicle keeps the one already assigned
+type RosterAssignmentSerializer struct {
+	ConnectionID  uint `binding:"required"`
+	LineName      string
+	DepartureTime string
+	ArrivalTime   string
+	DriverID      *uint
+	DriverName    string
+	VehicleReg    *string
+}
+
+// RosterDriverSerializer is used to serialize minutes driver spends on connections in rostered days
+type RosterDriverSerializer struct {
+	DriverID   uint
+	DriverName string
+	Minutes    int
+}
+
+// RosterCommitSerializer is used to serialize assignments of previewed roster
+// it is used in POST request to assign all of them at once
+type RosterCommitSerializer struct {
+	Assignments   []RosterAssignmentSerializer `binding:"required"`
+	Layover       *int                         // minutes, RosterDefaultLayover when not given
+	ValidatorErrs []validators.ValidatorErr
+	connections   []models.Connection
+}
+
+// rosterTrip is interval when driver or vehicle is busy on connection
+type rosterTrip struct {
+	departure time.Time
+	arrival   time.Time
+	from      string
+	to        string
+	line      string
+}
+
+// rosterResource is driver or vehicle with trips it is busy on
+// driver is also unavailable during its absences
+type rosterResource struct {
+	driver       *models.User
+	vehicle      *models.Vehicle
+	registration string
+	trips        []rosterTrip
+	absences     []rosterTrip
+	minutes      int
+}
+
+// available checks if resource can drive trip keeping layover before and after its other trips
+// trips touching each other overlap same as in driver and vehicle availability validators
+func (r *rosterResource) available(trip rosterTrip, layover time.Duration) bool {
+	for _, busy := range r.trips {
+		if !trip.departure.After(busy.arrival.Add(layover)) && !busy.departure.After(trip.arrival.Add(layover)) {
+			return false
+		}
+	}
+	for _, absence := range r.absences {
+		if trip.departure.Before(absence.arrival) && absence.departure.Before(trip.arrival) {
+			return false
+		}
+	}
+	return true
+}
+
+// prefers checks if trip fits in any preferred shift of driver
+func (r *rosterResource) prefers(trip rosterTrip) bool {
+	if r.driver == nil {
+		return false
+	}
+	for i := range r.driver.PreferredShifts {
+		if r.driver.PreferredShifts[i].Covers(trip.departure, trip.arrival) {
+			return true
+		}
+	}
+	return false
+}
+
+// keepsWorkingTime checks if driver keeps working time rules when driving also given trip
+func (r *rosterResource) keepsWorkingTime(trip rosterTrip, rules validators.WorkingTimeRules) bool {
+	trips := []validators.WorkingTrip{{Departure: trip.departure, Arrival: trip.arrival, Checked: true}}
+	for _, busy := range r.trips {
+		trips = append(trips, validators.WorkingTrip{Departure: busy.departure, Arrival: busy.arrival})
+	}
+	validator_errs := []validators.ValidatorErr{}
+	validators.Working_time_validator(rules, trips, &validator_errs)
+	return len(validator_errs) == 0
+}
+
+// qualified checks if driver knows line of trip and holds licence for vehicle type, empty vehicle type is not checked
+func (r *rosterResource) qualified(trip rosterTrip, vehicle_type string) bool {
+	validator_errs := []validators.ValidatorErr{}
+	validators.Driver_qualification(r.driver, vehicle_type, trip.line, trip.departure, trip.arrival, &validator_errs)
+	return len(validator_errs) == 0
+}
+
+// operates checks if vehicle can operate line of trip
+func (r *rosterResource) operates(trip rosterTrip, lines map[string]models.Line) bool {
+	line := lines[trip.line]
+	validator_errs := []validators.ValidatorErr{}
+	validators.Line_vehicle_compatibility(&line, r.vehicle, &validator_errs)
+	return len(validator_errs) == 0
+}
+
+// endsAt checks if last trip of resource before given trip ends in stop trip departs from
+func (r *rosterResource) endsAt(trip rosterTrip) bool {
+	var last *rosterTrip
+	for i := range r.trips {
+		if r.trips[i].arrival.Before(trip.departure) && (last == nil || r.trips[i].arrival.After(last.arrival)) {
+			last = &r.trips[i]
+		}
+	}
+	return last != nil && last.to == trip.from
+}
+
+// Valid checks if range of rostered days is valid
+func (r *RosterPreviewSerializer) Valid() bool {
+	from, err := time.Parse("2006-01-02", r.From)
+	if err != nil {
+		r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "TimeParse", Desc: err.Error()})
+	}
+	to, err := time.Parse("2006-01-02", r.To)
+	if err != nil {
+		r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "TimeParse", Desc: err.Error()})
+	}
+	if len(r.ValidatorErrs) != 0 {
+		return false
+	}
+	if to.Before(from) || to.Sub(from) >= RosterMaxDays*24*time.Hour {
+		r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "RosterErr", Desc: fmt.Sprintf("Roster can be proposed for 1 to %d days", RosterMaxDays)})
+	}
+	if r.Layover != nil && (*r.Layover < 0 || *r.Layover > 24*60) {
+		r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "RosterErr", Desc: "Layover must be between 0 and 1440 minutes"})
+	}
+	return len(r.ValidatorErrs) == 0
+}
+
+// Propose creates roster assigning drivers and vehicles to unassigned future connections in rostered days
+// connections are assigned in order of departure, qualified driver keeping working time rules who is not absent
+// and prefers shift of connection is chosen first, then driver with least minutes on connections to balance hours,
+// vehicle compatible with line and licence of driver already waiting in departure stop is preferred to least used one
+// only connections already generated from services are rostered, Valid has to be called before
+func (r *RosterPreviewSerializer) Propose() (*RosterSerializer, error) {
+	from, _ := time.Parse("2006-01-02", r.From)
+	to, _ := time.Parse("2006-01-02", r.To)
+	to = to.AddDate(0, 0, 1)
+	layover_minutes := RosterDefaultLayover
+	if r.Layover != nil {
+		layover_minutes = *r.Layover
+	}
+	layover := time.Duration(layover_minutes) * time.Minute
+
+	var drivers []models.User
+	if res := utils.DB.Order("id").Preload("PreferredShifts").Preload("Licences").Preload("RouteKnowledge").Find(&drivers, "role = ?", models.DriverRole); res.Error != nil {
+		return nil, res.Error
+	}
+	var vehicles []models.Vehicle
+	if res := utils.DB.Order("registration").Find(&vehicles); res.Error != nil {
+		return nil, res.Error
+	}
+	in_maintenance, err := validators.Vehicles_in_maintenance()
+	if err != nil {
+		return nil, err
+	}
+	driver_resources := map[uint]*rosterResource{}
+	vehicle_resources := map[string]*rosterResource{}
+	driver_order := []*rosterResource{}
+	vehicle_order := []*rosterResource{}
+	for i := range drivers {
+		resource := &rosterResource{driver: &drivers[i]}
+		driver_resources[drivers[i].ID] = resource
+		driver_order = append(driver_order, resource)
+	}
+	var absences []models.Absence
+	if res := utils.DB.Where("start_time < ? AND end_time > ?", to.AddDate(0, 0, 1), from.AddDate(0, 0, -1)).Find(&absences); res.Error != nil {
+		return nil, res.Error
+	}
+	for _, absence := range absences {
+		if driver, ok := driver_resources[absence.UserID]; ok {
+			driver.absences = append(driver.absences, rosterTrip{departure: absence.StartTime, arrival: absence.EndTime})
+		}
+	}
+	vehicle_types := map[string]string{}
+	for i, vehicle := range vehicles {
+		vehicle_types[vehicle.Registration] = vehicle.VehicleTypeName
+		if in_maintenance[vehicle.Registration] {
+			continue
+		}
+		resource := &rosterResource{vehicle: &vehicles[i], registration: vehicle.Registration}
+		vehicle_resources[vehicle.Registration] = resource
+		vehicle_order = append(vehicle_order, resource)
+	}
+
+	// trips already assigned around rostered days keep drivers and vehicles busy,
+	// whole weeks are needed for weekly limit of driving
+	var assigned []models.Connection
+	res := utils.DB.Where("(driver_id IS NOT NULL OR vehicle_registration IS NOT NULL) AND status <> ? AND departure_time < ? AND arrival_time > ?",
+		models.CancelledConnection, to.AddDate(0, 0, 8), from.AddDate(0, 0, -8)).Find(&assigned)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	lines := map[string]models.Line{}
+	for _, connection := range assigned {
+		trip, err := roster_trip(connection, lines)
+		if err != nil {
+			return nil, err
+		}
+		counted := !connection.DepartureTime.Before(from) && connection.DepartureTime.Before(to)
+		near := connection.DepartureTime.Before(to.AddDate(0, 0, 1)) && connection.ArrivalTime.After(from.AddDate(0, 0, -1))
+		if connection.DriverID != nil {
+			if driver, ok := driver_resources[*connection.DriverID]; ok {
+				driver.trips = append(driver.trips, trip)
+				if counted {
+					driver.minutes += int(trip.arrival.Sub(trip.departure).Minutes())
+				}
+			}
+		}
+		if connection.VehicleRegistration != nil {
+			if vehicle, ok := vehicle_resources[*connection.VehicleRegistration]; ok && near {
+				vehicle.trips = append(vehicle.trips, trip)
+				vehicle.minutes += int(trip.arrival.Sub(trip.departure).Minutes())
+			}
+		}
+	}
+
+	start := from
+	if now := utils.Wall_clock_now(); now.After(start) {
+		start = now
+	}
+	var unassigned []models.Connection
+	res = utils.DB.Order("departure_time, id").
+		Where("(driver_id IS NULL OR vehicle_registration IS NULL) AND status IN ? AND departure_time >= ? AND departure_time < ?",
+			[]models.ConnectionStatus{models.ScheduledConnection, models.DelayedConnection}, start, to).
+		Find(&unassigned)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	rules := validators.Working_time_rules()
+	roster := &RosterSerializer{
+		From:        r.From,
+		To:          r.To,
+		Layover:     layover_minutes,
+		Assignments: []RosterAssignmentSerializer{},
+		Unassigned:  []uint{},
+		Drivers:     []RosterDriverSerializer{},
+	}
+	for _, connection := range unassigned {
+		trip, err := roster_trip(connection, lines)
+		if err != nil {
+			return nil, err
+		}
+		assignment := RosterAssignmentSerializer{
+			ConnectionID:  connection.ID,
+			LineName:      connection.LineName,
+			DepartureTime: connection.DepartureTime.Format("2006-01-02 15:04"),
+			ArrivalTime:   connection.ArrivalTime.Format("2006-01-02 15:04"),
+		}
+		missing := false
+		// vehicle already on connection restricts drivers, chosen or already assigned driver restricts vehicles
+		vehicle_type := ""
+		if connection.VehicleRegistration != nil {
+			vehicle_type = vehicle_types[*connection.VehicleRegistration]
+		}
+		var driver_model *models.User
+		if connection.DriverID != nil {
+			if driver, ok := driver_resources[*connection.DriverID]; ok {
+				driver_model = driver.driver
+			}
+		}
+		if connection.DriverID == nil {
+			var best *rosterResource
+			best_preferred := false
+			for _, driver := range driver_order {
+				if !driver.available(trip, layover) || !driver.qualified(trip, vehicle_type) || !driver.keepsWorkingTime(trip, rules) {
+					continue
+				}
+				preferred := driver.prefers(trip)
+				if best == nil || (preferred && !best_preferred) || (preferred == best_preferred && driver.minutes < best.minutes) {
+					best = driver
+					best_preferred = preferred
+				}
+			}
+			if best != nil {
+				best.trips = append(best.trips, trip)
+				best.minutes += int(trip.arrival.Sub(trip.departure).Minutes())
+				assignment.DriverID = &best.driver.ID
+				assignment.DriverName = best.driver.FullName
+				driver_model = best.driver
+			} else {
+				missing = true
+			}
+		}
+		if connection.VehicleRegistration == nil {
+			var best *rosterResource
+			best_waiting := false
+			for _, vehicle := range vehicle_order {
+				if !vehicle.available(trip, layover) || !vehicle.operates(trip, lines) {
+					continue
+				}
+				if driver_model != nil && !validators.Driver_licensed(driver_model, vehicle.vehicle.VehicleTypeName, trip.departure, trip.arrival) {
+					continue
+				}
+				waiting := vehicle.endsAt(trip)
+				if best == nil || (waiting && !best_waiting) || (waiting == best_waiting && vehicle.minutes < best.minutes) {
+					best = vehicle
+					best_waiting = waiting
+				}
+			}
+			if best != nil {
+				best.trips = append(best.trips, trip)
+				best.minutes += int(trip.arrival.Sub(trip.departure).Minutes())
+				assignment.VehicleReg = &best.registration
+			} else {
+				missing = true
+			}
+		}
+		if missing {
+			roster.Unassigned = append(roster.Unassigned, connection.ID)
+		}
+		if assignment.DriverID != nil || assignment.VehicleReg != nil {
+			roster.Assignments = append(roster.Assignments, assignment)
+		}
+	}
+	for _, driver := range driver_order {
+		roster.Drivers = append(roster.Drivers, RosterDriverSerializer{
+			DriverID:   driver.driver.ID,
+			DriverName: driver.driver.FullName,
+			Minutes:    driver.minutes,
+		})
+	}
+	sort.SliceStable(roster.Drivers, func(i, j int) bool {
+		return roster.Drivers[i].Minutes > roster.Drivers[j].Minutes
+	})
+	return roster, nil
+}
+
+// roster_trip creates trip of connection with stops it departs from and arrives to
+// loaded lines with their vehicle types are kept in cache
+func roster_trip(connection models.Connection, lines map[string]models.Line) (rosterTrip, error) {
+	line, ok := lines[connection.LineName]
+	if !ok {
+		if res := utils.DB.Preload("VehicleTypes").First(&line, "name = ?", connection.LineName); res.Error != nil {
+			return rosterTrip{}, res.Error
+		}
+		lines[connection.LineName] = line
+	}
+	trip := rosterTrip{
+		departure: connection.DepartureTime,
+		arrival:   connection.ArrivalTime,
+		from:      line.InitialStop,
+		to:        line.FinalStop,
+		line:      line.Name,
+	}
+	if connection.Direction {
+		trip.from, trip.to = trip.to, trip.from
+	}
+	return trip, nil
+}
+
+// Valid checks if assignments can be committed together
+// every assignment has to pass driver and vehicle availability validators,
+// assignments must not overlap each other and drivers and vehicles need layover between trips
+func (r *RosterCommitSerializer) Valid() bool {
+	if len(r.Assignments) == 0 {
+		r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "RosterErr", Desc: "Roster has no assignments"})
+		return false
+	}
+	layover_minutes := RosterDefaultLayover
+	if r.Layover != nil {
+		layover_minutes = *r.Layover
+	}
+	if layover_minutes < 0 || layover_minutes > 24*60 {
+		r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "RosterErr", Desc: "Layover must be between 0 and 1440 minutes"})
+		return false
+	}
+	in_maintenance, err := validators.Vehicles_in_maintenance()
+	if err != nil {
+		r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "DatabaseErr", Desc: err.Error()})
+		return false
+	}
+	drivers := map[uint][]rosterTrip{}
+	vehicles := map[string][]rosterTrip{}
+	seen := map[uint]bool{}
+	r.connections = []models.Connection{}
+	for _, assignment := range r.Assignments {
+		if seen[assignment.ConnectionID] {
+			r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "RosterErr", Desc: fmt.Sprintf("Connection %d is assigned more than once", assignment.ConnectionID)})
+			return false
+		}
+		seen[assignment.ConnectionID] = true
+		connection := models.Connection{}
+		res := utils.DB.Find(&connection, "id = ?", assignment.ConnectionID)
+		if res.Error != nil {
+			r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "DatabaseErr", Desc: res.Error.Error()})
+			return false
+		}
+		if res.RowsAffected == 0 {
+			r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "RosterErr", Desc: fmt.Sprintf("Connection %d does not exist", assignment.ConnectionID)})
+			return false
+		}
+		if connection.Status == models.CancelledConnection || connection.Status == models.CompletedConnection {
+			r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "RosterErr", Desc: fmt.Sprintf("Connection %d is %s", connection.ID, connection.Status)})
+			return false
+		}
+		validators.Driver_id_validator(assignment.DriverID, &r.ValidatorErrs)
+		validators.Vehicle_registration_validator(assignment.VehicleReg, &r.ValidatorErrs)
+		if assignment.VehicleReg != nil && in_maintenance[*assignment.VehicleReg] {
+			r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "RosterErr", Desc: fmt.Sprintf("Vehicle %s is in maintenance", *assignment.VehicleReg)})
+		}
+		if len(r.ValidatorErrs) != 0 {
+			return false
+		}
+		departure := connection.DepartureTime.Format("2006-01-02 15:04")
+		validators.Line_vehicle_validator(connection.LineName, assignment.VehicleReg, &r.ValidatorErrs)
+		validators.Driver_availability(int(connection.ID), assignment.DriverID, departure, connection.ArrivalTime, 1, &r.ValidatorErrs)
+		validators.Vehicle_availability(int(connection.ID), assignment.VehicleReg, departure, connection.ArrivalTime, 1, &r.ValidatorErrs)
+		// driver or vehicle kept on connection has to fit the newly assigned one
+		driver, vehicle := connection.DriverID, connection.VehicleRegistration
+		if assignment.DriverID != nil {
+			driver = assignment.DriverID
+		}
+		if assignment.VehicleReg != nil {
+			vehicle = assignment.VehicleReg
+		}
+		validators.Driver_qualification_validator(driver, vehicle, connection.LineName, connection.DepartureTime, connection.ArrivalTime, &r.ValidatorErrs)
+		if len(r.ValidatorErrs) != 0 {
+			return false
+		}
+		trip := rosterTrip{departure: connection.DepartureTime, arrival: connection.ArrivalTime}
+		if assignment.DriverID != nil {
+			resource := rosterResource{trips: drivers[*assignment.DriverID]}
+			if !resource.available(trip, 0) {
+				r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "DriverAvailability", Desc: fmt.Sprintf("Driver is assigned to overlapping connections in roster (connection %d)", connection.ID)})
+				return false
+			}
+			drivers[*assignment.DriverID] = append(drivers[*assignment.DriverID], trip)
+			connection.DriverID = assignment.DriverID
+		}
+		if assignment.VehicleReg != nil {
+			resource := rosterResource{trips: vehicles[*assignment.VehicleReg]}
+			if !resource.available(trip, 0) {
+				r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "VehicleAvailability", Desc: fmt.Sprintf("Vehicle is assigned to overlapping connections in roster (connection %d)", connection.ID)})
+				return false
+			}
+			vehicles[*assignment.VehicleReg] = append(vehicles[*assignment.VehicleReg], trip)
+			connection.VehicleRegistration = assignment.VehicleReg
+		}
+		r.connections = append(r.connections, connection)
+	}
+	if !r.keepsLayover(time.Duration(layover_minutes) * time.Minute) {
+		return false
+	}
+	rostered := []models.Connection{}
+	for i, assignment := range r.Assignments {
+		if assignment.DriverID != nil {
+			rostered = append(rostered, r.connections[i])
+		}
+	}
+	validators.Connections_working_time(rostered, &r.ValidatorErrs)
+	return len(r.ValidatorErrs) == 0
+}
+
+// keepsLayover checks if every driver and vehicle of roster arrives from previous trip at least layover
+// before next departure, their other assigned connections not changed by roster are checked as well
+func (r *RosterCommitSerializer) keepsLayover(layover time.Duration) bool {
+	ids := []uint{}
+	drivers := map[uint][]models.Connection{}
+	vehicles := map[string][]models.Connection{}
+	from, to := r.connections[0].DepartureTime, r.connections[0].ArrivalTime
+	for _, connection := range r.connections {
+		ids = append(ids, connection.ID)
+		if connection.DepartureTime.Before(from) {
+			from = connection.DepartureTime
+		}
+		if connection.ArrivalTime.After(to) {
+			to = connection.ArrivalTime
+		}
+		if connection.DriverID != nil {
+			drivers[*connection.DriverID] = append(drivers[*connection.DriverID], connection)
+		}
+		if connection.VehicleRegistration != nil {
+			vehicles[*connection.VehicleRegistration] = append(vehicles[*connection.VehicleRegistration], connection)
+		}
+	}
+	driver_ids := []uint{}
+	for id := range drivers {
+		driver_ids = append(driver_ids, id)
+	}
+	registrations := []string{}
+	for registration := range vehicles {
+		registrations = append(registrations, registration)
+	}
+	var others []models.Connection
+	res := utils.DB.Where("id NOT IN ? AND status <> ? AND departure_time < ? AND arrival_time > ? AND (driver_id IN ? OR vehicle_registration IN ?)",
+		ids, models.CancelledConnection, to.Add(layover), from.Add(-layover), driver_ids, registrations).Find(&others)
+	if res.Error != nil {
+		r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "DatabaseErr", Desc: res.Error.Error()})
+		return false
+	}
+	for _, other := range others {
+		if other.DriverID != nil && drivers[*other.DriverID] != nil {
+			drivers[*other.DriverID] = append(drivers[*other.DriverID], other)
+		}
+		if other.VehicleRegistration != nil && vehicles[*other.VehicleRegistration] != nil {
+			vehicles[*other.VehicleRegistration] = append(vehicles[*other.VehicleRegistration], other)
+		}
+	}
+	for _, connection := range r.connections {
+		if connection.DriverID != nil {
+			if other := layover_conflict(connection, drivers[*connection.DriverID], layover); other != nil {
+				r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "DriverAvailability", Desc: fmt.Sprintf("Driver has less than %d minutes between connections %d and %d", int(layover.Minutes()), connection.ID, other.ID)})
+				return false
+			}
+		}
+		if connection.VehicleRegistration != nil {
+			if other := layover_conflict(connection, vehicles[*connection.VehicleRegistration], layover); other != nil {
+				r.ValidatorErrs = append(r.ValidatorErrs, validators.ValidatorErr{Name: "VehicleAvailability", Desc: fmt.Sprintf("Vehicle has less than %d minutes between connections %d and %d", int(layover.Minutes()), connection.ID, other.ID)})
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// layover_conflict returns other trip of the same driver or vehicle which does not keep layover with connection,
+// previous trip has to arrive at least layover before next one departs
+func layover_conflict(connection models.Connection, trips []models.Connection, layover time.Duration) *models.Connection {
+	for i := range trips {
+		other := &trips[i]
+		if other.ID == connection.ID {
+			continue
+		}
+		if other.DepartureTime.Before(connection.ArrivalTime.Add(layover)) && connection.DepartureTime.Before(other.ArrivalTime.Add(layover)) {
+			return other
+		}
+	}
+	return nil
+}
+
+// Commit assigns drivers and vehicles of all assignments in one transaction
+// Valid has to be called before
+func (r *RosterCommitSerializer) Commit() error {
+	return utils.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range r.connections {
+			res := tx.Model(&r.connections[i]).Select("DriverID", "VehicleRegistration").Updates(&r.connections[i])
+			if res.Error != nil {
+				return res.Error
+			}
+		}
+		return nil
+	})
+}
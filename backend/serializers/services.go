@@ -0,0 +1,281 @@
+// package serializers holds structures and functions for serializing data
+// this file contains serializers for recurring services
+package serializers
+
+import (
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+	"gorm.io/gorm/clause"
+)
+
+// ServiceHorizonDays is number of days connections of services are generated ahead
+const ServiceHorizonDays = 30
+
+// ServiceMaxDays is maximal number of days generated at once
+const ServiceMaxDays = 365
+
+// ServiceGenerateInterval is how often server generates connections of services ServiceHorizonDays ahead
+const ServiceGenerateInterval = 6 * time.Hour
+
+// ServiceSerializer is used to serialize data about recurring service
+// it is used in GET request to get data about service
+type ServiceSerializer struct {
+	ID            uint
+	LineName      string
+	DepartureTime string
+	Direction     bool
+	Weekdays      []string
+	ValidFrom     string
+	ValidTo       *string
+	VehicleReg    *string
+	DriverID      *uint
+	Exceptions    []ServiceExceptionSerializer
+}
+
+// ServiceExceptionSerializer is used to serialize day added to or removed from service
+type ServiceExceptionSerializer struct {
+	Date string `binding:"required"`
+	Type string `binding:"required"`
+}
+
+// ServiceUpdateSerializer is used to serialize data for updating whole service
+// it is used in PATCH request to update service and its future connections
+type ServiceUpdateSerializer struct {
+	DepartureTime string `binding:"required"`
+	Direction     bool
+	Weekdays      []string
+	ValidFrom     string `binding:"required"`
+	ValidTo       string
+	Exceptions    []ServiceExceptionSerializer
+	VehicleReg    *string
+	DriverID      *uint
+	ValidatorErrs []validators.ValidatorErr
+}
+
+// ServiceGenerateSerializer is used to serialize date connections of services are generated until
+type ServiceGenerateSerializer struct {
+	Until string `binding:"required"`
+}
+
+// FromModel loads data from model into serializer
+func (s *ServiceSerializer) FromModel(service *models.Service) {
+	s.ID = service.ID
+	s.LineName = service.LineName
+	s.DepartureTime = service.DepartureTime
+	s.Direction = service.Direction
+	s.Weekdays = Weekday_names(service.Weekdays)
+	s.ValidFrom = service.ValidFrom.Format("2006-01-02")
+	s.ValidTo = nil
+	if service.ValidTo != nil {
+		valid_to := service.ValidTo.Format("2006-01-02")
+		s.ValidTo = &valid_to
+	}
+	s.VehicleReg = service.VehicleRegistration
+	s.DriverID = service.DriverID
+	s.Exceptions = []ServiceExceptionSerializer{}
+	for _, exception := range service.Exceptions {
+		s.Exceptions = append(s.Exceptions, ServiceExceptionSerializer{
+			Date: exception.Date.Format("2006-01-02"),
+			Type: string(exception.Type),
+		})
+	}
+}
+
+// Valid checks if data for updating service are valid
+func (s *ServiceUpdateSerializer) Valid() bool {
+	validators.Service_time_validator(s.DepartureTime, &s.ValidatorErrs)
+	validators.Weekdays_validator(s.Weekdays, &s.ValidatorErrs)
+	validators.Service_dates_validator(s.ValidFrom, s.ValidTo, &s.ValidatorErrs)
+	for _, exception := range s.Exceptions {
+		validators.Service_exception_validator(exception.Date, exception.Type, &s.ValidatorErrs)
+	}
+	validators.Vehicle_registration_validator(s.VehicleReg, &s.ValidatorErrs)
+	validators.Driver_id_validator(s.DriverID, &s.ValidatorErrs)
+	return len(s.ValidatorErrs) == 0
+}
+
+// UpdateModel loads data from serializer into service model
+// exceptions of service are replaced
+func (s *ServiceUpdateSerializer) UpdateModel(service *models.Service) {
+	service.DepartureTime = s.DepartureTime
+	service.Direction = s.Direction
+	service.Weekdays = Weekday_mask(s.Weekdays)
+	service.ValidFrom, _ = time.Parse("2006-01-02", s.ValidFrom)
+	service.ValidTo = nil
+	if s.ValidTo != "" {
+		valid_to, _ := time.Parse("2006-01-02", s.ValidTo)
+		service.ValidTo = &valid_to
+	}
+	service.VehicleRegistration = s.VehicleReg
+	service.DriverID = s.DriverID
+	service.Exceptions = Service_exceptions(s.Exceptions)
+}
+
+// Weekday_mask converts weekday names into weekday mask, no weekdays means every day
+func Weekday_mask(weekdays []string) uint8 {
+	if len(weekdays) == 0 {
+		return models.AllWeekdays
+	}
+	var mask uint8
+	for _, weekday := range weekdays {
+		for i, name := range models.WeekdayNames {
+			if weekday == name {
+				mask |= 1 << i
+			}
+		}
+	}
+	return mask
+}
+
+// Weekday_names converts weekday mask into weekday names
+func Weekday_names(mask uint8) []string {
+	weekdays := []string{}
+	for i, name := range models.WeekdayNames {
+		if mask&(1<<i) != 0 {
+			weekdays = append(weekdays, name)
+		}
+	}
+	return weekdays
+}
+
+// Service_exceptions converts serialized exceptions into models
+func Service_exceptions(exceptions []ServiceExceptionSerializer) []models.ServiceException {
+	exception_models := []models.ServiceException{}
+	for _, exception := range exceptions {
+		date, _ := time.Parse("2006-01-02", exception.Date)
+		exception_models = append(exception_models, models.ServiceException{
+			Date: date,
+			Type: models.ExceptionType(exception.Type),
+		})
+	}
+	return exception_models
+}
+
+// Service_day returns day of given time as date without time
+func Service_day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Service_departure returns departure time of service on given day
+func Service_departure(service *models.Service, day time.Time) (time.Time, error) {
+	return time.Parse("2006-01-02 15:04", day.Format("2006-01-02")+" "+service.DepartureTime)
+}
+
+// Service_connections creates connections of service for days between from and to
+// days which already have connection of the service are skipped
+func Service_connections(service *models.Service, from time.Time, to time.Time) ([]models.Connection, error) {
+	connections := []models.Connection{}
+	generated := map[string]bool{}
+	if service.ID != 0 {
+		var existing []models.Connection
+		if res := utils.DB.Where("service_id = ?", service.ID).Find(&existing); res.Error != nil {
+			return nil, res.Error
+		}
+		for _, connection := range existing {
+			if connection.ServiceDay != nil {
+				generated[connection.ServiceDay.Format("2006-01-02")] = true
+			}
+		}
+	}
+	from = Service_day(from)
+	to = Service_day(to)
+	if max_to := from.AddDate(0, 0, ServiceMaxDays-1); to.After(max_to) {
+		to = max_to
+	}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if !service.RunsOn(day) || generated[day.Format("2006-01-02")] {
+			continue
+		}
+		departure, err := Service_departure(service, day)
+		if err != nil {
+			return nil, err
+		}
+		service_day := day
+		connection := models.Connection{
+			LineName:            service.LineName,
+			Direction:           service.Direction,
+			DepartureTime:       departure,
+			ArrivalTime:         Get_arrival_time(departure, service.LineName, service.Direction),
+			VehicleRegistration: service.VehicleRegistration,
+			DriverID:            service.DriverID,
+			ServiceDay:          &service_day,
+		}
+		if service.ID != 0 {
+			connection.ServiceID = &service.ID
+		}
+		connections = append(connections, connection)
+	}
+	return connections, nil
+}
+
+// Service_generation_range returns days connections of service should be generated for
+// from today or start of service until given day or end of service
+func Service_generation_range(service *models.Service, until time.Time) (from time.Time, to time.Time) {
+	from = Service_day(utils.Wall_clock_now())
+	if service.ValidFrom.After(from) {
+		from = Service_day(service.ValidFrom)
+	}
+	to = Service_day(until)
+	if service.ValidTo != nil && service.ValidTo.Before(to) {
+		to = Service_day(*service.ValidTo)
+	}
+	return
+}
+
+// Generate_service_connections generates missing connections of all services until given day
+// driver and vehicle of service are assigned only if they are available,
+// driver also has to keep working time rules
+// connections already generated by other process are skipped thanks to unique service and departure
+// it is run only by server periodically, by generate endpoint and command, never by listings
+// returns number of created connections
+func Generate_service_connections(until time.Time) (int, error) {
+	var services []models.Service
+	if res := utils.DB.Preload("Exceptions").Find(&services); res.Error != nil {
+		return 0, res.Error
+	}
+	created := 0
+	for i := range services {
+		from, to := Service_generation_range(&services[i], until)
+		if to.Before(from) {
+			continue
+		}
+		connections, err := Service_connections(&services[i], from, to)
+		if err != nil {
+			return created, err
+		}
+		for _, connection := range connections {
+			res := utils.DB.Where("line_name = ? AND departure_time = ?", connection.LineName, connection.DepartureTime).Find(&models.Connection{})
+			if res.Error != nil {
+				return created, res.Error
+			}
+			if res.RowsAffected != 0 {
+				continue
+			}
+			validator_errs := []validators.ValidatorErr{}
+			departure := connection.DepartureTime.Format("2006-01-02 15:04")
+			validators.Vehicle_availability(-1, connection.VehicleRegistration, departure, connection.ArrivalTime, 1, &validator_errs)
+			validators.Line_vehicle_validator(connection.LineName, connection.VehicleRegistration, &validator_errs)
+			if len(validator_errs) != 0 {
+				connection.VehicleRegistration = nil
+				validator_errs = []validators.ValidatorErr{}
+			}
+			validators.Driver_qualification_validator(connection.DriverID, connection.VehicleRegistration, connection.LineName, connection.DepartureTime, connection.ArrivalTime, &validator_errs)
+			validators.Driver_availability(-1, connection.DriverID, departure, connection.ArrivalTime, 1, &validator_errs)
+			validators.Connections_working_time([]models.Connection{connection}, &validator_errs)
+			if len(validator_errs) != 0 {
+				connection.DriverID = nil
+			}
+			res = utils.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&connection)
+			if res.Error != nil {
+				return created, res.Error
+			}
+			if res.RowsAffected != 0 {
+				created++
+			}
+		}
+	}
+	return created, nil
+}
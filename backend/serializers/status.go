@@ -0,0 +1,114 @@
+// package serializers holds structures and functions for serializing data
+// this file contains serializers for status of connections
+package serializers
+
+import (
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+	"gorm.io/gorm"
+)
+
+// PublicConnections is condition for connections shown to not registered users
+// connections without driver or vehicle are hidden unless they were cancelled
+const PublicConnections = "((driver_id IS NOT NULL AND vehicle_registration IS NOT NULL) OR status = 'cancelled')"
+
+// ConnectionStatusSerializer is used to serialize status change of connection
+// it is used in PATCH request to cancel, partially cancel, delay, complete or reinstate connection
+// CancelledFrom and CancelledTo are first and last stop not served by partially cancelled connection,
+// only one of them cancels connection from given stop to final stop or from initial stop to given stop
+type ConnectionStatusSerializer struct {
+	Status        string `binding:"required"`
+	Reason        *string
+	MalfuncRepID  *uint
+	CancelledFrom *string
+	CancelledTo   *string
+	ValidatorErrs []validators.ValidatorErr
+	from          *int
+	to            *int
+}
+
+// Valid checks if status change of given connection is valid
+func (s *ConnectionStatusSerializer) Valid(connection *models.Connection) bool {
+	validators.Connection_status_validator(connection.Status, s.Status, &s.ValidatorErrs)
+	validators.Malfunction_report_validator(s.MalfuncRepID, &s.ValidatorErrs)
+	if len(s.ValidatorErrs) != 0 || (s.CancelledFrom == nil && s.CancelledTo == nil) {
+		return len(s.ValidatorErrs) == 0
+	}
+	status := models.ConnectionStatus(s.Status)
+	if status != models.ScheduledConnection && status != models.DelayedConnection {
+		s.ValidatorErrs = append(s.ValidatorErrs, validators.ValidatorErr{Name: "StatusErr", Desc: "Only scheduled or delayed connection can be partially cancelled"})
+		return false
+	}
+	stops, err := Get_connection_stops(connection.LineName, connection.Direction, connection.DepartureTime)
+	if err != nil {
+		s.ValidatorErrs = append(s.ValidatorErrs, validators.ValidatorErr{Name: "DatabaseErr", Desc: err.Error()})
+		return false
+	}
+	from, to := 0, len(stops)-1
+	if s.CancelledFrom != nil {
+		from = Realtime_stop_index(stops, *s.CancelledFrom, -1)
+	}
+	if s.CancelledTo != nil {
+		to = Realtime_stop_index(stops, *s.CancelledTo, from-1)
+	}
+	if from == -1 || to == -1 {
+		s.ValidatorErrs = append(s.ValidatorErrs, validators.ValidatorErr{Name: "StatusErr", Desc: "Cancelled stops are not in connection or are not in order"})
+		return false
+	}
+	if len(stops)-(to-from+1) < 2 {
+		s.ValidatorErrs = append(s.ValidatorErrs, validators.ValidatorErr{Name: "StatusErr", Desc: "Partially cancelled connection has to serve at least two stops, cancel whole connection instead"})
+		return false
+	}
+	s.from, s.to = &from, &to
+	return true
+}
+
+// UpdateModel loads status change into connection model
+// range of cancelled stops is cleared when it is not given, malfunction report is kept when it is not given
+// Valid has to be called before
+func (s *ConnectionStatusSerializer) UpdateModel(connection *models.Connection) {
+	connection.Status = models.ConnectionStatus(s.Status)
+	connection.StatusReason = s.Reason
+	// scheduled connection is left to real-time data again
+	connection.StatusManual = connection.Status != models.ScheduledConnection
+	if s.MalfuncRepID != nil {
+		connection.MalfuncRepRef = s.MalfuncRepID
+	}
+	connection.CancelledFromStop = s.from
+	connection.CancelledToStop = s.to
+}
+
+// Flag_vehicle_connections flags connections of vehicle from malfunction report departing until end of today
+// by the report, so they are listed for reassignment to other vehicle, their status is left for dispatcher
+// connections which already departed are not flagged, returns ids of flagged connections
+func Flag_vehicle_connections(tx *gorm.DB, malfunc_report *models.MalfunctionReport) ([]uint, error) {
+	now := utils.Wall_clock_now()
+	end_of_day := Service_day(now).AddDate(0, 0, 1)
+	var connection_ids []uint
+	res := tx.Model(&models.Connection{}).Where("vehicle_registration = ? AND departure_time >= ? AND departure_time < ? AND status IN ?",
+		malfunc_report.VehicleRef, now, end_of_day, []models.ConnectionStatus{models.ScheduledConnection, models.DelayedConnection}).
+		Pluck("id", &connection_ids)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if len(connection_ids) == 0 {
+		return connection_ids, nil
+	}
+	res = tx.Model(&models.Connection{}).Where("id IN ?", connection_ids).Update("reassign_malfunc_ref", malfunc_report.ID)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	return connection_ids, nil
+}
+
+// Final_stop_index returns index of last stop served by connection with given number of stops,
+// -1 if it serves no stop
+func Final_stop_index(connection *models.Connection, stops_count int) int {
+	for i := stops_count - 1; i >= 0; i-- {
+		if !connection.StopCancelled(i) {
+			return i
+		}
+	}
+	return -1
+}
@@ -5,35 +5,81 @@ package serializers
 import (
 	"github.com/AdamPekny/IIS/backend/models"
 	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
 )
 
 // StopSerializer is used to serialize data about stop
 // it is used in GET request to get data about stop
 type StopSerializer struct {
-	ID     uint
-	Name   string
-	Active bool
+	ID         uint
+	Name       string
+	Active     bool
+	Latitude   *float64
+	Longitude  *float64
+	Platform   *string
+	Accessible bool
+	Zone       *string
+	ParentID   *uint    // station of platform
+	Station    *string  // name of station of platform
+	Platforms  []string // names of platforms of station
 }
 
 // EditConnection is used to serialize data about stop in connection
 // it is used in PUT request to get data about stop in connection
 type EditStopSerializer struct {
-	ID   uint
-	Name string
+	ID            uint
+	Name          string
+	Latitude      *float64
+	Longitude     *float64
+	Platform      *string
+	Accessible    bool
+	Zone          *string
+	ParentID      *uint
+	ValidatorErrs []validators.ValidatorErr
 }
 
 // StopCreateSerializer is used to serialize data about stop
 // it is used in POST request to create a new stop
 type StopCreateRequest struct {
-	Name string `binding:"required"`
+	Name          string `binding:"required"`
+	Latitude      *float64
+	Longitude     *float64
+	Platform      *string
+	Accessible    bool
+	Zone          *string
+	ParentID      *uint
+	ValidatorErrs []validators.ValidatorErr
 }
 
 // FromModel is used to serialize data about stop
 func (s *StopSerializer) FromModel(stop models.Stop) error {
 	s.ID = stop.ID
 	s.Name = stop.Name
+	s.Latitude = stop.Latitude
+	s.Longitude = stop.Longitude
+	s.Platform = stop.Platform
+	s.Accessible = stop.Accessible
+	s.Zone = stop.Zone
+	s.ParentID = stop.ParentID
+	if stop.ParentID != nil {
+		station := models.Stop{}
+		if result := utils.DB.First(&station, *stop.ParentID); result.Error != nil {
+			return result.Error
+		}
+		s.Station = &station.Name
+	}
+	var platforms []models.Stop
+	if result := utils.DB.Where("parent_id = ?", stop.ID).Order("name").Find(&platforms); result.Error != nil {
+		return result.Error
+	}
+	s.Platforms = []string{}
+	for _, platform := range platforms {
+		s.Platforms = append(s.Platforms, platform.Name)
+	}
+	// station is active when any of its platforms is used by line
+	names := append([]string{stop.Name}, s.Platforms...)
 	var segments []models.Segment
-	result := utils.DB.Where("stop_name1 = ? OR stop_name2 = ?", stop.Name, stop.Name).Find(&segments)
+	result := utils.DB.Where("stop_name1 IN ? OR stop_name2 IN ?", names, names).Limit(1).Find(&segments)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -44,3 +90,84 @@ func (s *StopSerializer) FromModel(stop models.Stop) error {
 	}
 	return nil
 }
+
+// Valid validates location, platform, zone and station of edited stop
+func (s *EditStopSerializer) Valid() bool {
+	stop_validator(s.Latitude, s.Longitude, s.Platform, s.Zone, &s.ValidatorErrs)
+	validators.Stop_parent_validator(s.ID, s.ParentID, &s.ValidatorErrs)
+	return len(s.ValidatorErrs) == 0
+}
+
+// ToModel loads edited data into existing stop
+func (s *EditStopSerializer) ToModel(stop *models.Stop) {
+	stop.Name = s.Name
+	stop.Latitude = s.Latitude
+	stop.Longitude = s.Longitude
+	stop.Platform = s.Platform
+	stop.Accessible = s.Accessible
+	stop.Zone = s.Zone
+	stop.ParentID = s.ParentID
+}
+
+// Valid validates location, platform, zone and station of new stop
+func (s *StopCreateRequest) Valid() bool {
+	stop_validator(s.Latitude, s.Longitude, s.Platform, s.Zone, &s.ValidatorErrs)
+	validators.Stop_parent_validator(0, s.ParentID, &s.ValidatorErrs)
+	return len(s.ValidatorErrs) == 0
+}
+
+// ToModel creates new stop from data
+func (s *StopCreateRequest) ToModel() models.Stop {
+	return models.Stop{
+		Name:       s.Name,
+		Latitude:   s.Latitude,
+		Longitude:  s.Longitude,
+		Platform:   s.Platform,
+		Accessible: s.Accessible,
+		Zone:       s.Zone,
+		ParentID:   s.ParentID,
+	}
+}
+
+func stop_validator(latitude *float64, longitude *float64, platform *string, zone *string, validator_errs *[]validators.ValidatorErr) {
+	validators.Stop_coordinates_validator(latitude, longitude, validator_errs)
+	validators.Stop_code_validator("Platform", platform, validator_errs)
+	validators.Stop_code_validator("Zone", zone, validator_errs)
+}
+
+// Stop_stations maps name of every stop to name of its station, stops which are not platforms are their own stations
+func Stop_stations() (map[string]string, error) {
+	var stops []models.Stop
+	if result := utils.DB.Find(&stops); result.Error != nil {
+		return nil, result.Error
+	}
+	names := map[uint]string{}
+	for _, stop := range stops {
+		names[stop.ID] = stop.Name
+	}
+	stations := map[string]string{}
+	for _, stop := range stops {
+		stations[stop.Name] = stop.Name
+		if stop.ParentID != nil {
+			stations[stop.Name] = names[*stop.ParentID]
+		}
+	}
+	return stations, nil
+}
+
+// Station_stops loads station of stop and names of all stops passengers can use at it, i.e. station and its platforms
+func Station_stops(stop models.Stop) (station models.Stop, stop_names []string, err error) {
+	station = stop
+	if stop.ParentID != nil {
+		if err = utils.DB.First(&station, *stop.ParentID).Error; err != nil {
+			return
+		}
+	}
+	stop_names = []string{station.Name}
+	var platforms []string
+	if err = utils.DB.Model(&models.Stop{}).Where("parent_id = ?", station.ID).Order("name").Pluck("name", &platforms).Error; err != nil {
+		return
+	}
+	stop_names = append(stop_names, platforms...)
+	return
+}
@@ -11,10 +11,10 @@ import (
 // it is used in POST request to create a new vehicle
 type VehicleSerializer struct {
 	//Registration string `binding:"required"`
-	Capacity     uint   `binding:"required"`
-	Registration string `binding:"required"`
-	Brand        string
-	//ImageData     []byte
+	Capacity      uint   `binding:"required"`
+	Registration  string `binding:"required"`
+	Brand         string
+	ImageData     []byte // optional photo of vehicle, base64 in JSON
 	Type          string `binding:"required"`
 	ValidatorErrs []validators.ValidatorErr
 }
@@ -22,10 +22,11 @@ type VehicleSerializer struct {
 // VehicleGetSerializer is used to serialize data from database about vehicle
 // it is used in GET request to get data about vehicle
 type VehicleGetSerializer struct {
-	Registration string
-	Capacity     uint
-	Brand        string
-	//image lol
+	Registration    string
+	Capacity        uint
+	Brand           string
+	ImageURL        *string // photo of vehicle, nil without photo
+	ThumbnailURL    *string
 	Type            string
 	LastMaintenance LastMaintenance
 }
@@ -33,16 +34,18 @@ type VehicleGetSerializer struct {
 // VehicleTypeSerializer is used to serialize data about vehicle type
 // it is used in GET request to get data about vehicle type
 type VehicleTypeSerializer struct {
-	Type   string
-	Active bool
-	//IconPath string `binding:"required"`
+	Type             string
+	Active           bool
+	IconURL          *string // icon of vehicle type, nil without icon
+	IconThumbnailURL *string
 }
 
 // VehicleTypeGetSerializer is used to serialize data about vehicle
 // it is used in POST request to create a new vehicle
 type VehicleTypeCreateSerializer struct {
-	Type string `binding:"required"`
-	//IconPath string `binding:"required"`
+	Type          string `binding:"required"`
+	IconData      []byte // optional icon, base64 in JSON
+	ValidatorErrs []validators.ValidatorErr
 }
 
 // LastMaintenance is used to serialize data about last maintenance
@@ -54,9 +57,9 @@ type LastMaintenance struct {
 // VehicleUpdateSerializer is used to serialize data about vehicle
 // it is used in PUT request to update a vehicle
 type VehicleUpdateSerializer struct {
-	Capacity uint `binding:"required"`
-	Brand    string
-	//image lol
+	Capacity      uint `binding:"required"`
+	Brand         string
+	ImageData     []byte // replaces photo of vehicle when given, base64 in JSON
 	Type          string `binding:"required"`
 	ValidatorErrs []validators.ValidatorErr
 }
@@ -65,10 +68,9 @@ type VehicleUpdateSerializer struct {
 // it is used in POST request to create a new vehicle model
 func (vehicle VehicleSerializer) Create_model() (vehicle_model *models.Vehicle) {
 	vehicle_model = &models.Vehicle{
-		Capacity:     vehicle.Capacity,
-		Registration: vehicle.Registration,
-		Brand:        vehicle.Brand,
-		//ImageData:       vehicle.ImageData,
+		Capacity:        vehicle.Capacity,
+		Registration:    vehicle.Registration,
+		Brand:           vehicle.Brand,
 		VehicleTypeName: vehicle.Type,
 	}
 	return
@@ -77,6 +79,7 @@ func (vehicle VehicleSerializer) Create_model() (vehicle_model *models.Vehicle)
 // Valid validates the data from serializer
 func (vehicle *VehicleUpdateSerializer) Valid() bool {
 	validators.Vehicle_type_validator(vehicle.Type, &vehicle.ValidatorErrs)
+	validators.Image_validator(vehicle.ImageData, &vehicle.ValidatorErrs)
 	return len(vehicle.ValidatorErrs) == 0
 }
 
@@ -84,9 +87,16 @@ func (vehicle *VehicleUpdateSerializer) Valid() bool {
 func (vehicle *VehicleSerializer) Valid() bool {
 	validators.Registration_validator(vehicle.Registration, &vehicle.ValidatorErrs)
 	validators.Vehicle_type_validator(vehicle.Type, &vehicle.ValidatorErrs)
+	validators.Image_validator(vehicle.ImageData, &vehicle.ValidatorErrs)
 	return len(vehicle.ValidatorErrs) == 0
 }
 
+// Valid validates icon of vehicle type
+func (vehicle_type *VehicleTypeCreateSerializer) Valid() bool {
+	validators.Image_validator(vehicle_type.IconData, &vehicle_type.ValidatorErrs)
+	return len(vehicle_type.ValidatorErrs) == 0
+}
+
 // VehicleMaintenanceSerializer is used to serialize data about vehicle
 // it is used in GET request to get data about vehicle
 type VehicleMaintenanceSerializer struct {
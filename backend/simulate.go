@@ -0,0 +1,88 @@
+// package api contains api implementation for backend
+// this file contains simulated feed of real-time vehicle data
+package api
+
+import (
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// simulatedMaxDelay is maximal delay of simulated vehicle in minutes
+const simulatedMaxDelay = 5
+
+// SimulateRealtime reports departures of running connections as AVL gateway would
+// every connection gets random delay which it keeps during the whole ride,
+// with once set only one round of departures is reported
+func SimulateRealtime(interval time.Duration, once bool) error {
+	delays := map[uint]time.Duration{}
+	for {
+		now := utils.Wall_clock_now()
+		var connections []models.Connection
+		res := utils.DB.Where("driver_id IS NOT NULL AND vehicle_registration IS NOT NULL AND departure_time <= ? AND arrival_time >= ? AND status IN ?",
+			now, now.Add(-simulatedMaxDelay*time.Minute), []models.ConnectionStatus{models.ScheduledConnection, models.DelayedConnection}).Find(&connections)
+		if res.Error != nil {
+			return res.Error
+		}
+		for i := range connections {
+			connection := &connections[i]
+			delay, ok := delays[connection.ID]
+			if !ok {
+				delay = time.Duration(rand.Intn(simulatedMaxDelay+2)-1) * time.Minute
+				delays[connection.ID] = delay
+			}
+			stops, err := serializers.Get_connection_stops(connection.LineName, connection.Direction, connection.DepartureTime)
+			if err != nil {
+				return err
+			}
+			next := 0
+			if connection.LastStopIndex != nil {
+				next = *connection.LastStopIndex + 1
+			}
+			// vehicle does not depart from final stop and passes cancelled stops
+			final := serializers.Final_stop_index(connection, len(stops))
+			for ; next < final; next++ {
+				departed := stops[next].DepartureTime.Add(delay)
+				if departed.After(now) {
+					break
+				}
+				if connection.StopCancelled(next) {
+					continue
+				}
+				if err := simulateEvent(connection, models.DepartedEvent, stops[next].StopName, departed); err != nil {
+					return err
+				}
+				log.Printf("connection %d departed %s with delay %v", connection.ID, stops[next].StopName, delay)
+			}
+			// arrival to final stop completes the connection
+			if next == final && !stops[final].ArrivalTime.Add(delay).After(now) {
+				if err := simulateEvent(connection, models.PositionEvent, stops[final].StopName, stops[final].ArrivalTime.Add(delay)); err != nil {
+					return err
+				}
+				log.Printf("connection %d arrived to %s with delay %v", connection.ID, stops[final].StopName, delay)
+			}
+		}
+		if once {
+			return nil
+		}
+		time.Sleep(interval)
+	}
+}
+
+// simulateEvent records event of given type in stop at given time for connection
+func simulateEvent(connection *models.Connection, event_type models.RealtimeEventType, stop_name string, event_time time.Time) error {
+	event := serializers.RealtimeEventSerializer{
+		Type:     string(event_type),
+		StopName: &stop_name,
+		Time:     event_time.Format("2006-01-02 15:04:05"),
+	}
+	event_model, err := event.CreateModel(connection)
+	if err != nil {
+		return err
+	}
+	return serializers.Record_realtime_event(connection, event_model)
+}
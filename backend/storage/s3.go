@@ -0,0 +1,162 @@
+// package storage contains storage of uploaded files
+// this file contains storage in S3-compatible service using path-style requests signed by AWS signature version 4
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// S3Storage stores objects in bucket of S3-compatible service, e.g. MinIO
+type S3Storage struct {
+	Endpoint  string // e.g. http://localhost:9000
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+// NewS3StorageFromEnv creates S3 storage from S3_ENDPOINT, S3_BUCKET, S3_REGION (us-east-1 by default),
+// S3_ACCESS_KEY and S3_SECRET_KEY environment variables
+func NewS3StorageFromEnv() (*S3Storage, error) {
+	s := &S3Storage{
+		Endpoint:  strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+		Bucket:    os.Getenv("S3_BUCKET"),
+		Region:    os.Getenv("S3_REGION"),
+		AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_SECRET_KEY"),
+		Client:    &http.Client{Timeout: time.Minute},
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.Endpoint == "" || s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+		return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY are required for s3 storage")
+	}
+	return s, nil
+}
+
+func (s *S3Storage) PutObject(key string, body io.Reader, size int64, content_type string) error {
+	request, err := s.request(http.MethodPut, key, io.LimitReader(body, size))
+	if err != nil {
+		return err
+	}
+	request.ContentLength = size
+	request.Header.Set("Content-Type", content_type)
+	response, err := s.do(request)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+func (s *S3Storage) GetObject(key string) (io.ReadCloser, error) {
+	request, err := s.request(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.do(request)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+func (s *S3Storage) DeleteObject(key string) error {
+	request, err := s.request(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	response, err := s.do(request)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// request creates signed request for object with given key
+func (s *S3Storage) request(method string, key string, body io.Reader) (*http.Request, error) {
+	segments := strings.Split(strings.TrimLeft(key, "/"), "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	path := "/" + url.PathEscape(s.Bucket) + "/" + strings.Join(segments, "/")
+	request, err := http.NewRequest(method, s.Endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(request, path, time.Now().UTC())
+	return request, nil
+}
+
+// do sends request, missing object is returned as ErrNotFound and other failures as error with response of service
+func (s *S3Storage) do(request *http.Request) (*http.Response, error) {
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, ErrNotFound
+	}
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		response.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s %s", request.Method, request.URL.Path, response.Status, message)
+	}
+	return response, nil
+}
+
+// sign adds authorization of AWS signature version 4 to request, payload is not signed
+func (s *S3Storage) sign(request *http.Request, path string, now time.Time) {
+	amz_date := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payload := "UNSIGNED-PAYLOAD"
+	request.Header.Set("X-Amz-Date", amz_date)
+	request.Header.Set("X-Amz-Content-Sha256", payload)
+
+	signed_headers := "host;x-amz-content-sha256;x-amz-date"
+	canonical_request := strings.Join([]string{
+		request.Method,
+		path,
+		"",
+		"host:" + request.URL.Host,
+		"x-amz-content-sha256:" + payload,
+		"x-amz-date:" + amz_date,
+		"",
+		signed_headers,
+		payload,
+	}, "\n")
+	canonical_hash := sha256.Sum256([]byte(canonical_request))
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	string_to_sign := "AWS4-HMAC-SHA256\n" + amz_date + "\n" + scope + "\n" + hex.EncodeToString(canonical_hash[:])
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{date, s.Region, "s3", "aws4_request"} {
+		key = hmac_sha256(key, part)
+	}
+	signature := hex.EncodeToString(hmac_sha256(key, string_to_sign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signed_headers, signature))
+}
+
+func hmac_sha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,47 @@
+// package storage contains storage of uploaded files
+// this file contains interface of storage and its selection by configuration
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// ErrNotFound is returned when object with given key is not stored
+var ErrNotFound = errors.New("object not found")
+
+// Storage stores objects under keys, it follows object API of S3
+// so S3-compatible service or any local stand-in with the same operations can be used
+type Storage interface {
+	PutObject(key string, body io.Reader, size int64, content_type string) error
+	GetObject(key string) (io.ReadCloser, error)
+	DeleteObject(key string) error
+}
+
+var (
+	default_storage Storage
+	default_err     error
+	default_once    sync.Once
+)
+
+// Default returns storage selected by ATTACHMENT_STORAGE environment variable
+// local filesystem in ATTACHMENT_DIR is used by default, s3 uses S3_* variables
+func Default() (Storage, error) {
+	default_once.Do(func() {
+		switch os.Getenv("ATTACHMENT_STORAGE") {
+		case "s3":
+			default_storage, default_err = NewS3StorageFromEnv()
+		case "", "local":
+			dir := os.Getenv("ATTACHMENT_DIR")
+			if dir == "" {
+				dir = "attachments"
+			}
+			default_storage = NewLocalStorage(dir)
+		default:
+			default_err = errors.New("unknown ATTACHMENT_STORAGE, use local or s3")
+		}
+	})
+	return default_storage, default_err
+}
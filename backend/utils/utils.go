@@ -32,6 +32,13 @@ func Conn() {
 	}
 }
 
+// Wall_clock_now returns current local time as UTC time with the same date and time of day
+// times of timetable are stored this way, so they can be compared with it
+func Wall_clock_now() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second(), now.Nanosecond(), time.UTC)
+}
+
 type CustomDate struct {
 	*time.Time
 }
@@ -0,0 +1,54 @@
+// package validators contains functions for validating recieved data
+// this file contains validators for files attached to reports
+package validators
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/AdamPekny/IIS/backend/models"
+)
+
+// attachment_content_types lists content types of files accepted for each kind of attachment
+var attachment_content_types = map[models.AttachmentKind][]string{
+	models.PhotoAttachment:    {"image/jpeg", "image/png", "image/webp"},
+	models.InvoiceAttachment:  {"application/pdf", "image/jpeg", "image/png"},
+	models.DocumentAttachment: {"application/pdf", "image/jpeg", "image/png", "text/plain; charset=utf-8"},
+}
+
+// Attachment_max_size returns largest accepted attachment in bytes
+// it is set in megabytes by ATTACHMENT_MAX_SIZE environment variable, 10 MB by default
+func Attachment_max_size() int64 {
+	if value, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_SIZE"), 10, 64); err == nil && value > 0 {
+		return value << 20
+	}
+	return 10 << 20
+}
+
+// Attachment_validator validates kind of attachment is allowed for report and content of file matches the kind
+// content_type is detected from content of file, not taken from request
+// loads any errors into validator_errs
+func Attachment_validator(kind models.AttachmentKind, allowed_kinds []models.AttachmentKind, content_type string, size int64, validator_errs *[]ValidatorErr) {
+	allowed := false
+	for _, allowed_kind := range allowed_kinds {
+		allowed = allowed || kind == allowed_kind
+	}
+	if !allowed {
+		*validator_errs = append(*validator_errs, ValidatorErr{"AttachmentKindErr", fmt.Sprintf("Attachment of kind %s is not allowed here, use one of %v", kind, allowed_kinds)})
+		return
+	}
+	if size <= 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"AttachmentSizeErr", "File is empty"})
+	}
+	if max_size := Attachment_max_size(); size > max_size {
+		*validator_errs = append(*validator_errs, ValidatorErr{"AttachmentSizeErr", fmt.Sprintf("File is larger than %d MB", max_size>>20)})
+	}
+	valid_type := false
+	for _, allowed_type := range attachment_content_types[kind] {
+		valid_type = valid_type || content_type == allowed_type
+	}
+	if !valid_type {
+		*validator_errs = append(*validator_errs, ValidatorErr{"AttachmentTypeErr", fmt.Sprintf("File of type %s can not be attached as %s", content_type, kind)})
+	}
+}
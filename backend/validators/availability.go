@@ -0,0 +1,81 @@
+// package validators contains functions for validating recieved data
+// this file contains validators for availability of drivers and technicians
+package validators
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// Absence_type_validator validates type of absence
+func Absence_type_validator(absence_type string, validator_errs *[]ValidatorErr) {
+	switch models.AbsenceType(absence_type) {
+	case models.VacationAbsence, models.SickAbsence, models.OtherAbsence:
+		return
+	}
+	*validator_errs = append(*validator_errs, ValidatorErr{"AbsenceTypeErr", "Absence type must be vacation, sick or other"})
+}
+
+// Absence_validator checks if user is not absent at any time between start and end
+// loads any errors into validator_errs
+func Absence_validator(userID *uint, start time.Time, end time.Time, validator_errs *[]ValidatorErr) {
+	if userID == nil {
+		return
+	}
+	absence, err := user_absence(*userID, start, end)
+	if err != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", err.Error()})
+		return
+	}
+	if absence != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"Absence", "User is " + absence_desc(absence)})
+	}
+}
+
+// Technician_availability checks if technician is not absent at any time from now until deadline of maintenance request
+// request without deadline is checked only for current time
+func Technician_availability(technicianID *uint, deadline *time.Time, validator_errs *[]ValidatorErr) {
+	if technicianID == nil {
+		return
+	}
+	now := utils.Wall_clock_now()
+	end := now
+	if deadline != nil && deadline.After(now) {
+		end = *deadline
+	}
+	absence, err := user_absence(*technicianID, now, end)
+	if err != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", err.Error()})
+		return
+	}
+	if absence != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"TechnicianAvailability", "Technician is " + absence_desc(absence) + " before deadline"})
+	}
+}
+
+// user_absence returns first absence of user overlapping interval from start to end, nil if there is none
+// absence ending when interval starts or starting when it ends does not overlap
+func user_absence(userID uint, start time.Time, end time.Time) (*models.Absence, error) {
+	condition := "user_id = ? AND start_time < ? AND end_time > ?"
+	if !end.After(start) {
+		// single moment is overlapped by absence starting in it
+		condition = "user_id = ? AND start_time <= ? AND end_time > ?"
+	}
+	var absences []models.Absence
+	if res := utils.DB.Order("start_time").Limit(1).Where(condition, userID, end, start).Find(&absences); res.Error != nil {
+		return nil, res.Error
+	}
+	if len(absences) == 0 {
+		return nil, nil
+	}
+	return &absences[0], nil
+}
+
+// absence_desc describes absence for validator error
+func absence_desc(absence *models.Absence) string {
+	return fmt.Sprintf("absent (%s) from %s to %s", absence.Type,
+		absence.StartTime.Format("2006-01-02 15:04"), absence.EndTime.Format("2006-01-02 15:04"))
+}
@@ -3,6 +3,8 @@
 package validators
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/AdamPekny/IIS/backend/models"
@@ -59,6 +61,48 @@ func Driver_id_validator(id *uint, validator_errs *[]ValidatorErr) {
 	}
 }
 
+// Line_vehicle_validator checks if vehicle with given registration can operate line
+// loads any errors into validator_errs
+func Line_vehicle_validator(line_name string, registration *string, validator_errs *[]ValidatorErr) {
+	if registration == nil {
+		return
+	}
+	var line models.Line
+	res := utils.DB.Preload("VehicleTypes").Where("name = ?", line_name).Find(&line)
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	var vehicle models.Vehicle
+	res = utils.DB.Where("registration = ?", registration).Find(&vehicle)
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	Line_vehicle_compatibility(&line, &vehicle, validator_errs)
+}
+
+// Line_vehicle_compatibility checks if vehicle type is allowed on line and vehicle has enough capacity
+// line has to be loaded with its vehicle types
+func Line_vehicle_compatibility(line *models.Line, vehicle *models.Vehicle, validator_errs *[]ValidatorErr) {
+	if len(line.VehicleTypes) != 0 {
+		allowed := false
+		types := []string{}
+		for _, vehicle_type := range line.VehicleTypes {
+			allowed = allowed || vehicle_type.Type == vehicle.VehicleTypeName
+			types = append(types, vehicle_type.Type)
+		}
+		if !allowed {
+			*validator_errs = append(*validator_errs, ValidatorErr{"VehicleCompatibility",
+				fmt.Sprintf("Vehicle %s of type %s can not operate line %s, allowed types are %s", vehicle.Registration, vehicle.VehicleTypeName, line.Name, strings.Join(types, ", "))})
+		}
+	}
+	if vehicle.Capacity < line.MinCapacity {
+		*validator_errs = append(*validator_errs, ValidatorErr{"VehicleCompatibility",
+			fmt.Sprintf("Vehicle %s has capacity %d, line %s needs at least %d", vehicle.Registration, vehicle.Capacity, line.Name, line.MinCapacity)})
+	}
+}
+
 // Vehicle_availability checks if vehicle is available at given time
 func Vehicle_availability(id int, registration *string, departure_time string, arrival_time time.Time, NumberOfDays int, validator_errs *[]ValidatorErr) {
 	if registration == nil {
@@ -84,7 +128,7 @@ func Vehicle_availability(id int, registration *string, departure_time string, a
 		timeObject = timeObject.AddDate(0, 0, i)
 		arrival_time = arrival_time.AddDate(0, 0, i)
 		for _, connection := range vehicle.Connections {
-			if id != -1 && int(connection.ID) == id {
+			if (id != -1 && int(connection.ID) == id) || connection.Status == models.CancelledConnection {
 				continue
 			}
 			if (connection.DepartureTime.Before(timeObject) || connection.DepartureTime.Equal(timeObject)) && (connection.ArrivalTime.After(timeObject) || connection.ArrivalTime.Equal(timeObject)) {
@@ -125,7 +169,7 @@ func Driver_availability(id int, driverID *uint, departure_time string, arrival_
 		timeObject = timeObject.AddDate(0, 0, i)
 		arrival_time = arrival_time.AddDate(0, 0, i)
 		for _, connection := range user.Connections {
-			if id != -1 && int(connection.ID) == id {
+			if (id != -1 && int(connection.ID) == id) || connection.Status == models.CancelledConnection {
 				continue
 			}
 			if (connection.DepartureTime.Before(timeObject) || connection.DepartureTime.Equal(timeObject)) && (connection.ArrivalTime.After(timeObject) || connection.ArrivalTime.Equal(timeObject)) {
@@ -137,6 +181,53 @@ func Driver_availability(id int, driverID *uint, departure_time string, arrival_
 				return
 			}
 		}
+		// driver on leave or sick is not available either
+		absence, err := user_absence(*driverID, timeObject, arrival_time)
+		if err != nil {
+			*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", err.Error()})
+			return
+		}
+		if absence != nil {
+			*validator_errs = append(*validator_errs, ValidatorErr{"DriverAvailability", "Driver is not available at given time, driver is " + absence_desc(absence)})
+			return
+		}
+	}
+
+}
+
+// Connection_status_validator validates if connection can change from current status to new one
+// completed connections can not be changed, cancelled connections can only be reinstated
+func Connection_status_validator(current models.ConnectionStatus, status string, validator_errs *[]ValidatorErr) {
+	allowed := map[models.ConnectionStatus][]models.ConnectionStatus{
+		models.ScheduledConnection: {models.ScheduledConnection, models.DelayedConnection, models.CancelledConnection, models.CompletedConnection},
+		models.DelayedConnection:   {models.ScheduledConnection, models.DelayedConnection, models.CancelledConnection, models.CompletedConnection},
+		models.CancelledConnection: {models.ScheduledConnection, models.CancelledConnection},
+	}
+	switch models.ConnectionStatus(status) {
+	case models.ScheduledConnection, models.DelayedConnection, models.CancelledConnection, models.CompletedConnection:
+	default:
+		*validator_errs = append(*validator_errs, ValidatorErr{"StatusErr", "Status must be scheduled, delayed, cancelled or completed"})
+		return
+	}
+	for _, next := range allowed[current] {
+		if next == models.ConnectionStatus(status) {
+			return
+		}
 	}
+	*validator_errs = append(*validator_errs, ValidatorErr{"StatusErr", "Connection can not change from " + string(current) + " to " + status})
+}
 
+// Malfunction_report_validator validates if malfunction report exists
+func Malfunction_report_validator(id *uint, validator_errs *[]ValidatorErr) {
+	if id == nil {
+		return
+	}
+	res := utils.DB.Where("id = ?", id).Find(&models.MalfunctionReport{})
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"StatusErr", "Malfunction report with given id does not exist"})
+	}
 }
@@ -0,0 +1,84 @@
+// package validators contains functions for validating recieved data
+// this file contains validators for duties of drivers
+package validators
+
+import (
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// Stop_name_validator validates if stop with given name exists
+func Stop_name_validator(name string, validator_errs *[]ValidatorErr) {
+	res := utils.DB.Where("name = ?", name).Find(&models.Stop{})
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"StopErr", "Stop " + name + " does not exist"})
+	}
+}
+
+// Duty_times_validator validates start and end of duty or its item
+// returns parsed times
+func Duty_times_validator(start string, end string, validator_errs *[]ValidatorErr) (start_time time.Time, end_time time.Time) {
+	start_time, err := time.Parse("2006-01-02 15:04", start)
+	if err != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"TimeParse", err.Error()})
+		return
+	}
+	end_time, err = time.Parse("2006-01-02 15:04", end)
+	if err != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"TimeParse", err.Error()})
+		return
+	}
+	if !end_time.After(start_time) || end_time.Sub(start_time) > 24*time.Hour {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DutyErr", "End has to be after start and at most 24 hours later (" + start + " - " + end + ")"})
+	}
+	return
+}
+
+// Duty_overlap_validator checks if driver and vehicle have no other duty overlapping given time
+// and no connection outside of duties between sign-on and sign-off, duty with given id is skipped
+func Duty_overlap_validator(id uint, driverID *uint, registration *string, sign_on time.Time, sign_off time.Time, validator_errs *[]ValidatorErr) {
+	if driverID != nil {
+		res := utils.DB.Where("id <> ? AND driver_id = ? AND sign_on < ? AND sign_off > ?", id, driverID, sign_off, sign_on).Find(&models.Duty{})
+		if res.Error != nil {
+			*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+			return
+		}
+		if res.RowsAffected != 0 {
+			*validator_errs = append(*validator_errs, ValidatorErr{"DriverAvailability", "Driver has another duty at given time"})
+		}
+		res = utils.DB.Where("duty_id IS NULL AND driver_id = ? AND status <> ? AND departure_time < ? AND arrival_time > ?",
+			driverID, models.CancelledConnection, sign_off, sign_on).Find(&models.Connection{})
+		if res.Error != nil {
+			*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+			return
+		}
+		if res.RowsAffected != 0 {
+			*validator_errs = append(*validator_errs, ValidatorErr{"DriverAvailability", "Driver has connection outside of duty at given time"})
+		}
+	}
+	if registration != nil {
+		res := utils.DB.Where("id <> ? AND vehicle_registration = ? AND sign_on < ? AND sign_off > ?", id, registration, sign_off, sign_on).Find(&models.Duty{})
+		if res.Error != nil {
+			*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+			return
+		}
+		if res.RowsAffected != 0 {
+			*validator_errs = append(*validator_errs, ValidatorErr{"VehicleAvailability", "Vehicle has another duty at given time"})
+		}
+		res = utils.DB.Where("duty_id IS NULL AND vehicle_registration = ? AND status <> ? AND departure_time < ? AND arrival_time > ?",
+			registration, models.CancelledConnection, sign_off, sign_on).Find(&models.Connection{})
+		if res.Error != nil {
+			*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+			return
+		}
+		if res.RowsAffected != 0 {
+			*validator_errs = append(*validator_errs, ValidatorErr{"VehicleAvailability", "Vehicle has connection outside of duty at given time"})
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// package validators contains functions for validating recieved data
+// this file contains validators for uploaded images
+package validators
+
+import (
+	"fmt"
+
+	"github.com/AdamPekny/IIS/backend/images"
+)
+
+// Image_validator validates uploaded image is JPEG, PNG or GIF not larger than Attachment_max_size
+// empty data means no image and are not validated
+// loads any errors into validator_errs
+func Image_validator(data []byte, validator_errs *[]ValidatorErr) {
+	if len(data) == 0 {
+		return
+	}
+	if max_size := Attachment_max_size(); int64(len(data)) > max_size {
+		*validator_errs = append(*validator_errs, ValidatorErr{"ImageErr", fmt.Sprintf("Image is larger than %d MB", max_size>>20)})
+		return
+	}
+	if _, err := images.Check(data); err != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"ImageErr", err.Error()})
+	}
+}
@@ -1 +1,53 @@
+// package validators contains functions for validating recieved data
+// this file contains validators for lines
 package validators
+
+import (
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// Line_sequence_validator validates stop sequences of line
+// reverse sequence is optional and has to lead from final stop to initial stop
+func Line_sequence_validator(stops []string, reverse_stops []string, validator_errs *[]ValidatorErr) {
+	if len(stops) < 2 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"LineSequenceErr", "Line must have at least 2 stops"})
+		return
+	}
+	if len(reverse_stops) == 0 {
+		return
+	}
+	if len(reverse_stops) < 2 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"LineSequenceErr", "Reverse direction must have at least 2 stops"})
+		return
+	}
+	if reverse_stops[0] != stops[len(stops)-1] || reverse_stops[len(reverse_stops)-1] != stops[0] {
+		*validator_errs = append(*validator_errs, ValidatorErr{"LineSequenceErr", "Reverse direction must lead from final stop to initial stop"})
+	}
+}
+
+// Line_vehicle_types_validator validates vehicle types allowed on line
+// loads any errors into validator_errs
+func Line_vehicle_types_validator(vehicle_types []string, validator_errs *[]ValidatorErr) {
+	for _, vehicle_type := range vehicle_types {
+		Vehicle_type_validator(vehicle_type, validator_errs)
+	}
+}
+
+// Line_vehicles_validator checks if vehicles assigned to future connections of line can still operate it
+// after change of its vehicle types or minimal capacity
+func Line_vehicles_validator(line *models.Line, validator_errs *[]ValidatorErr) {
+	var vehicles []models.Vehicle
+	res := utils.DB.Where("registration IN (?)", utils.DB.Model(&models.Connection{}).
+		Where("line_name = ? AND vehicle_registration IS NOT NULL AND departure_time >= ? AND status <> ?", line.Name, time.Now(), models.CancelledConnection).
+		Distinct().Select("vehicle_registration")).Order("registration").Find(&vehicles)
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	for i := range vehicles {
+		Line_vehicle_compatibility(line, &vehicles[i], validator_errs)
+	}
+}
@@ -1,10 +1,12 @@
 package validators
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/AdamPekny/IIS/backend/models"
 	"github.com/AdamPekny/IIS/backend/utils"
+	"gorm.io/gorm"
 )
 
 func DeadlineValidator(deadline time.Time, validator_errs *[]ValidatorErr) {
@@ -19,7 +21,8 @@ func DeadlineValidator(deadline time.Time, validator_errs *[]ValidatorErr) {
 
 func StatusValidator(status string, validator_errs *[]ValidatorErr) {
 	switch status {
-	case string(models.PendingStatus), string(models.InProgressStatus), string(models.DoneStatus), "":
+	case string(models.PendingStatus), string(models.InProgressStatus), string(models.WaitingForPartsStatus), string(models.DoneStatus),
+		string(models.RejectedStatus), string(models.ReopenedStatus), "":
 		return
 	}
 
@@ -29,17 +32,6 @@ func StatusValidator(status string, validator_errs *[]ValidatorErr) {
 	})
 }
 
-func CostValidator(cost float64, validator_errs *[]ValidatorErr) {
-	if cost >= 0 {
-		return
-	} 
-
-	*validator_errs = append(*validator_errs, ValidatorErr{
-		Name: "CostErr",
-		Desc: "Invalid cost value!",
-	})
-}
-
 func HasResolverValidator(request_ref *uint, validator_errs *[]ValidatorErr) {
 	if request_ref == nil {
 		*validator_errs = append(*validator_errs, ValidatorErr{
@@ -65,3 +57,111 @@ func HasResolverValidator(request_ref *uint, validator_errs *[]ValidatorErr) {
 		})
 	}
 }
+
+// Open_maintenance limits query of maintenance requests to ones which are not done or rejected
+func Open_maintenance(db *gorm.DB) *gorm.DB {
+	return db.Where("maintenance_requests.status NOT IN ?", models.ClosedStatuses)
+}
+
+// Blocking_maintenance limits query of maintenance requests to open ones which take vehicle out of service
+// request is blocking when it is being worked on or caused by malfunction,
+// pending preventive request blocks vehicle only from its deadline
+// vehicle with blocking maintenance request must not be assigned to connections
+func Blocking_maintenance(db *gorm.DB) *gorm.DB {
+	return db.Scopes(Open_maintenance).Where("(maintenance_requests.status IN ? OR maintenance_requests.malfunc_rep_ref IS NOT NULL OR maintenance_requests.deadline <= ?)",
+		[]models.Status{models.InProgressStatus, models.WaitingForPartsStatus}, utils.Wall_clock_now())
+}
+
+// Vehicles_in_maintenance returns registrations of vehicles with blocking maintenance request
+func Vehicles_in_maintenance() (map[string]bool, error) {
+	var registrations []string
+	res := utils.DB.Model(&models.MaintenanceRequest{}).Scopes(Blocking_maintenance).
+		Where("vehicle_ref IS NOT NULL").Distinct().Pluck("vehicle_ref", &registrations)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	in_maintenance := map[string]bool{}
+	for _, registration := range registrations {
+		in_maintenance[registration] = true
+	}
+	return in_maintenance, nil
+}
+
+// Vehicle_maintenance_validator checks if vehicle has no blocking maintenance request
+// loads any errors into validator_errs
+func Vehicle_maintenance_validator(registration *string, validator_errs *[]ValidatorErr) {
+	if registration == nil {
+		return
+	}
+	request := models.MaintenanceRequest{}
+	res := utils.DB.Scopes(Blocking_maintenance).Where("vehicle_ref = ?", registration).Order("created_at").Limit(1).Find(&request)
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	if res.RowsAffected != 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"VehicleMaintenance",
+			fmt.Sprintf("Vehicle %s is in maintenance, maintenance request %d is %s", *registration, request.ID, request.Status)})
+	}
+}
+
+// maintenance_transitions lists roles allowed to change status of maintenance request
+// technician works on assigned requests, superuser rejects and reopens them, admin can do both
+var maintenance_transitions = map[models.Status]map[models.Status][]models.Role{
+	models.PendingStatus: {
+		models.InProgressStatus:      {models.TechnicianRole},
+		models.WaitingForPartsStatus: {models.TechnicianRole},
+		models.RejectedStatus:        {models.SuperuserRole},
+	},
+	models.InProgressStatus: {
+		models.WaitingForPartsStatus: {models.TechnicianRole},
+		models.DoneStatus:            {models.TechnicianRole},
+		models.RejectedStatus:        {models.SuperuserRole},
+	},
+	models.WaitingForPartsStatus: {
+		models.InProgressStatus: {models.TechnicianRole},
+		models.RejectedStatus:   {models.SuperuserRole},
+	},
+	models.ReopenedStatus: {
+		models.InProgressStatus:      {models.TechnicianRole},
+		models.WaitingForPartsStatus: {models.TechnicianRole},
+		models.RejectedStatus:        {models.SuperuserRole},
+	},
+	models.DoneStatus: {
+		models.ReopenedStatus: {models.SuperuserRole},
+	},
+	models.RejectedStatus: {
+		models.ReopenedStatus: {models.SuperuserRole},
+	},
+}
+
+// Maintenance_status_validator checks if user can change status of maintenance request to given one
+// technician can change only status of request assigned to the technician
+// loads any errors into validator_errs
+func Maintenance_status_validator(request *models.MaintenanceRequest, status models.Status, user *models.User, validator_errs *[]ValidatorErr) {
+	current := request.Status
+	if current == "" {
+		current = models.PendingStatus
+	}
+	roles, ok := maintenance_transitions[current][status]
+	if !ok {
+		*validator_errs = append(*validator_errs, ValidatorErr{"StatusErr",
+			fmt.Sprintf("Maintenance request can not change from %s to %s", current, status)})
+		return
+	}
+	if user.Role == models.AdminRole {
+		return
+	}
+	permitted := false
+	for _, role := range roles {
+		permitted = permitted || user.Role == role
+	}
+	if !permitted {
+		*validator_errs = append(*validator_errs, ValidatorErr{"StatusErr",
+			fmt.Sprintf("Role %s can not change maintenance request from %s to %s", user.Role, current, status)})
+		return
+	}
+	if user.Role == models.TechnicianRole && (request.ResolvedByRef == nil || *request.ResolvedByRef != user.ID) {
+		*validator_errs = append(*validator_errs, ValidatorErr{"StatusErr", "Maintenance request is not assigned to you"})
+	}
+}
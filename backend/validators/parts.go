@@ -0,0 +1,64 @@
+// package validators contains functions for validating recieved data
+// this file contains validators for spare parts inventory
+package validators
+
+import (
+	"fmt"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// Spare_part_validator validates part of catalogue, catalogue number has to be unique
+// id is nil for new part
+// loads any errors into validator_errs
+func Spare_part_validator(id *uint, number string, unit_price float64, stock float64, min_stock float64, validator_errs *[]ValidatorErr) {
+	if unit_price < 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"SparePartErr", "Unit price must not be negative"})
+	}
+	if stock < 0 || min_stock < 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"SparePartErr", "Stock must not be negative"})
+	}
+	query := utils.DB.Where("number = ?", number)
+	if id != nil {
+		query = query.Where("id <> ?", *id)
+	}
+	res := query.Find(&models.SparePart{})
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	if res.RowsAffected != 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"SparePartErr", "Part with catalogue number " + number + " already exists"})
+	}
+}
+
+// Report_item_validator validates part used in maintenance report exists and quantity is positive
+// each part can be used only once in report, used_parts collects parts of the report
+// loads any errors into validator_errs
+func Report_item_validator(part_ref uint, quantity float64, used_parts map[uint]bool, validator_errs *[]ValidatorErr) {
+	if quantity <= 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"ReportItemErr", fmt.Sprintf("Quantity of part %d must be positive", part_ref)})
+	}
+	if used_parts[part_ref] {
+		*validator_errs = append(*validator_errs, ValidatorErr{"ReportItemErr", fmt.Sprintf("Part %d is used more than once", part_ref)})
+		return
+	}
+	used_parts[part_ref] = true
+	res := utils.DB.Where("id = ?", part_ref).Find(&models.SparePart{})
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"ReportItemErr", fmt.Sprintf("Part %d does not exist", part_ref)})
+	}
+}
+
+// Labour_hours_validator validates labour hours of maintenance report
+// loads any errors into validator_errs
+func Labour_hours_validator(hours float64, validator_errs *[]ValidatorErr) {
+	if hours < 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"LabourHoursErr", "Labour hours must not be negative"})
+	}
+}
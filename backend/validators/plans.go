@@ -0,0 +1,69 @@
+// package validators contains functions for validating recieved data
+// this file contains validators for preventive maintenance plans
+package validators
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// Maintenance_plan_validator validates plan is given for either vehicle type or single vehicle
+// and is due after days, kilometres or both
+// loads any errors into validator_errs
+func Maintenance_plan_validator(vehicle_type *string, registration *string, interval_days *uint, interval_km *uint, validator_errs *[]ValidatorErr) {
+	if (vehicle_type == nil) == (registration == nil) {
+		*validator_errs = append(*validator_errs, ValidatorErr{"MaintenancePlanErr", "Plan has to be given either for vehicle type or for vehicle"})
+	}
+	if vehicle_type != nil {
+		Vehicle_type_validator(*vehicle_type, validator_errs)
+	}
+	Vehicle_registration_validator(registration, validator_errs)
+	if (interval_days == nil || *interval_days == 0) && (interval_km == nil || *interval_km == 0) {
+		*validator_errs = append(*validator_errs, ValidatorErr{"MaintenancePlanErr", "Plan needs interval in days or kilometres"})
+	}
+}
+
+// Maintenance_subject_validator validates maintenance request is given malfunction report or vehicle
+// vehicle given together with malfunction report has to be the reported one
+// loads any errors into validator_errs
+func Maintenance_subject_validator(malfunc_rep_ref *uint, registration *string, validator_errs *[]ValidatorErr) {
+	if malfunc_rep_ref == nil && registration == nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"MaintenanceSubjectErr", "Malfunction report or vehicle is required"})
+		return
+	}
+	Malfunction_report_validator(malfunc_rep_ref, validator_errs)
+	Vehicle_registration_validator(registration, validator_errs)
+	if malfunc_rep_ref == nil || registration == nil {
+		return
+	}
+	var report models.MalfunctionReport
+	if res := utils.DB.Where("id = ?", malfunc_rep_ref).Find(&report); res.Error == nil && report.VehicleRef != nil && *report.VehicleRef != *registration {
+		*validator_errs = append(*validator_errs, ValidatorErr{"MaintenanceSubjectErr", "Malfunction report belongs to vehicle " + *report.VehicleRef})
+	}
+}
+
+// Odometer_reading_validator validates reading is not from future
+// and keeps mileage of vehicle growing in time with other readings
+// loads any errors into validator_errs
+func Odometer_reading_validator(registration string, mileage float64, recorded_at time.Time, validator_errs *[]ValidatorErr) {
+	if mileage < 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"OdometerErr", "Mileage must not be negative"})
+	}
+	if recorded_at.After(time.Now()) {
+		*validator_errs = append(*validator_errs, ValidatorErr{"OdometerErr", "Reading must not be in the future"})
+	}
+	var readings []models.OdometerReading
+	res := utils.DB.Where("vehicle_ref = ? AND ((recorded_at < ? AND mileage > ?) OR (recorded_at > ? AND mileage < ?))",
+		registration, recorded_at, mileage, recorded_at, mileage).Find(&readings)
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	for _, reading := range readings {
+		*validator_errs = append(*validator_errs, ValidatorErr{"OdometerErr",
+			fmt.Sprintf("Reading %.1f km from %s does not match mileage %.1f km", reading.Mileage, reading.RecordedAt.Format("2006-01-02 15:04"), mileage)})
+	}
+}
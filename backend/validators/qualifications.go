@@ -0,0 +1,88 @@
+// package validators contains functions for validating recieved data
+// this file contains validators for qualifications of drivers
+package validators
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// Licence_category_validator validates licence category, e.g. D, D1 or DE
+// loads any errors into validator_errs
+func Licence_category_validator(category string, validator_errs *[]ValidatorErr) {
+	if !regexp.MustCompile("^[A-Z][A-Z0-9]{0,3}$").MatchString(category) {
+		*validator_errs = append(*validator_errs, ValidatorErr{"LicenceCategoryErr", "Licence category must be 1 to 4 capital letters or digits starting with letter"})
+	}
+}
+
+// Unrecorded_qualifications_allowed reports if drivers without any recorded licence or route knowledge pass checks
+// of the missing qualification, it is enabled by QUALIFICATIONS_ALLOW_UNRECORDED=true only while records are entered
+func Unrecorded_qualifications_allowed() bool {
+	return os.Getenv("QUALIFICATIONS_ALLOW_UNRECORDED") == "true"
+}
+
+// Driver_qualification_validator checks if driver knows line and holds licence for type of vehicle
+// qualifications have to be valid on day of departure and day of arrival
+// loads any errors into validator_errs
+func Driver_qualification_validator(driverID *uint, registration *string, line_name string, departure time.Time, arrival time.Time, validator_errs *[]ValidatorErr) {
+	if driverID == nil {
+		return
+	}
+	var driver models.User
+	res := utils.DB.Preload("Licences").Preload("RouteKnowledge").Where("id = ?", driverID).Find(&driver)
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	vehicle_type := ""
+	if registration != nil {
+		var vehicle models.Vehicle
+		res = utils.DB.Where("registration = ?", registration).Find(&vehicle)
+		if res.Error != nil {
+			*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+			return
+		}
+		vehicle_type = vehicle.VehicleTypeName
+	}
+	Driver_qualification(&driver, vehicle_type, line_name, departure, arrival, validator_errs)
+}
+
+// Driver_qualification checks qualifications of driver loaded with licences and route knowledge
+// empty vehicle type is not checked
+func Driver_qualification(driver *models.User, vehicle_type string, line_name string, departure time.Time, arrival time.Time, validator_errs *[]ValidatorErr) {
+	knows_line := len(driver.RouteKnowledge) == 0 && Unrecorded_qualifications_allowed()
+	for i := range driver.RouteKnowledge {
+		knowledge := &driver.RouteKnowledge[i]
+		knows_line = knows_line || (knowledge.LineName == line_name && knowledge.Valid(departure) && knowledge.Valid(arrival))
+	}
+	if !knows_line {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DriverQualification",
+			fmt.Sprintf("Driver %s has no valid route knowledge of line %s on %s", driver.FullName, line_name, departure.Format("2006-01-02"))})
+	}
+	if vehicle_type == "" {
+		return
+	}
+	if !Driver_licensed(driver, vehicle_type, departure, arrival) {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DriverQualification",
+			fmt.Sprintf("Driver %s has no valid licence for vehicle type %s on %s", driver.FullName, vehicle_type, departure.Format("2006-01-02"))})
+	}
+}
+
+// Driver_licensed checks if driver loaded with licences holds valid licence for vehicle type
+func Driver_licensed(driver *models.User, vehicle_type string, departure time.Time, arrival time.Time) bool {
+	if len(driver.Licences) == 0 && Unrecorded_qualifications_allowed() {
+		return true
+	}
+	for i := range driver.Licences {
+		licence := &driver.Licences[i]
+		if licence.VehicleTypeName == vehicle_type && licence.Valid(departure) && licence.Valid(arrival) {
+			return true
+		}
+	}
+	return false
+}
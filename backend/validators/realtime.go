@@ -0,0 +1,35 @@
+// package validators contains functions for validating recieved data
+// this file contains validators for real-time vehicle data
+package validators
+
+import (
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+)
+
+// Realtime_event_validator validates position or departure reported for connection
+// departure needs stop, position needs coordinates or stop the vehicle stands in
+func Realtime_event_validator(event_type string, stop_name *string, latitude *float64, longitude *float64, event_time string, validator_errs *[]ValidatorErr) {
+	switch models.RealtimeEventType(event_type) {
+	case models.DepartedEvent:
+		if stop_name == nil || *stop_name == "" {
+			*validator_errs = append(*validator_errs, ValidatorErr{"RealtimeEventErr", "Departure needs stop name"})
+		}
+	case models.PositionEvent:
+		if (latitude == nil) != (longitude == nil) {
+			*validator_errs = append(*validator_errs, ValidatorErr{"RealtimeEventErr", "Position needs both latitude and longitude"})
+		} else if latitude == nil && stop_name == nil {
+			*validator_errs = append(*validator_errs, ValidatorErr{"RealtimeEventErr", "Position needs coordinates or stop name"})
+		} else if latitude != nil && (*latitude < -90 || *latitude > 90 || *longitude < -180 || *longitude > 180) {
+			*validator_errs = append(*validator_errs, ValidatorErr{"RealtimeEventErr", "Invalid coordinates"})
+		}
+	default:
+		*validator_errs = append(*validator_errs, ValidatorErr{"RealtimeEventErr", "Event type must be position or departed"})
+	}
+	if event_time != "" {
+		if _, err := time.Parse("2006-01-02 15:04:05", event_time); err != nil {
+			*validator_errs = append(*validator_errs, ValidatorErr{"TimeParse", err.Error()})
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// package validators contains functions for validating recieved data
+// this file contains validators for recurring services
+package validators
+
+import (
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+)
+
+// Weekdays_validator validates names of weekdays service runs in
+func Weekdays_validator(weekdays []string, validator_errs *[]ValidatorErr) {
+	for _, weekday := range weekdays {
+		valid := false
+		for _, name := range models.WeekdayNames {
+			if weekday == name {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			*validator_errs = append(*validator_errs, ValidatorErr{"WeekdayErr", "Invalid weekday " + weekday + ", use mon, tue, wed, thu, fri, sat or sun"})
+			return
+		}
+	}
+}
+
+// Service_dates_validator validates validity range of service
+// valid_to can be empty for service without end
+func Service_dates_validator(valid_from string, valid_to string, validator_errs *[]ValidatorErr) {
+	from, err := time.Parse("2006-01-02", valid_from)
+	if err != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"TimeParse", err.Error()})
+		return
+	}
+	if valid_to == "" {
+		return
+	}
+	to, err := time.Parse("2006-01-02", valid_to)
+	if err != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"TimeParse", err.Error()})
+		return
+	}
+	if to.Before(from) {
+		*validator_errs = append(*validator_errs, ValidatorErr{"ServiceDatesErr", "Service must not end before it starts"})
+	}
+}
+
+// Service_exception_validator validates date and type of service exception
+func Service_exception_validator(date string, exception_type string, validator_errs *[]ValidatorErr) {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"TimeParse", err.Error()})
+		return
+	}
+	if exception_type != string(models.AddedException) && exception_type != string(models.RemovedException) {
+		*validator_errs = append(*validator_errs, ValidatorErr{"ExceptionTypeErr", "Exception type must be added or removed"})
+	}
+}
+
+// Service_time_validator validates departure time of service
+func Service_time_validator(departure_time string, validator_errs *[]ValidatorErr) {
+	if _, err := time.Parse("15:04", departure_time); err != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"TimeParse", err.Error()})
+	}
+}
@@ -0,0 +1,101 @@
+// package validators contains functions for validating recieved data
+// this file contains validators for stops
+package validators
+
+import (
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// Stop_coordinates_validator validates coordinates of stop, both or none of them have to be given
+// loads any errors into validator_errs
+func Stop_coordinates_validator(latitude *float64, longitude *float64, validator_errs *[]ValidatorErr) {
+	if (latitude == nil) != (longitude == nil) {
+		*validator_errs = append(*validator_errs, ValidatorErr{"CoordinatesErr", "Latitude and Longitude must be given together"})
+		return
+	}
+	if latitude == nil {
+		return
+	}
+	if *latitude < -90 || *latitude > 90 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"CoordinatesErr", "Latitude must be between -90 and 90"})
+	}
+	if *longitude < -180 || *longitude > 180 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"CoordinatesErr", "Longitude must be between -180 and 180"})
+	}
+}
+
+// Stop_code_validator validates optional short code of stop, e.g. platform or zone
+// loads any errors into validator_errs
+func Stop_code_validator(name string, code *string, validator_errs *[]ValidatorErr) {
+	if code == nil {
+		return
+	}
+	if *code == "" || len(*code) > 16 {
+		*validator_errs = append(*validator_errs, ValidatorErr{name + "Err", name + " must have 1 to 16 characters"})
+	}
+}
+
+// Stop_parent_validator validates station which stop with stop_id (zero for new stop) is platform of
+// stations can not be nested and stop used by segments of lines can not become station
+// loads any errors into validator_errs
+func Stop_parent_validator(stop_id uint, parent_id *uint, validator_errs *[]ValidatorErr) {
+	if parent_id == nil {
+		return
+	}
+	if *parent_id == stop_id {
+		*validator_errs = append(*validator_errs, ValidatorErr{"StationErr", "Stop can not be its own station"})
+		return
+	}
+	parent := models.Stop{}
+	res := utils.DB.Find(&parent, "id = ?", *parent_id)
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	if res.RowsAffected == 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"StationErr", "Station does not exist"})
+		return
+	}
+	if parent.ParentID != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"StationErr", "Stop " + parent.Name + " is platform of other station"})
+	}
+	if stop_id != 0 {
+		var platforms int64
+		if res := utils.DB.Model(&models.Stop{}).Where("parent_id = ?", stop_id).Count(&platforms); res.Error != nil {
+			*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+			return
+		}
+		if platforms > 0 {
+			*validator_errs = append(*validator_errs, ValidatorErr{"StationErr", "Station can not be platform of other station"})
+		}
+	}
+	var segments int64
+	res = utils.DB.Model(&models.Segment{}).Where("stop_name1 = ? OR stop_name2 = ?", parent.Name, parent.Name).Count(&segments)
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	if segments > 0 {
+		*validator_errs = append(*validator_errs, ValidatorErr{"StationErr", "Stop " + parent.Name + " is used by lines, lines have to use platforms of station"})
+	}
+}
+
+// Line_stations_validator validates that line does not stop at station itself but at one of its platforms
+// loads any errors into validator_errs
+func Line_stations_validator(stops []string, validator_errs *[]ValidatorErr) {
+	if len(stops) == 0 {
+		return
+	}
+	var stations []string
+	res := utils.DB.Model(&models.Stop{}).
+		Where("name IN ? AND id IN (?)", stops, utils.DB.Model(&models.Stop{}).Select("parent_id").Where("parent_id IS NOT NULL")).
+		Pluck("name", &stations)
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	for _, station := range stations {
+		*validator_errs = append(*validator_errs, ValidatorErr{"StationErr", "Stop " + station + " is station, line has to use one of its platforms"})
+	}
+}
@@ -0,0 +1,193 @@
+// package validators contains functions for validating recieved data
+// this file contains validators for working time of drivers
+package validators
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/utils"
+)
+
+// WorkingTimeRules holds limits of driver working time in minutes
+// rules are configured by environment variables, defaults follow usual labour regulations
+type WorkingTimeRules struct {
+	MaxDailyDriving      int // DRIVER_MAX_DAILY_DRIVING, driving in one shift
+	MinRest              int // DRIVER_MIN_REST, rest between shifts, shorter gap continues the shift
+	MaxContinuousDriving int // DRIVER_MAX_CONTINUOUS_DRIVING, driving without break
+	MinBreak             int // DRIVER_MIN_BREAK, shorter gap does not count as break
+	MaxWeeklyDriving     int // DRIVER_MAX_WEEKLY_DRIVING, driving in calendar week
+}
+
+// WorkingTrip is connection driven by driver
+// only shifts, driving blocks and weeks with checked trips are validated
+type WorkingTrip struct {
+	ConnectionID uint
+	Departure    time.Time
+	Arrival      time.Time
+	Checked      bool
+}
+
+// Working_time_rules loads working time rules from environment
+func Working_time_rules() WorkingTimeRules {
+	return WorkingTimeRules{
+		MaxDailyDriving:      env_minutes("DRIVER_MAX_DAILY_DRIVING", 9*60),
+		MinRest:              env_minutes("DRIVER_MIN_REST", 11*60),
+		MaxContinuousDriving: env_minutes("DRIVER_MAX_CONTINUOUS_DRIVING", 4*60+30),
+		MinBreak:             env_minutes("DRIVER_MIN_BREAK", 45),
+		MaxWeeklyDriving:     env_minutes("DRIVER_MAX_WEEKLY_DRIVING", 56*60),
+	}
+}
+
+// env_minutes loads number of minutes from environment variable
+func env_minutes(name string, def int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return def
+}
+
+// Driver_working_time checks if driver would keep working time rules with given trips
+// trips replace already saved connections with same id, cancelled connections are ignored
+// loads any errors into validator_errs
+func Driver_working_time(driverID *uint, trips []WorkingTrip, validator_errs *[]ValidatorErr) {
+	if driverID == nil || len(trips) == 0 {
+		return
+	}
+	from, to := trips[0].Departure, trips[0].Arrival
+	replaced := map[uint]bool{}
+	all := []WorkingTrip{}
+	for i := range trips {
+		trip := trips[i]
+		trip.Checked = true
+		all = append(all, trip)
+		if trips[i].Departure.Before(from) {
+			from = trips[i].Departure
+		}
+		if trips[i].Arrival.After(to) {
+			to = trips[i].Arrival
+		}
+		if trips[i].ConnectionID != 0 {
+			replaced[trips[i].ConnectionID] = true
+		}
+	}
+	// whole weeks around trips are needed for weekly limit
+	var connections []models.Connection
+	res := utils.DB.Where("driver_id = ? AND status <> ? AND departure_time < ? AND arrival_time > ?",
+		driverID, models.CancelledConnection, to.AddDate(0, 0, 8), from.AddDate(0, 0, -8)).Find(&connections)
+	if res.Error != nil {
+		*validator_errs = append(*validator_errs, ValidatorErr{"DatabaseErr", res.Error.Error()})
+		return
+	}
+	for _, connection := range connections {
+		if !replaced[connection.ID] {
+			all = append(all, WorkingTrip{ConnectionID: connection.ID, Departure: connection.DepartureTime, Arrival: connection.ArrivalTime})
+		}
+	}
+	Working_time_validator(Working_time_rules(), all, validator_errs)
+}
+
+// Working_time_validator validates trips of one driver against working time rules
+// every broken rule is reported once
+func Working_time_validator(rules WorkingTimeRules, trips []WorkingTrip, validator_errs *[]ValidatorErr) {
+	sort.SliceStable(trips, func(i, j int) bool {
+		return trips[i].Departure.Before(trips[j].Departure)
+	})
+	reported := map[string]bool{}
+	report := func(name string, desc string) {
+		if !reported[name] {
+			reported[name] = true
+			*validator_errs = append(*validator_errs, ValidatorErr{name, desc})
+		}
+	}
+
+	// driving blocks are split by breaks, shifts are split by rests
+	check_groups := func(gap int, check func(group []WorkingTrip)) {
+		start := 0
+		for i := 1; i <= len(trips); i++ {
+			if i == len(trips) || trips[i].Departure.Sub(trips[i-1].Arrival) >= time.Duration(gap)*time.Minute {
+				group := trips[start:i]
+				for _, trip := range group {
+					if trip.Checked {
+						check(group)
+						break
+					}
+				}
+				start = i
+			}
+		}
+	}
+	check_groups(rules.MinBreak, func(block []WorkingTrip) {
+		if driving := driving_minutes(block); driving > rules.MaxContinuousDriving {
+			report("DrivingBreak", fmt.Sprintf("Driver would drive %d minutes from %s without break of %d minutes, maximum is %d minutes",
+				driving, block[0].Departure.Format("2006-01-02 15:04"), rules.MinBreak, rules.MaxContinuousDriving))
+		}
+	})
+	check_groups(rules.MinRest, func(shift []WorkingTrip) {
+		if driving := driving_minutes(shift); driving > rules.MaxDailyDriving {
+			report("DailyDrivingTime", fmt.Sprintf("Driver would drive %d minutes in shift starting %s, maximum is %d minutes",
+				driving, shift[0].Departure.Format("2006-01-02 15:04"), rules.MaxDailyDriving))
+		}
+		if span := int(shift[len(shift)-1].Arrival.Sub(shift[0].Departure).Minutes()); span > 24*60-rules.MinRest {
+			report("RestTime", fmt.Sprintf("Driver would not get %d minutes of rest within 24 hours from %s",
+				rules.MinRest, shift[0].Departure.Format("2006-01-02 15:04")))
+		}
+	})
+
+	weeks := map[string][]WorkingTrip{}
+	keys := []string{}
+	for _, trip := range trips {
+		year, week := trip.Departure.ISOWeek()
+		key := fmt.Sprintf("%d-W%02d", year, week)
+		if _, ok := weeks[key]; !ok {
+			keys = append(keys, key)
+		}
+		weeks[key] = append(weeks[key], trip)
+	}
+	for _, key := range keys {
+		checked := false
+		for _, trip := range weeks[key] {
+			checked = checked || trip.Checked
+		}
+		if driving := driving_minutes(weeks[key]); checked && driving > rules.MaxWeeklyDriving {
+			report("WeeklyDrivingTime", fmt.Sprintf("Driver would drive %d minutes in week %s, maximum is %d minutes",
+				driving, key, rules.MaxWeeklyDriving))
+		}
+	}
+}
+
+// driving_minutes sums driving time of trips
+func driving_minutes(trips []WorkingTrip) int {
+	minutes := 0
+	for _, trip := range trips {
+		minutes += int(trip.Arrival.Sub(trip.Departure).Minutes())
+	}
+	return minutes
+}
+
+// Connections_working_time checks working time rules for drivers of given connections
+// connections are grouped by driver, connections without driver are skipped
+func Connections_working_time(connections []models.Connection, validator_errs *[]ValidatorErr) {
+	trips := map[uint][]WorkingTrip{}
+	drivers := []uint{}
+	for _, connection := range connections {
+		if connection.DriverID == nil || connection.Status == models.CancelledConnection {
+			continue
+		}
+		if _, ok := trips[*connection.DriverID]; !ok {
+			drivers = append(drivers, *connection.DriverID)
+		}
+		trips[*connection.DriverID] = append(trips[*connection.DriverID], WorkingTrip{
+			ConnectionID: connection.ID,
+			Departure:    connection.DepartureTime,
+			Arrival:      connection.ArrivalTime,
+		})
+	}
+	for i := range drivers {
+		Driver_working_time(&drivers[i], trips[drivers[i]], validator_errs)
+	}
+}
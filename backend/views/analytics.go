@@ -0,0 +1,67 @@
+// package views contains views used in router handlers
+// this file contains views for maintenance cost and reliability analytics of fleet
+package views
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/gin-gonic/gin"
+)
+
+// GetMaintenanceAnalytics aggregates maintenance costs, time between failures and time to repair
+// grouped by ?group=vehicle|type|brand|month from ?from= until ?to= (2006-01-02, whole history by default)
+// result is returned as JSON or CSV depending on ?format=json|csv
+func GetMaintenanceAnalytics(ctx *gin.Context) {
+	group := ctx.DefaultQuery("group", "vehicle")
+	valid_group := false
+	for _, analytics_group := range serializers.AnalyticsGroups {
+		valid_group = valid_group || group == analytics_group
+	}
+	if !valid_group {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid group, use vehicle, type, brand or month"})
+		return
+	}
+
+	from := time.Time{}
+	if date := ctx.Query("from"); date != "" {
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid date"})
+			return
+		}
+		from = day
+	}
+	to := time.Now()
+	if date := ctx.Query("to"); date != "" {
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil || day.Before(from) {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid date"})
+			return
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+
+	rows, err := serializers.Maintenance_analytics(group, from, to)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch ctx.DefaultQuery("format", "json") {
+	case "json":
+		ctx.IndentedJSON(http.StatusOK, rows)
+	case "csv":
+		var buffer bytes.Buffer
+		if err := serializers.Write_analytics_csv(rows, &buffer); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.Header("Content-Disposition", "attachment; filename=maintenance-"+group+".csv")
+		ctx.Data(http.StatusOK, "text/csv; charset=utf-8", buffer.Bytes())
+	default:
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid format, use json or csv"})
+	}
+}
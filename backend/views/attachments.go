@@ -0,0 +1,152 @@
+// package views contains views used in router handlers
+// this file contains views for files attached to malfunction and maintenance reports
+package views
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/storage"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateMalfuncAttachment handles upload of photo into multipart field file of malfunction report
+// only driver who created the report can attach photos to it
+func CreateMalfuncAttachment(ctx *gin.Context) {
+	logged_user, err := models.GetUserFromCtx(ctx)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	report := models.MalfunctionReport{}
+	if res := utils.DB.First(&report, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Malfunction report not found"})
+		return
+	}
+	if logged_user.ID != *report.CreatedByRef && logged_user.Role != models.AdminRole {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "permission denied"})
+		return
+	}
+	attachment, ok := bindAttachment(ctx, models.PhotoAttachment)
+	if !ok {
+		return
+	}
+	createAttachment(ctx, attachment, fmt.Sprintf("malfunction/%d", report.ID), logged_user.ID, func(model *models.Attachment) {
+		model.MalfuncRepRef = &report.ID
+	})
+}
+
+// CreateMaintenRepAttachment handles upload of photo, invoice or document into multipart field file of maintenance report
+// kind of attachment is given in form field Kind, only technician resolving the request can attach files
+func CreateMaintenRepAttachment(ctx *gin.Context) {
+	logged_user, err := models.GetUserFromCtx(ctx)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	report := models.MaintenanceReport{}
+	if res := utils.DB.Preload("MaintenReq").First(&report, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Maintenance report not found"})
+		return
+	}
+	resolver := report.MaintenReq.ResolvedByRef
+	if (resolver == nil || logged_user.ID != *resolver) && logged_user.Role != models.AdminRole {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "permission denied"})
+		return
+	}
+	attachment, ok := bindAttachment(ctx, models.PhotoAttachment, models.InvoiceAttachment, models.DocumentAttachment)
+	if !ok {
+		return
+	}
+	createAttachment(ctx, attachment, fmt.Sprintf("maintenance/%d", report.ID), logged_user.ID, func(model *models.Attachment) {
+		model.MaintenRepRef = &report.ID
+	})
+}
+
+// DownloadAttachment serves content of attachment to anyone with URL signed by serializers.Attachment_url
+func DownloadAttachment(ctx *gin.Context) {
+	attachment := models.Attachment{}
+	if res := utils.DB.First(&attachment, "id = ?", ctx.Param("id")); res.Error != nil ||
+		!serializers.Valid_attachment_signature(attachment.ID, ctx.Query("expires"), ctx.Query("signature")) {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Attachment not found or link expired"})
+		return
+	}
+	files, err := storage.Default()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	content, err := files.GetObject(attachment.StorageKey)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+	ctx.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, content, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("inline", map[string]string{"filename": attachment.FileName}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=300",
+	})
+}
+
+// DeleteAttachment handles request for deleting attachment, only user who uploaded it can delete it
+func DeleteAttachment(ctx *gin.Context) {
+	logged_user, err := models.GetUserFromCtx(ctx)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	attachment := models.Attachment{}
+	if res := utils.DB.First(&attachment, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if logged_user.ID != *attachment.UploadedByRef && logged_user.Role != models.AdminRole {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "permission denied"})
+		return
+	}
+	if res := utils.DB.Delete(&attachment); res.Error != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	serializers.Remove_attachment_files([]models.Attachment{attachment})
+	ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
+
+// bindAttachment loads uploaded file and its kind (photo by default) and validates them
+// responds with error and returns false when attachment is not valid
+func bindAttachment(ctx *gin.Context, allowed_kinds ...models.AttachmentKind) (*serializers.AttachmentCreateSerializer, bool) {
+	file, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Multipart field file is required"})
+		return nil, false
+	}
+	attachment := &serializers.AttachmentCreateSerializer{
+		Kind: models.AttachmentKind(ctx.DefaultPostForm("Kind", string(models.PhotoAttachment))),
+		File: file,
+	}
+	if !attachment.Valid(allowed_kinds...) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": attachment.ValidatorErrs})
+		return nil, false
+	}
+	return attachment, true
+}
+
+// createAttachment stores validated attachment and responds with it
+func createAttachment(ctx *gin.Context, attachment *serializers.AttachmentCreateSerializer, prefix string, uploaded_by uint, attach func(*models.Attachment)) {
+	model, err := attachment.Store(prefix, uploaded_by, attach)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := serializers.AttachmentSerializer{}
+	if err := response.FromModel(model); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, response)
+}
@@ -0,0 +1,181 @@
+// package views contains views used in router handlers
+// this file contains views for availability of drivers and technicians
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AvailabilityDefaultDays is number of days shown in calendar when end is not given
+const AvailabilityDefaultDays = 31
+
+// ListAvailability lists calendar of drivers and technicians with their absences and preferred shifts
+// absences are shown from ?from= until ?to= (2006-01-02), users can be filtered by ?role=
+func ListAvailability(ctx *gin.Context) {
+	roles := []models.Role{models.DriverRole, models.TechnicianRole}
+	if role := ctx.Query("role"); role != "" {
+		roles = []models.Role{models.Role(role)}
+	}
+	var user_models []models.User
+	query, ok := availabilityQuery(ctx)
+	if !ok {
+		return
+	}
+	if res := query.Order("id").Where("role IN ?", roles).Find(&user_models); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	calendar, err := serializers.Get_availability(user_models)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, calendar)
+}
+
+// GetMyAvailability gets calendar of logged driver or technician
+// absences are shown same as in ListAvailability
+func GetMyAvailability(ctx *gin.Context) {
+	logged_user, err := models.GetUserFromCtx(ctx)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var user_models []models.User
+	query, ok := availabilityQuery(ctx)
+	if !ok {
+		return
+	}
+	if res := query.Where("id = ?", logged_user.ID).Find(&user_models); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	calendar, err := serializers.Get_availability(user_models)
+	if err != nil || len(calendar) == 0 {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, calendar[0])
+}
+
+// CreateAbsence handles request for recording absence of driver or technician
+// absence is recorded even when user is already assigned to work during it, the work is returned as conflicts
+func CreateAbsence(ctx *gin.Context) {
+	logged_user, err := models.GetUserFromCtx(ctx)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	absence := serializers.AbsenceCreateSerializer{}
+	if err := ctx.BindJSON(&absence); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !absence.Valid(logged_user) {
+		ctx.IndentedJSON(http.StatusBadRequest, absence.ValidatorErrs)
+		return
+	}
+	absence_model := absence.CreateModel()
+	if res := utils.DB.Create(&absence_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	utils.DB.Preload("User").First(&absence_model, absence_model.ID)
+	response := serializers.AbsenceSerializer{}
+	if err := response.FromModel(&absence_model); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// DeleteAbsence handles request for deleting absence
+// drivers and technicians can delete only their own absences
+func DeleteAbsence(ctx *gin.Context) {
+	logged_user, err := models.GetUserFromCtx(ctx)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	absence_model := models.Absence{}
+	if res := utils.DB.First(&absence_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Absence not found"})
+		return
+	}
+	if (logged_user.Role == models.DriverRole || logged_user.Role == models.TechnicianRole) && absence_model.UserID != logged_user.ID {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "permission denied"})
+		return
+	}
+	if res := utils.DB.Delete(&absence_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Absence deleted successfully"})
+}
+
+// UpdatePreferredShifts handles request for replacing preferred shifts of driver or technician
+func UpdatePreferredShifts(ctx *gin.Context) {
+	logged_user, err := models.GetUserFromCtx(ctx)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	preferences := serializers.PreferredShiftsSerializer{}
+	if err := ctx.BindJSON(&preferences); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !preferences.Valid(logged_user) {
+		ctx.IndentedJSON(http.StatusBadRequest, preferences.ValidatorErrs)
+		return
+	}
+	shift_models, err := preferences.Replace()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	shifts := []serializers.PreferredShiftSerializer{}
+	for i := range shift_models {
+		shift := serializers.PreferredShiftSerializer{}
+		shift.FromModel(&shift_models[i])
+		shifts = append(shifts, shift)
+	}
+	ctx.IndentedJSON(http.StatusOK, shifts)
+}
+
+// availabilityQuery is helper function that prepares query of users preloading calendar for range of days in request
+// responds with error and returns false when range is not valid
+func availabilityQuery(ctx *gin.Context) (*gorm.DB, bool) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if date := ctx.Query("from"); date != "" {
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid date"})
+			return nil, false
+		}
+		from = day
+	}
+	to := from.AddDate(0, 0, AvailabilityDefaultDays-1)
+	if date := ctx.Query("to"); date != "" {
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil || day.Before(from) {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid date"})
+			return nil, false
+		}
+		to = day
+	}
+	query := utils.DB.Preload("Absences", func(db *gorm.DB) *gorm.DB {
+		return db.Order("start_time").Where("start_time < ? AND end_time > ?", to.AddDate(0, 0, 1), from)
+	}).Preload("PreferredShifts", func(db *gorm.DB) *gorm.DB {
+		return db.Order("weekday, start_time")
+	})
+	return query, true
+}
@@ -5,6 +5,7 @@ package views
 import (
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"time"
 
@@ -20,7 +21,12 @@ func ListConnections(ctx *gin.Context) {
 	var connections []serializers.ConnectionSerializer
 	var connection_models []models.Connection
 	var err error
-	err = utils.DB.Order("departure_time").Find(&connection_models).Error
+	err = utils.DB.Preload("ReassignMalfunc").Order("departure_time").Find(&connection_models).Error
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	in_maintenance, err := validators.Vehicles_in_maintenance()
 	if err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
@@ -60,8 +66,12 @@ func ListConnections(ctx *gin.Context) {
 			Direction:        model.Direction,
 			DriverName:       driver.FullName,
 			VehicleType:      vehicle.VehicleType.Type,
+			Status:           string(model.Status),
+			StatusReason:     model.StatusReason,
+			MalfuncRepID:     model.MalfuncRepRef,
 			StopInConnection: nil,
 		}
+		connection.NeedsReassignment = serializers.Needs_reassignment(&model, in_maintenance)
 		if connection.Direction == true {
 			connection.InitialStop = line.FinalStop
 			connection.FinalStop = line.InitialStop
@@ -76,85 +86,46 @@ func GetDetailOfConnection(ctx *gin.Context) {
 	id := ctx.Param("id")
 	var connection_model models.Connection
 	var err error
-	err = utils.DB.Where("driver_id IS NOT NULL AND vehicle_registration IS NOT NULL").Find(&connection_model, "id=?", id).Error
+	err = utils.DB.Where(serializers.PublicConnections).Find(&connection_model, "id=?", id).Error
 	if err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
 	connection := serializers.ConnectionDetailsSerializer{
-		ID:       connection_model.ID,
-		LineName: connection_model.LineName,
+		ID:           connection_model.ID,
+		LineName:     connection_model.LineName,
+		Status:       string(connection_model.Status),
+		StatusReason: connection_model.StatusReason,
 	}
-	connection.ListStops, err = getStops(connection_model.LineName, connection_model.Direction, connection_model.DepartureTime)
+	connection.ListStops, err = getStops(connection_model)
 	if err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
 
 	var vehicle models.Vehicle
-	err = utils.DB.First(&vehicle, "registration=?", connection_model.VehicleRegistration).Error
-	if err != nil {
-		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
-		return
+	if connection_model.VehicleRegistration != nil {
+		err = utils.DB.Preload("VehicleType").First(&vehicle, "registration=?", connection_model.VehicleRegistration).Error
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
 	}
 	connection.Type = vehicle.VehicleTypeName
+	if vehicle.VehicleTypeName != "" {
+		connection.TypeIcon = serializers.Vehicle_type_icon_url(&vehicle.VehicleType, false)
+	}
 	ctx.IndentedJSON(http.StatusOK, connection)
 }
 
-// getStops is helper function that loads stops depending on line
-// returns slice of loaded stops with their corresponding time and error if any
-func getStops(line_name string, direction bool, departure time.Time) (*[]serializers.StopInConnection, error) {
-	stops := []serializers.StopInConnection{}
-	var line models.Line
-	if err := utils.DB.Model(&line).Preload("Segments").First(&line, "Name = ?", line_name).Error; err != nil {
+// getStops is helper function that loads stops of connection depending on line
+// returns slice of loaded stops with their scheduled and expected time and error if any
+func getStops(connection_model models.Connection) (*[]serializers.StopInConnection, error) {
+	connection_stops, err := serializers.Expected_connection_stops(connection_model)
+	if err != nil {
 		return nil, err
 	}
-	dep_time := departure
-	if direction == false {
-		for i := 0; i < len(line.Segments); i++ {
-			if line.Segments[i].StopName2 == line.FinalStop && i == len(line.Segments)-1 {
-				stops = append(stops, serializers.StopInConnection{
-					StopName:      line.Segments[i].StopName1,
-					DepartureTime: dep_time.Format("15:04"),
-				})
-				dep_time = dep_time.Add(time.Minute * time.Duration(line.Segments[i].Time))
-				stops = append(stops, serializers.StopInConnection{
-					StopName:      line.Segments[i].StopName2,
-					DepartureTime: dep_time.Format("15:04"),
-				})
-				break
-			}
-			stops = append(stops, serializers.StopInConnection{
-				StopName:      line.Segments[i].StopName1,
-				DepartureTime: dep_time.Format("15:04"),
-			})
-			dep_time = dep_time.Add(time.Minute * time.Duration(line.Segments[i].Time))
-
-		}
-	} else {
-		// reverse direction
-		for i := len(line.Segments) - 1; i >= 0; i-- {
-			fmt.Print("Stop: ", line.Segments[i].StopName1, "\n")
-			if line.Segments[i].StopName1 == line.InitialStop && i == 0 {
-				stops = append(stops, serializers.StopInConnection{
-					StopName:      line.Segments[i].StopName2,
-					DepartureTime: dep_time.Format("15:04"),
-				})
-				dep_time = dep_time.Add(time.Minute * time.Duration(line.Segments[i].Time))
-				stops = append(stops, serializers.StopInConnection{
-					StopName:      line.Segments[i].StopName1,
-					DepartureTime: dep_time.Format("15:04"),
-				})
-				fmt.Print("Stop: ", line.Segments[i].StopName2, "\n")
-				break
-			}
-			stops = append(stops, serializers.StopInConnection{
-				StopName:      line.Segments[i].StopName2,
-				DepartureTime: dep_time.Format("15:04"),
-			})
-			dep_time = dep_time.Add(time.Minute * time.Duration(line.Segments[i].Time))
-		}
-	}
+	stops := serializers.Stops_in_connection(connection_stops)
 	return &stops, nil
 }
 
@@ -168,17 +139,26 @@ func GetConnectionById(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
+	connection, err := getConnection(connection_model)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, connection)
+}
+
+// getConnection is helper function that loads connection with its line, driver, vehicle and stops
+// for registered user
+func getConnection(connection_model models.Connection) (connection serializers.ConnectionSerializer, err error) {
 	line := models.Line{}
 	err = utils.DB.First(&line, "name=?", connection_model.LineName).Error
 	if err != nil {
-		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
 	driver := models.User{}
 	if connection_model.DriverID != nil {
 		err = utils.DB.Find(&driver, "id=?", connection_model.DriverID).Error
 		if err != nil {
-			ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 			return
 		}
 	}
@@ -186,18 +166,23 @@ func GetConnectionById(ctx *gin.Context) {
 	if connection_model.VehicleRegistration != nil {
 		err = utils.DB.Preload("VehicleType").Find(&vehicle, "registration=?", connection_model.VehicleRegistration).Error
 		if err != nil {
-			ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if connection_model.ReassignMalfuncRef != nil && connection_model.ReassignMalfunc == nil {
+		connection_model.ReassignMalfunc = &models.MalfunctionReport{}
+		err = utils.DB.First(connection_model.ReassignMalfunc, connection_model.ReassignMalfuncRef).Error
+		if err != nil {
 			return
 		}
 	}
 	var stops *[]serializers.StopInConnection
-	stops, err = getStops(connection_model.LineName, connection_model.Direction, connection_model.DepartureTime)
+	stops, err = getStops(connection_model)
 	if err != nil {
-		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
 
-	connection := serializers.ConnectionSerializer{
+	connection = serializers.ConnectionSerializer{
 		ConnectionID:     connection_model.ID,
 		LineName:         connection_model.LineName,
 		DepartureTime:    connection_model.DepartureTime.Format("2006-01-02 15:04"),
@@ -209,13 +194,21 @@ func GetConnectionById(ctx *gin.Context) {
 		Direction:        connection_model.Direction,
 		DriverName:       driver.FullName,
 		VehicleType:      vehicle.VehicleType.Type,
+		Status:           string(connection_model.Status),
+		StatusReason:     connection_model.StatusReason,
+		MalfuncRepID:     connection_model.MalfuncRepRef,
 		StopInConnection: stops,
 	}
+	var in_maintenance map[string]bool
+	if in_maintenance, err = validators.Vehicles_in_maintenance(); err != nil {
+		return
+	}
+	connection.NeedsReassignment = serializers.Needs_reassignment(&connection_model, in_maintenance)
 	if connection.Direction == true {
 		connection.InitialStop = line.FinalStop
 		connection.FinalStop = line.InitialStop
 	}
-	ctx.IndentedJSON(http.StatusOK, connection)
+	return
 }
 
 // ListConnectionsByLine lists all connections for given line for registered user
@@ -229,12 +222,17 @@ func ListConnectionsByLine(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
-	err = utils.DB.Order("departure_time").Find(&connection_models, "line_name=?", line).Error
+	err = utils.DB.Preload("ReassignMalfunc").Order("departure_time").Find(&connection_models, "line_name=?", line).Error
 	if err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
 	connections := []serializers.ConnectionSerializer{}
+	in_maintenance, err := validators.Vehicles_in_maintenance()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
 	for _, model := range connection_models {
 		driver := models.User{}
 		if model.DriverID != nil {
@@ -264,8 +262,12 @@ func ListConnectionsByLine(ctx *gin.Context) {
 			DriverID:         model.DriverID,
 			DriverName:       driver.FullName,
 			VehicleType:      vehicle.VehicleType.Type,
+			Status:           string(model.Status),
+			StatusReason:     model.StatusReason,
+			MalfuncRepID:     model.MalfuncRepRef,
 			StopInConnection: nil,
 		}
+		connection.NeedsReassignment = serializers.Needs_reassignment(&model, in_maintenance)
 		if connection.Direction == true {
 			connection.InitialStop = line_model.FinalStop
 			connection.FinalStop = line_model.InitialStop
@@ -287,12 +289,17 @@ func ListConnectionsByLineAndDate(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
-	err = utils.DB.Order("departure_time").Find(&connection_models, "line_name=? AND departure_time BETWEEN ? AND ? ", line, date, date+" 23:59:59").Error
+	err = utils.DB.Preload("ReassignMalfunc").Order("departure_time").Find(&connection_models, "line_name=? AND departure_time BETWEEN ? AND ? ", line, date, date+" 23:59:59").Error
 	if err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
 	connections := []serializers.ConnectionSerializer{}
+	in_maintenance, err := validators.Vehicles_in_maintenance()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
 	for _, model := range connection_models {
 		driver := models.User{}
 		if model.DriverID != nil {
@@ -322,8 +329,12 @@ func ListConnectionsByLineAndDate(ctx *gin.Context) {
 			DriverID:         model.DriverID,
 			DriverName:       driver.FullName,
 			VehicleType:      vehicle.VehicleType.Type,
+			Status:           string(model.Status),
+			StatusReason:     model.StatusReason,
+			MalfuncRepID:     model.MalfuncRepRef,
 			StopInConnection: nil,
 		}
+		connection.NeedsReassignment = serializers.Needs_reassignment(&model, in_maintenance)
 		if connection.Direction == true {
 			connection.InitialStop = line_model.FinalStop
 			connection.FinalStop = line_model.InitialStop
@@ -333,11 +344,13 @@ func ListConnectionsByLineAndDate(ctx *gin.Context) {
 	ctx.IndentedJSON(http.StatusOK, connections)
 }
 
-// GetConnectionById list all connections for specific driver
+// ListDriverConnections handles request for duty sheet of specific driver
+// connections are grouped into duties, connections without duty are grouped by day
 func ListDriverConnections(ctx *gin.Context) {
 	user_id := ctx.Param("id")
 	var connection_models []models.Connection
-	res := utils.DB.Where("role = ?", "driver").Find(&models.User{}, user_id)
+	driver := models.User{}
+	res := utils.DB.Where("role = ?", "driver").Find(&driver, user_id)
 	if res.Error != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
 		return
@@ -351,55 +364,72 @@ func ListDriverConnections(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
-	connections := []serializers.ConnectionSerializer{}
+	var duty_models []models.Duty
+	err = utils.DB.Preload("Deadheads").Order("sign_on").Find(&duty_models, "driver_id=?", user_id).Error
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	type sheetDuty struct {
+		start       time.Time
+		duty        *models.Duty
+		connections []models.Connection
+	}
+	sheet_duties := []*sheetDuty{}
+	duties := map[uint]*sheetDuty{}
+	for i := range duty_models {
+		duties[duty_models[i].ID] = &sheetDuty{start: duty_models[i].SignOn, duty: &duty_models[i]}
+		sheet_duties = append(sheet_duties, duties[duty_models[i].ID])
+	}
+	days := map[string]*sheetDuty{}
 	for _, model := range connection_models {
-		line := models.Line{}
-		err = utils.DB.First(&line, "name=?", model.LineName).Error
-		if err != nil {
-			ctx.IndentedJSON(http.StatusBadRequest, err.Error())
-			return
-		}
-		driver := models.User{}
-		if model.DriverID != nil {
-			err = utils.DB.Find(&driver, "id=?", model.DriverID).Error
-			if err != nil {
-				ctx.IndentedJSON(http.StatusBadRequest, err.Error())
-				return
+		if model.DutyID != nil {
+			if duty, ok := duties[*model.DutyID]; ok {
+				duty.connections = append(duty.connections, model)
+				continue
 			}
 		}
-		vehicle := models.Vehicle{}
-		if model.VehicleRegistration != nil {
-			err = utils.DB.Preload("VehicleType").Find(&vehicle, "registration=?", model.VehicleRegistration).Error
-			if err != nil {
-				ctx.IndentedJSON(http.StatusBadRequest, err.Error())
-				return
-			}
+		day := model.DepartureTime.Format("2006-01-02")
+		if _, ok := days[day]; !ok {
+			days[day] = &sheetDuty{start: model.DepartureTime}
+			sheet_duties = append(sheet_duties, days[day])
 		}
-		connection := serializers.ConnectionSerializer{
-			ConnectionID:     model.ID,
-			LineName:         model.LineName,
-			DepartureTime:    model.DepartureTime.Format("2006-01-02 15:04"),
-			ArrivalTime:      model.ArrivalTime.Format("2006-01-02 15:04"),
-			InitialStop:      line.InitialStop,
-			FinalStop:        line.FinalStop,
-			DriverID:         model.DriverID,
-			VehicleReg:       model.VehicleRegistration,
-			Direction:        model.Direction,
-			DriverName:       driver.FullName,
-			VehicleType:      vehicle.VehicleType.Type,
-			StopInConnection: nil,
-		}
-		if connection.Direction == true {
-			connection.InitialStop = line.FinalStop
-			connection.FinalStop = line.InitialStop
+		days[day].connections = append(days[day].connections, model)
+	}
+	sort.SliceStable(sheet_duties, func(i, j int) bool {
+		return sheet_duties[i].start.Before(sheet_duties[j].start)
+	})
+
+	sheet := serializers.DutySheetSerializer{
+		DriverID:   driver.ID,
+		DriverName: driver.FullName,
+		Duties:     []serializers.DutySerializer{},
+	}
+	for _, sheet_duty := range sheet_duties {
+		duty, err := getDuty(sheet_duty.duty, sheet_duty.connections)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
 		}
-		connections = append(connections, connection)
+		sheet.Duties = append(sheet.Duties, duty)
 	}
-	ctx.IndentedJSON(http.StatusOK, connections)
+	ctx.IndentedJSON(http.StatusOK, sheet)
+}
+
+// ListReassignments lists future connections which need other vehicle because their vehicle is in maintenance
+// optionally only for ?vehicle=
+func ListReassignments(ctx *gin.Context) {
+	reassignments, err := serializers.Connections_to_reassign(utils.Wall_clock_now(), ctx.Query("vehicle"))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, reassignments)
 }
 
 // CreateConnection handles request for creating new connections
-// can create multiple days depending of request
+// connections are created as recurring service and generated for days it runs in
 func CreateConnection(ctx *gin.Context) {
 	connection := serializers.ConnectionCreateSerializer{}
 
@@ -407,7 +437,7 @@ func CreateConnection(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
-	if connection.NumberOfDays > 365 || connection.NumberOfDays < 1 {
+	if connection.NumberOfDays > 365 || connection.NumberOfDays < 0 {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid number of days"})
 		return
 	}
@@ -416,13 +446,13 @@ func CreateConnection(ctx *gin.Context) {
 		return
 	}
 
-	connection_model, err := connection.CreateModel()
+	service_model, err := connection.CreateModel()
 	if err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if result := utils.DB.Create(connection_model); result.Error != nil {
+	if result := utils.DB.Create(service_model); result.Error != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, result.Error)
 		return
 	} else {
@@ -442,7 +472,6 @@ func AssignToConnection(ctx *gin.Context) {
 		return
 	}
 	connection := serializers.ConnectionAssignSerializer{}
-	orig_deptime := connection_model.DepartureTime
 	if err := ctx.BindJSON(&connection); err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
@@ -451,30 +480,31 @@ func AssignToConnection(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid number of days"})
 		return
 	}
-	line_name := connection_model.LineName
-	for i := 0; i < int(connection.NumberOfDays); i++ {
-		connection.DepartureTime = connection_model.DepartureTime.Format("2006-01-02 15:04")
-		connection.ArrivalTime = connection_model.ArrivalTime
-		if !connection.Valid(int(connection_model.ID)) {
-			ctx.IndentedJSON(http.StatusBadRequest, connection.ValidatorErrs)
+	series, err := seriesConnections(connection_model, connection.NumberOfDays)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, model := range series {
+		if model.DutyID != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Connection is part of duty, assign whole duty instead"})
 			return
 		}
-		connection_model.VehicleRegistration = connection.VehicleReg
-		connection_model.DriverID = connection.DriverID
-		models_to_change = append(models_to_change, connection_model)
-		connection_model = models.Connection{}
-		orig_deptime = orig_deptime.AddDate(0, 0, 1)
-		res := utils.DB.Where("departure_time=? AND line_name=?", orig_deptime, line_name).Find(&connection_model)
-		if res.Error != nil {
-			ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		connection.DepartureTime = model.DepartureTime.Format("2006-01-02 15:04")
+		connection.ArrivalTime = model.ArrivalTime
+		connection.LineName = model.LineName
+		if !connection.Valid(int(model.ID)) {
+			ctx.IndentedJSON(http.StatusBadRequest, connection.ValidatorErrs)
 			return
 		}
-		if res.RowsAffected == 0 {
-			break
-		}
-		connection.DepartureTime = connection_model.DepartureTime.Format("2006-01-02 15:04")
-		connection.ArrivalTime = connection_model.ArrivalTime
-		orig_deptime = connection_model.DepartureTime
+		model.VehicleRegistration = connection.VehicleReg
+		model.DriverID = connection.DriverID
+		models_to_change = append(models_to_change, model)
+	}
+	validators.Connections_working_time(models_to_change, &connection.ValidatorErrs)
+	if len(connection.ValidatorErrs) != 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, connection.ValidatorErrs)
+		return
 	}
 	for i := 0; i < len(models_to_change); i++ {
 		if result := utils.DB.Save(&models_to_change[i]); result.Error != nil {
@@ -507,8 +537,19 @@ func UpdateConnection(ctx *gin.Context) {
 		return
 	}
 	// multiple days handling
-	orig_deptime := connection_model.DepartureTime
-	for i := 0; i < connection.NumberOfDays; i++ {
+	series, err := seriesConnections(connection_model, connection.NumberOfDays)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	for i, connection_model := range series {
+		if connection_model.DutyID != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Connection is part of duty, edit whole duty instead"})
+			return
+		}
+		if i > 0 {
+			connection.DepartureTime = connection_model.DepartureTime.Format("2006-01-02 15:04")
+		}
 		connection.ArrivalTime = connection_model.ArrivalTime
 		if connection.LineName != connection_model.LineName {
 			validators.Line_name_validator(connection.LineName, &connection.ValidatorErrs)
@@ -516,12 +557,17 @@ func UpdateConnection(ctx *gin.Context) {
 		}
 		if connection.VehicleReg != connection_model.VehicleRegistration {
 			validators.Vehicle_registration_validator(connection.VehicleReg, &connection.ValidatorErrs)
+			validators.Vehicle_maintenance_validator(connection.VehicleReg, &connection.ValidatorErrs)
 			connection_model.VehicleRegistration = connection.VehicleReg
 		}
-		if connection.DriverID != connection_model.DriverID {
+		driver_set := connection.DriverID != connection_model.DriverID
+		if driver_set {
 			validators.Driver_id_validator(connection.DriverID, &connection.ValidatorErrs)
 			connection_model.DriverID = connection.DriverID
 		}
+		if len(connection.ValidatorErrs) == 0 {
+			validators.Line_vehicle_validator(connection_model.LineName, connection_model.VehicleRegistration, &connection.ValidatorErrs)
+		}
 		if len(connection.ValidatorErrs) != 0 {
 			ctx.IndentedJSON(http.StatusBadRequest, connection.ValidatorErrs)
 			return
@@ -532,30 +578,27 @@ func UpdateConnection(ctx *gin.Context) {
 			return
 		}
 		if !connection_model.DepartureTime.Equal(dep_time) {
-			arr_time := serializers.Get_arrival_time(dep_time, connection_model.LineName)
+			arr_time := serializers.Get_arrival_time(dep_time, connection_model.LineName, connection_model.Direction)
 			validators.Driver_availability(int(connection_model.ID), connection_model.DriverID, connection.DepartureTime, arr_time, 1, &connection.ValidatorErrs)
 			validators.Vehicle_availability(int(connection_model.ID), connection_model.VehicleRegistration, connection.DepartureTime, arr_time, 1, &connection.ValidatorErrs)
 			connection_model.DepartureTime = dep_time
 			connection_model.ArrivalTime = arr_time
+		} else if driver_set {
+			validators.Driver_availability(int(connection_model.ID), connection_model.DriverID, connection.DepartureTime, connection_model.ArrivalTime, 1, &connection.ValidatorErrs)
+		}
+		if len(connection.ValidatorErrs) == 0 {
+			validators.Driver_qualification_validator(connection_model.DriverID, connection_model.VehicleRegistration, connection_model.LineName, connection_model.DepartureTime, connection_model.ArrivalTime, &connection.ValidatorErrs)
 		}
 		if len(connection.ValidatorErrs) != 0 {
 			ctx.IndentedJSON(http.StatusBadRequest, connection.ValidatorErrs)
 			return
 		}
 		models_to_change = append(models_to_change, connection_model)
-		connection_model = models.Connection{}
-		orig_deptime = orig_deptime.AddDate(0, 0, 1)
-		res := utils.DB.Where("departure_time=? AND line_name=?", orig_deptime, connection.LineName).Find(&connection_model)
-		if res.Error != nil {
-			ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
-			return
-		}
-		if res.RowsAffected == 0 {
-			break
-		}
-		connection.DepartureTime = connection_model.DepartureTime.Format("2006-01-02 15:04")
-		orig_deptime = connection_model.DepartureTime
-
+	}
+	validators.Connections_working_time(models_to_change, &connection.ValidatorErrs)
+	if len(connection.ValidatorErrs) != 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, connection.ValidatorErrs)
+		return
 	}
 	//checking validity of updated connections
 	for i := 0; i < len(models_to_change); i++ {
@@ -580,6 +623,40 @@ func UpdateConnection(ctx *gin.Context) {
 	}
 }
 
+// UpdateConnectionStatus handles request for changing status of connection
+// connection can be cancelled or partially cancelled with reason instead of being deleted
+func UpdateConnectionStatus(ctx *gin.Context) {
+	connection_model := models.Connection{}
+	res := utils.DB.First(&connection_model, "id=?", ctx.Param("id"))
+	if res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
+		return
+	}
+	status := serializers.ConnectionStatusSerializer{}
+	if err := ctx.BindJSON(&status); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !status.Valid(&connection_model) {
+		ctx.IndentedJSON(http.StatusBadRequest, status.ValidatorErrs)
+		return
+	}
+	status.UpdateModel(&connection_model)
+	res = utils.DB.Model(&connection_model).
+		Select("Status", "StatusReason", "StatusManual", "MalfuncRepRef", "CancelledFromStop", "CancelledToStop").
+		Updates(&connection_model)
+	if res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	connection, err := getConnection(connection_model)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, connection)
+}
+
 // DeleteConnection handles request for deleting connection
 // can delete multiple days depending of request
 func DeleteConnection(ctx *gin.Context) {
@@ -600,30 +677,46 @@ func DeleteConnection(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
 		return
 	}
+	models_to_delete, err := seriesConnections(connection_model, numDays)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	for i := 0; i < len(models_to_delete); i++ {
+		if result := utils.DB.Delete(&models_to_delete[i]); result.Error != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, result.Error)
+			return
+		} else {
+			ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Connection deleted successfully"})
+		}
+	}
+}
+
+// seriesConnections returns connection and connections following it in the same series
+// for connections of service the next number_of_days runs of the service are returned,
+// older connections without service are found day by day until first missing day
+func seriesConnections(connection_model models.Connection, number_of_days int) ([]models.Connection, error) {
+	series := []models.Connection{}
+	if connection_model.ServiceID != nil {
+		res := utils.DB.Where("service_id = ? AND departure_time >= ?", connection_model.ServiceID, connection_model.DepartureTime).
+			Order("departure_time").Limit(number_of_days).Find(&series)
+		return series, res.Error
+	}
 	line_name := connection_model.LineName
-	models_to_delete := []models.Connection{}
 	orig_deptime := connection_model.DepartureTime
-	for i := 0; i < numDays; i++ {
-		models_to_delete = append(models_to_delete, connection_model)
+	for i := 0; i < number_of_days; i++ {
+		series = append(series, connection_model)
 		connection_model = models.Connection{}
 		orig_deptime = orig_deptime.AddDate(0, 0, 1)
-		res := utils.DB.Where("departure_time=? AND line_name=?", orig_deptime, line_name).Find(&connection_model)
+		res := utils.DB.Where("departure_time=? AND line_name=? AND service_id IS NULL", orig_deptime, line_name).Find(&connection_model)
 		if res.Error != nil {
-			ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
-			return
+			return nil, res.Error
 		}
 		if res.RowsAffected == 0 {
 			break
 		}
 	}
-	for i := 0; i < len(models_to_delete); i++ {
-		if result := utils.DB.Delete(&models_to_delete[i]); result.Error != nil {
-			ctx.IndentedJSON(http.StatusBadRequest, result.Error)
-			return
-		} else {
-			ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Connection deleted successfully"})
-		}
-	}
+	return series, nil
 }
 
 // ListUserConnections lists all connections for not registered user
@@ -631,7 +724,7 @@ func ListUserConnections(ctx *gin.Context) {
 	var connection_models []models.Connection
 	var connections []serializers.ConnectionUserSerializer
 	currentTime := time.Now()
-	res := utils.DB.Order("departure_time").Where("driver_id IS NOT NULL AND vehicle_registration IS NOT NULL AND departure_time > ?", currentTime).Find(&connection_models)
+	res := utils.DB.Order("departure_time").Where(serializers.PublicConnections+" AND departure_time > ?", currentTime).Find(&connection_models)
 	if res.Error != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
 		return
@@ -660,6 +753,13 @@ func ListUserConnections(ctx *gin.Context) {
 			FinalStop:     line.FinalStop,
 			Direction:     model.Direction,
 			VehicleType:   vehicle.VehicleType.Type,
+			Status:        string(model.Status),
+			StatusReason:  model.StatusReason,
+		}
+		connection.VehicleTypeIcon = serializers.Vehicle_type_icon_url(&vehicle.VehicleType, false)
+		if err := connection.Realtime(model); err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
 		}
 		if connection.Direction == true {
 			connection.InitialStop = line.FinalStop
@@ -682,7 +782,7 @@ func ListUserConnectionsByLine(ctx *gin.Context) {
 		return
 	}
 	currentTime := time.Now()
-	res = utils.DB.Order("departure_time").Where("driver_id IS NOT NULL AND vehicle_registration IS NOT NULL AND departure_time > ?", currentTime).Find(&connection_models, "line_name=?", line)
+	res = utils.DB.Order("departure_time").Where(serializers.PublicConnections+" AND departure_time > ?", currentTime).Find(&connection_models, "line_name=?", line)
 	if res.Error != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
 		return
@@ -705,6 +805,13 @@ func ListUserConnectionsByLine(ctx *gin.Context) {
 			FinalStop:     line_model.FinalStop,
 			Direction:     model.Direction,
 			VehicleType:   vehicle.VehicleType.Type,
+			Status:        string(model.Status),
+			StatusReason:  model.StatusReason,
+		}
+		connection.VehicleTypeIcon = serializers.Vehicle_type_icon_url(&vehicle.VehicleType, false)
+		if err := connection.Realtime(model); err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
 		}
 		if connection.Direction == true {
 			connection.InitialStop = line_model.FinalStop
@@ -727,7 +834,7 @@ func ListConnectionsUserByLineAndDate(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
 		return
 	}
-	res = utils.DB.Order("departure_time").Where("driver_id IS NOT NULL AND vehicle_registration IS NOT NULL").Find(&connection_models, "line_name=? AND departure_time BETWEEN ? AND ? ", line, date, date+" 23:59:59")
+	res = utils.DB.Order("departure_time").Where(serializers.PublicConnections).Find(&connection_models, "line_name=? AND departure_time BETWEEN ? AND ? ", line, date, date+" 23:59:59")
 	if res.Error != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
 		return
@@ -750,6 +857,13 @@ func ListConnectionsUserByLineAndDate(ctx *gin.Context) {
 			FinalStop:     line_model.FinalStop,
 			Direction:     model.Direction,
 			VehicleType:   vehicle.VehicleType.Type,
+			Status:        string(model.Status),
+			StatusReason:  model.StatusReason,
+		}
+		connection.VehicleTypeIcon = serializers.Vehicle_type_icon_url(&vehicle.VehicleType, false)
+		if err := connection.Realtime(model); err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
 		}
 		if connection.Direction {
 			connection.InitialStop = line_model.FinalStop
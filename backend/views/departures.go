@@ -0,0 +1,257 @@
+// package views contains views used in router handlers
+// this file contains views for departure boards of stops
+package views
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// departure board limits
+const (
+	departuresHorizon      = 24 * time.Hour
+	departuresDefaultLimit = 10
+	departuresMaxLimit     = 50
+)
+
+// departureBoardTemplate renders departure board for display screens
+var departureBoardTemplate = template.Must(template.New("board").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>{{.StopName}}</title>
+</head>
+<body>
+<h1>{{.StopName}}</h1>
+<table>
+<tr><th>Time</th><th>Expected</th><th>Line</th><th>Destination</th><th>Platform</th><th>Vehicle</th></tr>
+{{range .Departures}}<tr><td>{{.DepartureTime}}</td><td>{{if .Cancelled}}cancelled{{else if .ExpectedDepartureTime}}{{.ExpectedDepartureTime}}{{end}}</td><td>{{.LineName}}</td><td>{{.Destination}}</td><td>{{if .Platform}}{{.Platform}}{{end}}</td><td>{{.VehicleType}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// ListStopDepartures lists next departures from stop across all lines for not registered user
+// board of platform or station lists departures from the whole station with their platforms
+// board is returned as JSON, plain text or HTML depending on format query or Accept header
+func ListStopDepartures(ctx *gin.Context) {
+	stop := models.Stop{}
+	if res := utils.DB.First(&stop, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Stop not found"})
+		return
+	}
+	from := utils.Wall_clock_now()
+	if value := ctx.Query("from"); value != "" {
+		var err error
+		from, err = time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid time"})
+			return
+		}
+	}
+	limit, err := plannerIntQuery(ctx, "limit", departuresDefaultLimit, 1, departuresMaxLimit)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	station, stop_names, err := serializers.Station_stops(stop)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	departures, err := stopDepartures(stop_names, from, limit)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	board := serializers.DepartureBoardSerializer{
+		StopID:     station.ID,
+		StopName:   station.Name,
+		Departures: departures,
+	}
+
+	format := ctx.Query("format")
+	if format == "" {
+		switch ctx.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML, gin.MIMEPlain) {
+		case gin.MIMEHTML:
+			format = "html"
+		case gin.MIMEPlain:
+			format = "text"
+		default:
+			format = "json"
+		}
+	}
+	switch format {
+	case "json":
+		ctx.IndentedJSON(http.StatusOK, board)
+	case "text":
+		ctx.String(http.StatusOK, departureBoardText(board))
+	case "html":
+		var buffer bytes.Buffer
+		if err := departureBoardTemplate.Execute(&buffer, board); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", buffer.Bytes())
+	default:
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid format, use json, text or html"})
+	}
+}
+
+// stopDepartures finds next departures from stops of station available to passengers
+// connections are not departing from last stop they serve, cancelled departures are included
+// only already generated connections are read, board makes no changes
+func stopDepartures(stop_names []string, from time.Time, limit int) ([]serializers.DepartureSerializer, error) {
+	var station_stops []models.Stop
+	if res := utils.DB.Where("name IN ?", stop_names).Find(&station_stops); res.Error != nil {
+		return nil, res.Error
+	}
+	platforms := map[string]*string{}
+	for _, stop := range station_stops {
+		platforms[stop.Name] = stop.Platform
+	}
+	var line_names []string
+	res := utils.DB.Model(&models.Segment{}).Distinct("line_name").
+		Where("stop_name1 IN ? OR stop_name2 IN ?", stop_names, stop_names).Pluck("line_name", &line_names)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	departures := []serializers.DepartureSerializer{}
+	if len(line_names) == 0 {
+		return departures, nil
+	}
+	var connection_models []models.Connection
+	res = utils.DB.Order("departure_time").
+		Where(serializers.PublicConnections+" AND line_name IN ? AND arrival_time >= ? AND departure_time <= ?", line_names, from, from.Add(departuresHorizon)).
+		Find(&connection_models)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	type departure struct {
+		time       time.Time
+		connection models.Connection
+		stops      []serializers.LineStop
+		index      int
+	}
+	found := []departure{}
+	line_stops := map[string][]serializers.LineStop{}
+	for _, model := range connection_models {
+		key := fmt.Sprint(model.LineName, model.Direction)
+		stops, ok := line_stops[key]
+		if !ok {
+			line, err := serializers.Get_line(model.LineName)
+			if err != nil {
+				return nil, err
+			}
+			stops = serializers.Line_stops(line.Segments, model.Direction)
+			line_stops[key] = stops
+		}
+		final := serializers.Final_stop_index(&model, len(stops))
+		for i := 0; i < len(stops)-1; i++ {
+			if i == final {
+				break
+			}
+			departure_time := model.DepartureTime.Add(stops[i].Departure)
+			if _, ok := platforms[stops[i].StopName]; ok && !departure_time.Before(from) {
+				found = append(found, departure{departure_time, model, stops, i})
+			}
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].time.Before(found[j].time)
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+
+	stations, err := serializers.Stop_stations()
+	if err != nil {
+		return nil, err
+	}
+	vehicle_types := map[string]string{}
+	for _, item := range found {
+		vehicle_type := ""
+		if item.connection.VehicleRegistration != nil {
+			var err error
+			vehicle_type, err = vehicleType(*item.connection.VehicleRegistration, vehicle_types)
+			if err != nil {
+				return nil, err
+			}
+		}
+		destination := item.stops[len(item.stops)-1].StopName
+		if final := serializers.Final_stop_index(&item.connection, len(item.stops)); final != -1 {
+			destination = item.stops[final].StopName
+		}
+		if station, ok := stations[destination]; ok {
+			destination = station
+		}
+		departure := serializers.DepartureSerializer{
+			ConnectionID:  item.connection.ID,
+			LineName:      item.connection.LineName,
+			Destination:   destination,
+			StopName:      item.stops[item.index].StopName,
+			Platform:      platforms[item.stops[item.index].StopName],
+			DepartureTime: item.time.Format("2006-01-02 15:04"),
+			Cancelled:     item.connection.StopCancelled(item.index),
+			VehicleType:   vehicle_type,
+		}
+		if item.connection.Delay != nil && !departure.Cancelled {
+			expected, err := serializers.Expected_connection_stops(item.connection)
+			if err != nil {
+				return nil, err
+			}
+			if item.index < len(expected) && expected[item.index].ExpectedDepartureTime != nil {
+				expected_time := expected[item.index].ExpectedDepartureTime.Format("2006-01-02 15:04")
+				departure.ExpectedDepartureTime = &expected_time
+			}
+		}
+		departures = append(departures, departure)
+	}
+	return departures, nil
+}
+
+// vehicleType returns type of vehicle with given registration, loaded types are kept in cache
+func vehicleType(registration string, cache map[string]string) (string, error) {
+	if vehicle_type, ok := cache[registration]; ok {
+		return vehicle_type, nil
+	}
+	vehicle := models.Vehicle{}
+	if err := utils.DB.Preload("VehicleType").Find(&vehicle, "registration=?", registration).Error; err != nil {
+		return "", err
+	}
+	cache[registration] = vehicle.VehicleType.Type
+	return vehicle.VehicleType.Type, nil
+}
+
+// departureBoardText formats departure board as plain text table
+func departureBoardText(board serializers.DepartureBoardSerializer) string {
+	var text strings.Builder
+	text.WriteString(board.StopName + "\n")
+	for _, departure := range board.Departures {
+		expected := ""
+		if departure.Cancelled {
+			expected = "cancel"
+		} else if departure.ExpectedDepartureTime != nil && *departure.ExpectedDepartureTime != departure.DepartureTime {
+			expected = "(" + (*departure.ExpectedDepartureTime)[11:] + ")"
+		}
+		platform := ""
+		if departure.Platform != nil {
+			platform = *departure.Platform
+		}
+		fmt.Fprintf(&text, "%s %-7s %-6s %-30s %-4s %s\n", departure.DepartureTime[11:], expected, departure.LineName, departure.Destination, platform, departure.VehicleType)
+	}
+	return text.String()
+}
@@ -0,0 +1,183 @@
+// package views contains views used in router handlers
+// this file contains views for duties of drivers
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListDuties lists duties ordered by sign-on, optionally only duties signing on at given date
+func ListDuties(ctx *gin.Context) {
+	var duty_models []models.Duty
+	query := utils.DB.Preload("Deadheads").Preload("Connections").Order("sign_on")
+	if date := ctx.Query("date"); date != "" {
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid date"})
+			return
+		}
+		query = query.Where("sign_on >= ? AND sign_on < ?", day, day.AddDate(0, 0, 1))
+	}
+	if res := query.Find(&duty_models); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	duties := []serializers.DutySerializer{}
+	for i := range duty_models {
+		duty, err := getDuty(&duty_models[i], duty_models[i].Connections)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		duties = append(duties, duty)
+	}
+	ctx.IndentedJSON(http.StatusOK, duties)
+}
+
+// GetDuty gets duty with given id
+func GetDuty(ctx *gin.Context) {
+	duty_model := models.Duty{}
+	if res := utils.DB.Preload("Deadheads").Preload("Connections").First(&duty_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Duty not found"})
+		return
+	}
+	duty, err := getDuty(&duty_model, duty_model.Connections)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, duty)
+}
+
+// CreateDuty handles request for creating duty from connections and deadhead legs
+func CreateDuty(ctx *gin.Context) {
+	duty := serializers.DutyCreateSerializer{}
+	if err := ctx.BindJSON(&duty); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !duty.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, duty.ValidatorErrs)
+		return
+	}
+	duty_model, err := duty.Create()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	response, err := getDuty(duty_model, duty_model.Connections)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// AssignDuty handles request for assigning driver and vehicle to all connections of duty at once
+func AssignDuty(ctx *gin.Context) {
+	duty_model := models.Duty{}
+	if res := utils.DB.Preload("Deadheads").Preload("Connections").First(&duty_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Duty not found"})
+		return
+	}
+	assign := serializers.DutyAssignSerializer{}
+	if err := ctx.BindJSON(&assign); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !assign.Valid(&duty_model, duty_model.Connections) {
+		ctx.IndentedJSON(http.StatusBadRequest, assign.ValidatorErrs)
+		return
+	}
+	duty_model.DriverID = assign.DriverID
+	duty_model.VehicleRegistration = assign.VehicleReg
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&duty_model).Select("DriverID", "VehicleRegistration").Updates(&duty_model).Error; err != nil {
+			return err
+		}
+		return serializers.Assign_duty(tx, &duty_model, duty_model.Connections)
+	})
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	response, err := getDuty(&duty_model, duty_model.Connections)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// DeleteDuty handles request for deleting duty
+// connections of duty are kept with their driver and vehicle
+func DeleteDuty(ctx *gin.Context) {
+	duty_model := models.Duty{}
+	if res := utils.DB.First(&duty_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Duty not found"})
+		return
+	}
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Connection{}).Where("duty_id = ?", duty_model.ID).Update("duty_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Select("Deadheads").Delete(&duty_model).Error
+	})
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Duty deleted successfully"})
+}
+
+// getDuty is helper function that serializes duty with its items in order
+// without duty the connections are serialized as duty from first departure to last arrival
+func getDuty(duty_model *models.Duty, connection_models []models.Connection) (duty serializers.DutySerializer, err error) {
+	deadheads := []models.DeadheadLeg{}
+	if duty_model != nil {
+		deadheads = duty_model.Deadheads
+	}
+	activities, err := serializers.Duty_activities(connection_models, deadheads)
+	if err != nil {
+		return
+	}
+	trips := map[uint]*serializers.ConnectionSerializer{}
+	for _, model := range connection_models {
+		connection, err := getConnection(model)
+		if err != nil {
+			return duty, err
+		}
+		trips[model.ID] = &connection
+	}
+
+	if duty_model != nil {
+		duty.DutyID = &duty_model.ID
+		duty.DepotName = duty_model.DepotName
+		duty.DriverID = duty_model.DriverID
+		duty.VehicleReg = duty_model.VehicleRegistration
+		duty.SignOn = duty_model.SignOn.Format("2006-01-02 15:04")
+		duty.SignOff = duty_model.SignOff.Format("2006-01-02 15:04")
+		duty.Items = serializers.Duty_items(activities, trips, duty_model.DepotName, duty_model.SignOn, duty_model.SignOff)
+	} else if len(activities) != 0 {
+		sign_on, sign_off := activities[0].Start, activities[len(activities)-1].End
+		duty.DriverID = connection_models[0].DriverID
+		duty.SignOn = sign_on.Format("2006-01-02 15:04")
+		duty.SignOff = sign_off.Format("2006-01-02 15:04")
+		duty.Items = serializers.Duty_items(activities, trips, "", sign_on, sign_off)
+	}
+	if duty.DriverID != nil {
+		driver := models.User{}
+		if err = utils.DB.Find(&driver, "id=?", duty.DriverID).Error; err != nil {
+			return
+		}
+		duty.DriverName = driver.FullName
+	}
+	return
+}
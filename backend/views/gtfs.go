@@ -0,0 +1,61 @@
+// package views contains views used in router handlers
+// this file contains views for GTFS feeds
+package views
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/AdamPekny/IIS/backend/gtfs"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ExportGTFS handles request for static GTFS feed with whole timetable
+func ExportGTFS(ctx *gin.Context) {
+	var feed bytes.Buffer
+	if err := gtfs.Export(&feed); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.Header("Content-Disposition", "attachment; filename=gtfs.zip")
+	ctx.Data(http.StatusOK, "application/zip", feed.Bytes())
+}
+
+// ImportGTFS handles request for importing static GTFS feed
+// with dry_run=true query parameter only reports what would change
+func ImportGTFS(ctx *gin.Context) {
+	file_header, err := ctx.FormFile("feed")
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Feed file is required"})
+		return
+	}
+	file, err := file_header.Open()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	report, err := gtfs.Import(file, file_header.Size, ctx.Query("dry_run") == "true")
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, report)
+}
+
+// GTFSRealtime handles request for GTFS-Realtime feed with trip updates and vehicle positions
+// with format=json query parameter feed is rendered as JSON for debugging
+func GTFSRealtime(ctx *gin.Context) {
+	feed, err := gtfs.Realtime(utils.Wall_clock_now())
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if ctx.Query("format") == "json" {
+		ctx.IndentedJSON(http.StatusOK, feed)
+		return
+	}
+	ctx.Data(http.StatusOK, "application/x-protobuf", feed.Marshal())
+}
@@ -0,0 +1,160 @@
+// package views contains views used in router handlers
+// this file contains views for photos of vehicles and icons of vehicle types
+package views
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/AdamPekny/IIS/backend/images"
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/storage"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+	"github.com/gin-gonic/gin"
+)
+
+// UploadVehicleImage handles upload of photo into multipart field file of vehicle, previous photo is replaced
+func UploadVehicleImage(ctx *gin.Context) {
+	vehicle := models.Vehicle{}
+	if res := utils.DB.First(&vehicle, "registration = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Vehicle not found"})
+		return
+	}
+	data, ok := bindImage(ctx)
+	if !ok {
+		return
+	}
+	if err := serializers.Save_vehicle_image(&vehicle, data); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"ImageURL":     serializers.Vehicle_image_url(&vehicle, false),
+		"ThumbnailURL": serializers.Vehicle_image_url(&vehicle, true),
+	})
+}
+
+// GetVehicleImage serves photo of vehicle, its thumbnail is served with query size=thumb
+func GetVehicleImage(ctx *gin.Context) {
+	vehicle := models.Vehicle{}
+	if res := utils.DB.First(&vehicle, "registration = ?", ctx.Param("id")); res.Error != nil || vehicle.ImageKey == nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Vehicle has no photo"})
+		return
+	}
+	serveImage(ctx, *vehicle.ImageKey, "image/jpeg")
+}
+
+// DeleteVehicleImage removes photo of vehicle
+func DeleteVehicleImage(ctx *gin.Context) {
+	vehicle := models.Vehicle{}
+	if res := utils.DB.First(&vehicle, "registration = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Vehicle not found"})
+		return
+	}
+	if vehicle.ImageKey == nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Vehicle has no photo"})
+		return
+	}
+	res := utils.DB.Model(&vehicle).Updates(map[string]interface{}{"image_key": nil, "image_updated_at": nil})
+	if res.Error != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	serializers.Remove_image(vehicle.ImageKey)
+	ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Photo deleted successfully"})
+}
+
+// UploadVehicleTypeIcon handles upload of icon into multipart field file of vehicle type, previous icon is replaced
+func UploadVehicleTypeIcon(ctx *gin.Context) {
+	vehicle_type := models.VehicleType{}
+	if res := utils.DB.First(&vehicle_type, "type = ?", ctx.Param("type")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Vehicle type not found"})
+		return
+	}
+	data, ok := bindImage(ctx)
+	if !ok {
+		return
+	}
+	if err := serializers.Save_vehicle_type_icon(&vehicle_type, data); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"IconURL":          serializers.Vehicle_type_icon_url(&vehicle_type, false),
+		"IconThumbnailURL": serializers.Vehicle_type_icon_url(&vehicle_type, true),
+	})
+}
+
+// GetVehicleTypeIcon serves icon of vehicle type, its thumbnail is served with query size=thumb
+func GetVehicleTypeIcon(ctx *gin.Context) {
+	vehicle_type := models.VehicleType{}
+	if res := utils.DB.First(&vehicle_type, "type = ?", ctx.Param("type")); res.Error != nil || vehicle_type.IconKey == nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Vehicle type has no icon"})
+		return
+	}
+	serveImage(ctx, *vehicle_type.IconKey, "image/png")
+}
+
+// bindImage reads uploaded image from multipart field file and validates it
+// responds with error and returns false when image is not valid
+func bindImage(ctx *gin.Context) ([]byte, bool) {
+	file_header, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Multipart field file is required"})
+		return nil, false
+	}
+	validator_errs := []validators.ValidatorErr{}
+	if max_size := validators.Attachment_max_size(); file_header.Size > max_size {
+		validator_errs = append(validator_errs, validators.ValidatorErr{Name: "ImageErr", Desc: fmt.Sprintf("Image is larger than %d MB", max_size>>20)})
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": validator_errs})
+		return nil, false
+	}
+	file, err := file_header.Open()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if len(data) == 0 {
+		validator_errs = append(validator_errs, validators.ValidatorErr{Name: "ImageErr", Desc: "Image is empty"})
+	}
+	if validators.Image_validator(data, &validator_errs); len(validator_errs) != 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": validator_errs})
+		return nil, false
+	}
+	return data, true
+}
+
+// serveImage responds with image stored under key or with its thumbnail when query size=thumb
+// URLs of images are versioned by time of upload, so images can be cached for long time
+func serveImage(ctx *gin.Context, key string, content_type string) {
+	if ctx.Query("size") == "thumb" {
+		key = images.Thumbnail_key(key)
+	}
+	files, err := storage.Default()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	content, err := files.GetObject(key)
+	if err == storage.ErrNotFound {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	} else if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer content.Close()
+	ctx.DataFromReader(http.StatusOK, -1, content_type, content, map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "public, max-age=31536000, immutable",
+	})
+}
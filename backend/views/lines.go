@@ -4,12 +4,13 @@ package views
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/AdamPekny/IIS/backend/models"
 	"github.com/AdamPekny/IIS/backend/serializers"
 	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // ListsLines lists every line in the database
@@ -56,25 +57,23 @@ func CreateLine(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
-	if len(lineSerializer.StopsSequence) < 2 {
-		ctx.IndentedJSON(http.StatusBadRequest, "Line must have at least 2 stops")
+	if !lineSerializer.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, lineSerializer.ValidatorErrs)
 		return
 	}
-	segments := []models.Segment{}
-	for i := 0; i < len(lineSerializer.StopsSequence)-1; i++ {
-		segment := models.Segment{
-			StopName1: lineSerializer.StopsSequence[i].StopName,
-			StopName2: lineSerializer.StopsSequence[i+1].StopName,
-			Time:      lineSerializer.StopsSequence[i].Duration,
-			LineName:  lineSerializer.Name,
-		}
-		segments = append(segments, segment)
+	segments := lineSerializer.Segments()
+	vehicleTypes, err := serializers.Get_vehicle_types(lineSerializer.VehicleTypes)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
 	}
 	line := models.Line{
-		Name:        lineSerializer.Name,
-		InitialStop: lineSerializer.StopsSequence[0].StopName,
-		FinalStop:   lineSerializer.StopsSequence[len(lineSerializer.StopsSequence)-1].StopName,
-		Segments:    segments,
+		Name:         lineSerializer.Name,
+		InitialStop:  lineSerializer.StopsSequence[0].StopName,
+		FinalStop:    lineSerializer.StopsSequence[len(lineSerializer.StopsSequence)-1].StopName,
+		MinCapacity:  lineSerializer.MinCapacity,
+		VehicleTypes: vehicleTypes,
+		Segments:     segments,
 	}
 	res := utils.DB.Create(&line)
 	if res.Error != nil {
@@ -85,6 +84,7 @@ func CreateLine(ctx *gin.Context) {
 }
 
 // UpdateLine updates a line deletes its segments and creates new ones
+// vehicles allowed on line can not be restricted while incompatible vehicle is assigned to its future connection
 func UpdateLine(ctx *gin.Context) {
 	lineName := ctx.Param("line")
 	var lineSerializer serializers.LineUpdateSerializer
@@ -93,16 +93,25 @@ func UpdateLine(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
-	if len(lineSerializer.StopsSequence) < 2 {
-		ctx.IndentedJSON(http.StatusBadRequest, "Line must have at least 2 stops")
+	if !lineSerializer.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, lineSerializer.ValidatorErrs)
 		return
 	}
 	var line models.Line
-	res := utils.DB.Preload("Segments").First(&line, "Name = ?", lineName)
+	res := utils.DB.Preload("Segments").Preload("VehicleTypes").First(&line, "Name = ?", lineName)
 	if res.Error != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
 		return
 	}
+	if err := lineSerializer.UpdateVehicles(&line); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	validators.Line_vehicles_validator(&line, &lineSerializer.ValidatorErrs)
+	if len(lineSerializer.ValidatorErrs) != 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, lineSerializer.ValidatorErrs)
+		return
+	}
 	for _, segment := range line.Segments {
 		res := utils.DB.Delete(&segment)
 		if res.Error != nil {
@@ -110,17 +119,7 @@ func UpdateLine(ctx *gin.Context) {
 			return
 		}
 	}
-	segments := []models.Segment{}
-	var duration uint
-	for i := 0; i < len(lineSerializer.StopsSequence)-1; i++ {
-		duration += lineSerializer.StopsSequence[i].Duration
-		segment := models.Segment{
-			StopName1: lineSerializer.StopsSequence[i].StopName,
-			StopName2: lineSerializer.StopsSequence[i+1].StopName,
-			Time:      lineSerializer.StopsSequence[i].Duration,
-		}
-		segments = append(segments, segment)
-	}
+	segments := lineSerializer.Segments(lineName)
 	line.InitialStop = lineSerializer.StopsSequence[0].StopName
 	line.FinalStop = lineSerializer.StopsSequence[len(lineSerializer.StopsSequence)-1].StopName
 	line.Segments = segments
@@ -129,6 +128,10 @@ func UpdateLine(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
 		return
 	}
+	if err := utils.DB.Model(&line).Association("VehicleTypes").Replace(line.VehicleTypes); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
 	connections := []models.Connection{}
 	res = utils.DB.Find(&connections, "line_name = ?", lineName)
 	if res.Error != nil {
@@ -137,7 +140,7 @@ func UpdateLine(ctx *gin.Context) {
 	}
 
 	for _, connection := range connections {
-		connection.ArrivalTime = connection.DepartureTime.Add(time.Minute * time.Duration(duration))
+		connection.ArrivalTime = connection.DepartureTime.Add(serializers.Line_duration(segments, connection.Direction))
 		res = utils.DB.Save(&connection)
 		if res.Error != nil {
 			ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
@@ -158,3 +161,26 @@ func DeleteLine(ctx *gin.Context) {
 	}
 	ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Line deleted successfully"})
 }
+
+// ListLinesGeoJSON lists lines as GeoJSON line strings through their stops, one for each direction
+// only line given by optional line query is listed
+func ListLinesGeoJSON(ctx *gin.Context) {
+	var lineModels []models.Line
+	query := utils.DB.Preload("Segments", func(db *gorm.DB) *gorm.DB {
+		return db.Order("direction, sequence, id")
+	}).Order("name")
+	if line := ctx.Query("line"); line != "" {
+		query = query.Where("name = ?", line)
+	}
+	if res := query.Find(&lineModels); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	var stopModels []models.Stop
+	if res := utils.DB.Find(&stopModels); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	ctx.Header("Content-Type", "application/geo+json; charset=utf-8")
+	ctx.IndentedJSON(http.StatusOK, serializers.Lines_geojson(lineModels, stopModels))
+}
@@ -6,7 +6,9 @@ import (
 	"github.com/AdamPekny/IIS/backend/models"
 	"github.com/AdamPekny/IIS/backend/serializers"
 	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // MALFUNCTION REPORT
@@ -33,11 +35,18 @@ func CreateMalfuncReport(ctx *gin.Context) {
 
 	malfunc_report_model := malfunc_report_serializer.ToModel()
 
-	result := utils.DB.Create(malfunc_report_model)
+	// connections of broken vehicle for rest of today are flagged for reassignment together with the report
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Create(malfunc_report_model); result.Error != nil {
+			return result.Error
+		}
+		_, err := serializers.Flag_vehicle_connections(tx, malfunc_report_model)
+		return err
+	})
 
-	if result.Error != nil {
+	if err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-			"error": result.Error.Error(),
+			"error": err.Error(),
 		})
 		return
 	}
@@ -260,6 +269,14 @@ func DeleteMalfuncReport(ctx *gin.Context) {
 		return
 	}
 
+	attachments, err := serializers.Find_attachments("malfunc_rep_ref = ? OR mainten_rep_ref IN (SELECT maintenance_reports.id FROM maintenance_reports JOIN maintenance_requests ON maintenance_reports.mainten_req_ref = maintenance_requests.id WHERE maintenance_requests.malfunc_rep_ref = ?)", id, id)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	if result := utils.DB.Delete(report_model); result.Error != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"error": result.Error.Error(),
@@ -267,6 +284,8 @@ func DeleteMalfuncReport(ctx *gin.Context) {
 		return
 	}
 
+	serializers.Remove_attachment_files(attachments)
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"message": "malfunction report deleted successfully",
 	})
@@ -307,11 +326,13 @@ func CreateMaintenRequest(ctx *gin.Context) {
 	}
 
 	// Fill Malfunction report
-	if result := utils.DB.First(&mainten_req_model.MalfuncRep, mainten_req_model.MalfuncRepRef); result.Error != nil {
-		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-			"errors": result.Error.Error(),
-		})
-		return
+	if mainten_req_model.MalfuncRepRef != nil {
+		if result := utils.DB.First(&mainten_req_model.MalfuncRep, mainten_req_model.MalfuncRepRef); result.Error != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+				"errors": result.Error.Error(),
+			})
+			return
+		}
 	}
 
 	// Fill Created By
@@ -388,13 +409,15 @@ func ListStatusMaintenRequests(ctx *gin.Context) {
 	}
 	
 	status := ctx.Query("status")
-	if status == string(models.PendingStatus) || status == string(models.InProgressStatus) || status == string(models.DoneStatus) {
+	status_errs := []validators.ValidatorErr{}
+	validators.StatusValidator(status, &status_errs)
+	if status != "" && len(status_errs) == 0 {
 		db_query = db_query.Where("status = ?", status)
 	}
 
 	vehicle := ctx.Query("vehicle")
 	if vehicle != "" {
-		db_query = db_query.Joins("JOIN malfunction_reports ON malfunction_reports.id = maintenance_requests.malfunc_rep_ref").Where("malfunction_reports.vehicle_ref = ?", vehicle)
+		db_query = db_query.Where("maintenance_requests.vehicle_ref = ?", vehicle)
 	}
 
 	if result := db_query.Preload("MalfuncRep").Preload("CreatedBy").Preload("ResolvedBy").Find(&mainten_req_models); result.Error != nil {
@@ -578,20 +601,48 @@ func UpdateMaintenRequest(ctx *gin.Context) {
 		return
 	}
 
-	if result := utils.DB.Save(mainten_req_model); result.Error != nil {
+	// Technician on leave can not take the request, technician already resolving it is kept
+	if mainten_req_serializer.ResolverChanged() {
+		validators.Technician_availability(mainten_req_model.ResolvedByRef, mainten_req_model.Deadline, &mainten_req_serializer.ValidatorErrs)
+	}
+	if len(mainten_req_serializer.ValidatorErrs) != 0 {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-			"errors": result.Error.Error(),
+			"errors": mainten_req_serializer.ValidatorErrs,
 		})
 		return
 	}
 
-	// Fill Malfunction report
-	if result := utils.DB.First(&mainten_req_model.MalfuncRep, mainten_req_model.MalfuncRepRef); result.Error != nil {
+	status_serializer := serializers.MaintenReqStatusSerializer{Status: mainten_req_serializer.Status}
+	if status_serializer.Status != mainten_req_model.Status && !status_serializer.Valid(mainten_req_model, logged_user) {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-			"errors": result.Error.Error(),
+			"errors": status_serializer.ValidatorErrs,
+		})
+		return
+	}
+
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Omit("Status").Save(mainten_req_model); result.Error != nil {
+			return result.Error
+		}
+		return status_serializer.Apply(tx, mainten_req_model, logged_user)
+	})
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"errors": err.Error(),
 		})
 		return
 	}
+	mainten_req_model.Status = status_serializer.Status
+
+	// Fill Malfunction report
+	if mainten_req_model.MalfuncRepRef != nil {
+		if result := utils.DB.First(&mainten_req_model.MalfuncRep, mainten_req_model.MalfuncRepRef); result.Error != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+				"errors": result.Error.Error(),
+			})
+			return
+		}
+	}
 
 	// Fill Created By
 	if result := utils.DB.First(&mainten_req_model.CreatedBy, mainten_req_model.CreatedByRef); result.Error != nil {
@@ -668,6 +719,15 @@ func AssignTechMaintenRequest(ctx *gin.Context) {
 		return
 	}
 
+	// Technician on leave can not take the request
+	validators.Technician_availability(mainten_req_model.ResolvedByRef, mainten_req_model.Deadline, &mainten_req_serializer.ValidatorErrs)
+	if len(mainten_req_serializer.ValidatorErrs) != 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"errors": mainten_req_serializer.ValidatorErrs,
+		})
+		return
+	}
+
 	if result := utils.DB.Model(mainten_req_model).Update("resolved_by_ref", mainten_req_model.ResolvedByRef); result.Error != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
 			"error": result.Error.Error(),
@@ -695,6 +755,91 @@ func AssignTechMaintenRequest(ctx *gin.Context) {
 	ctx.IndentedJSON(http.StatusOK, mainten_req_pub_serializer)
 }
 
+// ChangeMaintenRequestStatus changes status of maintenance request if the transition is allowed for role of user
+// every change is recorded in status history of the request
+func ChangeMaintenRequestStatus(ctx *gin.Context) {
+	var status_serializer serializers.MaintenReqStatusSerializer
+	var mainten_req_model models.MaintenanceRequest
+
+	if err := ctx.BindJSON(&status_serializer); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	logged_user, err := models.GetUserFromCtx(ctx)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if result := utils.DB.Preload("MalfuncRep").Preload("CreatedBy").Preload("ResolvedBy").First(&mainten_req_model, ctx.Param("id")); result.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"error": "Maintenance request not found",
+		})
+		return
+	}
+
+	if !status_serializer.Valid(&mainten_req_model, logged_user) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"errors": status_serializer.ValidatorErrs,
+		})
+		return
+	}
+
+	if err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		return status_serializer.Apply(tx, &mainten_req_model, logged_user)
+	}); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"errors": err.Error(),
+		})
+		return
+	}
+	mainten_req_model.Status = status_serializer.Status
+
+	var mainten_req_pub_serializer serializers.MaintenReqPublicSerializer
+
+	if err := mainten_req_pub_serializer.FromModel(&mainten_req_model); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	ctx.IndentedJSON(http.StatusOK, mainten_req_pub_serializer)
+}
+
+// GetMaintenRequestHistory lists status changes of maintenance request from the oldest one
+func GetMaintenRequestHistory(ctx *gin.Context) {
+	var mainten_req_model models.MaintenanceRequest
+
+	if result := utils.DB.Preload("StatusHistory", func(db *gorm.DB) *gorm.DB {
+		return db.Order("changed_at, id")
+	}).Preload("StatusHistory.ChangedBy").First(&mainten_req_model, ctx.Param("id")); result.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"error": "Maintenance request not found",
+		})
+		return
+	}
+
+	history := []serializers.MaintenStatusChangeSerializer{}
+	for i := range mainten_req_model.StatusHistory {
+		change := serializers.MaintenStatusChangeSerializer{}
+		if err := change.FromModel(&mainten_req_model.StatusHistory[i]); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		history = append(history, change)
+	}
+
+	ctx.IndentedJSON(http.StatusOK, history)
+}
+
 func DeleteMaintenRequest(ctx *gin.Context) {
 	id, err := utils.GetIDFromURL(ctx)
 
@@ -729,6 +874,14 @@ func DeleteMaintenRequest(ctx *gin.Context) {
 		return
 	}
 
+	attachments, err := serializers.Find_attachments("mainten_rep_ref IN (SELECT id FROM maintenance_reports WHERE mainten_req_ref = ?)", id)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
 	if result := utils.DB.Delete(request_model); result.Error != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"error": result.Error.Error(),
@@ -736,6 +889,8 @@ func DeleteMaintenRequest(ctx *gin.Context) {
 		return
 	}
 
+	serializers.Remove_attachment_files(attachments)
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"message": "maintenance request deleted successfully",
 	})
@@ -788,9 +943,15 @@ func CreateMaintenReport(ctx *gin.Context) {
 		return
 	}
 
-	if result := utils.DB.Create(report_model); result.Error != nil {
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Create(report_model); result.Error != nil {
+			return result.Error
+		}
+		return serializers.Save_report_items(tx, report_model, report_create_serializer.Items)
+	})
+	if err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-			"error": result.Error.Error(),
+			"error": err.Error(),
 		})
 		return
 	}
@@ -920,9 +1081,15 @@ func UpdateMaintenReport(ctx *gin.Context) {
 		return
 	}
 
-	if result := utils.DB.Save(report_model); result.Error != nil {
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Save(report_model); result.Error != nil {
+			return result.Error
+		}
+		return serializers.Save_report_items(tx, report_model, report_update_serializer.Items)
+	})
+	if err != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-			"error": result.Error.Error(),
+			"error": err.Error(),
 		})
 		return
 	}
@@ -980,13 +1147,30 @@ func DeleteMaintenReport(ctx *gin.Context) {
 		return
 	}
 
-	if result := utils.DB.Delete(report_model); result.Error != nil {
+	attachments, err := serializers.Find_attachments("mainten_rep_ref = ?", id)
+	if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
-			"error": result.Error.Error(),
+			"error": err.Error(),
 		})
 		return
 	}
 
+	// parts used in deleted report are returned to stock
+	err = utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := serializers.Return_report_items(tx, &report_model); err != nil {
+			return err
+		}
+		return tx.Delete(&report_model).Error
+	})
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	serializers.Remove_attachment_files(attachments)
+
 	ctx.IndentedJSON(http.StatusOK, gin.H{
 		"message": "maintenance report deleted successfully",
 	})
@@ -0,0 +1,156 @@
+// package views contains views used in router handlers
+// this file contains views for spare parts inventory
+package views
+
+import (
+	"net/http"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListSpareParts lists parts catalogue with stock, optionally filtered by ?search= in number or name
+func ListSpareParts(ctx *gin.Context) {
+	var part_models []models.SparePart
+	query := utils.DB.Order("name")
+	if search := ctx.Query("search"); search != "" {
+		query = query.Where("number ILIKE ? OR name ILIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+	if res := query.Find(&part_models); res.Error != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	parts := []serializers.SparePartSerializer{}
+	for i := range part_models {
+		part := serializers.SparePartSerializer{}
+		part.FromModel(&part_models[i])
+		parts = append(parts, part)
+	}
+	ctx.IndentedJSON(http.StatusOK, parts)
+}
+
+// ListLowStockParts lists parts which dropped to their minimal stock and need to be ordered
+func ListLowStockParts(ctx *gin.Context) {
+	parts, err := serializers.Low_stock_parts()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, parts)
+}
+
+// GetSparePart gets part of catalogue
+func GetSparePart(ctx *gin.Context) {
+	part_model := models.SparePart{}
+	if res := utils.DB.First(&part_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Spare part not found"})
+		return
+	}
+	part := serializers.SparePartSerializer{}
+	part.FromModel(&part_model)
+	ctx.IndentedJSON(http.StatusOK, part)
+}
+
+// CreateSparePart handles request for adding part into catalogue with its initial stock
+func CreateSparePart(ctx *gin.Context) {
+	part := serializers.SparePartCreateSerializer{}
+	if err := ctx.BindJSON(&part); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !part.Valid(nil) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": part.ValidatorErrs})
+		return
+	}
+	part_model := part.ToModel()
+	if res := utils.DB.Create(part_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": res.Error.Error()})
+		return
+	}
+	response := serializers.SparePartSerializer{}
+	response.FromModel(part_model)
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// UpdateSparePart handles request for updating part of catalogue, stock is not changed
+// new price is used only in reports saved later
+func UpdateSparePart(ctx *gin.Context) {
+	part_model := models.SparePart{}
+	if res := utils.DB.First(&part_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Spare part not found"})
+		return
+	}
+	part := serializers.SparePartCreateSerializer{}
+	if err := ctx.BindJSON(&part); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !part.Valid(&part_model.ID) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": part.ValidatorErrs})
+		return
+	}
+	part.UpdateModel(&part_model)
+	if res := utils.DB.Omit("Stock").Save(&part_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": res.Error.Error()})
+		return
+	}
+	response := serializers.SparePartSerializer{}
+	response.FromModel(&part_model)
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// RestockSparePart handles request for adding delivered parts into stock
+func RestockSparePart(ctx *gin.Context) {
+	part_model := models.SparePart{}
+	if res := utils.DB.First(&part_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Spare part not found"})
+		return
+	}
+	restock := serializers.SparePartRestockSerializer{}
+	if err := ctx.BindJSON(&restock); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !restock.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": restock.ValidatorErrs})
+		return
+	}
+	if res := utils.DB.Model(&part_model).Update("stock", gorm.Expr("stock + ?", restock.Quantity)); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": res.Error.Error()})
+		return
+	}
+	if res := utils.DB.First(&part_model, part_model.ID); res.Error != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	response := serializers.SparePartSerializer{}
+	response.FromModel(&part_model)
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// DeleteSparePart handles request for removing part from catalogue
+// part used in any maintenance report can not be deleted
+func DeleteSparePart(ctx *gin.Context) {
+	part_model := models.SparePart{}
+	if res := utils.DB.First(&part_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Spare part not found"})
+		return
+	}
+	var used int64
+	if res := utils.DB.Model(&models.MaintenanceReportItem{}).Where("spare_part_ref = ?", part_model.ID).Count(&used); res.Error != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	if used != 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Spare part is used in maintenance reports"})
+		return
+	}
+	if res := utils.DB.Delete(&part_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": res.Error.Error()})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Spare part deleted successfully"})
+}
@@ -0,0 +1,337 @@
+// package views contains views used in router handlers
+// this file contains views for journey planner
+package views
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// planner limits
+const (
+	plannerHorizon          = 24 * time.Hour
+	plannerMaxTransfers     = 5
+	plannerMaxItineraries   = 10
+	plannerDefaultTransfers = 3
+	plannerDefaultTransfer  = 2
+	plannerDefaultLimit     = 3
+)
+
+// plannerTrip is connection with its stops used while searching for journey
+type plannerTrip struct {
+	connection  models.Connection
+	vehicleType string
+	stops       []serializers.ConnectionStop
+}
+
+// plannerLeg is part of journey made in one trip
+type plannerLeg struct {
+	trip   *plannerTrip
+	board  int
+	alight int
+}
+
+// plannerLabel holds earliest known arrival to stop and the way it was reached
+type plannerLabel struct {
+	arrival time.Time
+	leg     *plannerLeg
+	prev    *plannerLabel
+}
+
+// plannerItinerary is journey found by planner
+type plannerItinerary struct {
+	legs []plannerLeg
+}
+
+func (it plannerItinerary) departure() time.Time {
+	first := it.legs[0]
+	return first.trip.stops[first.board].DepartureTime
+}
+
+func (it plannerItinerary) arrival() time.Time {
+	last := it.legs[len(it.legs)-1]
+	return last.trip.stops[last.alight].ArrivalTime
+}
+
+func (it plannerItinerary) transfers() int {
+	return len(it.legs) - 1
+}
+
+func (it plannerItinerary) key() string {
+	key := ""
+	for _, leg := range it.legs {
+		key += strconv.Itoa(int(leg.trip.connection.ID)) + ":" + strconv.Itoa(leg.board) + ":" + strconv.Itoa(leg.alight) + ";"
+	}
+	return key
+}
+
+// PlanJourney handles request for planning journey between two stops for not registered user
+// origin and destination are stations, platform given instead stands for its whole station,
+// journeys may change lines at stations shared by multiple lines, also between their platforms
+func PlanJourney(ctx *gin.Context) {
+	from := ctx.Query("from")
+	to := ctx.Query("to")
+	if from == "" || to == "" {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Origin and destination stop are required"})
+		return
+	}
+	stations, err := serializers.Stop_stations()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, stop_name := range []string{from, to} {
+		if _, ok := stations[stop_name]; !ok {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Stop " + stop_name + " does not exist"})
+			return
+		}
+	}
+	from, to = stations[from], stations[to]
+	if from == to {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Origin and destination stop must differ"})
+		return
+	}
+
+	departure := utils.Wall_clock_now()
+	if dep := ctx.Query("departure"); dep != "" {
+		departure, err = time.Parse("2006-01-02 15:04", dep)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid departure time"})
+			return
+		}
+	}
+
+	sort_by := ctx.DefaultQuery("sort", "arrival")
+	if sort_by != "arrival" && sort_by != "transfers" {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid sort, use arrival or transfers"})
+		return
+	}
+
+	min_transfer, err := plannerIntQuery(ctx, "min_transfer", plannerDefaultTransfer, 0, 60)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid minimum transfer time"})
+		return
+	}
+	max_transfers, err := plannerIntQuery(ctx, "max_transfers", plannerDefaultTransfers, 0, plannerMaxTransfers)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid maximum number of transfers"})
+		return
+	}
+	limit, err := plannerIntQuery(ctx, "limit", plannerDefaultLimit, 1, plannerMaxItineraries)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+
+	trips, err := loadPlannerTrips(departure, departure.Add(plannerHorizon))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// search repeatedly with later departure to offer alternatives
+	itineraries := []plannerItinerary{}
+	found := map[string]bool{}
+	search_from := departure
+	for i := 0; i < limit; i++ {
+		results := planJourney(trips, stations, from, to, search_from, time.Duration(min_transfer)*time.Minute, max_transfers)
+		if len(results) == 0 {
+			break
+		}
+		earliest := results[0].departure()
+		for _, itinerary := range results {
+			if !found[itinerary.key()] {
+				found[itinerary.key()] = true
+				itineraries = append(itineraries, itinerary)
+			}
+			if itinerary.departure().Before(earliest) {
+				earliest = itinerary.departure()
+			}
+		}
+		search_from = earliest.Add(time.Minute)
+	}
+
+	sort.SliceStable(itineraries, func(i, j int) bool {
+		a, b := itineraries[i], itineraries[j]
+		if sort_by == "transfers" && a.transfers() != b.transfers() {
+			return a.transfers() < b.transfers()
+		}
+		if !a.arrival().Equal(b.arrival()) {
+			return a.arrival().Before(b.arrival())
+		}
+		if a.transfers() != b.transfers() {
+			return a.transfers() < b.transfers()
+		}
+		return a.departure().After(b.departure())
+	})
+	if len(itineraries) > limit {
+		itineraries = itineraries[:limit]
+	}
+
+	response := []serializers.ItinerarySerializer{}
+	for _, itinerary := range itineraries {
+		response = append(response, itinerarySerializer(itinerary, stations))
+	}
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// plannerIntQuery parses optional integer query parameter in given range
+func plannerIntQuery(ctx *gin.Context, name string, def int, min int, max int) (int, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return def, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if number < min || number > max {
+		return 0, strconv.ErrRange
+	}
+	return number, nil
+}
+
+// loadPlannerTrips loads connections available to passengers running between given times
+// together with times of stops they serve, cancelled connections are left out
+func loadPlannerTrips(from time.Time, to time.Time) ([]plannerTrip, error) {
+	var connection_models []models.Connection
+	res := utils.DB.Order("departure_time").
+		Where("driver_id IS NOT NULL AND vehicle_registration IS NOT NULL AND status <> ? AND arrival_time >= ? AND departure_time <= ?", models.CancelledConnection, from, to).
+		Find(&connection_models)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	trips := []plannerTrip{}
+	vehicle_types := map[string]string{}
+	for _, model := range connection_models {
+		connection_stops, err := serializers.Get_connection_stops(model.LineName, model.Direction, model.DepartureTime)
+		if err != nil {
+			return nil, err
+		}
+		stops := []serializers.ConnectionStop{}
+		for i, stop := range connection_stops {
+			if !model.StopCancelled(i) {
+				stops = append(stops, stop)
+			}
+		}
+		if len(stops) < 2 {
+			continue
+		}
+		vehicle_type, err := vehicleType(*model.VehicleRegistration, vehicle_types)
+		if err != nil {
+			return nil, err
+		}
+		trips = append(trips, plannerTrip{
+			connection:  model,
+			vehicleType: vehicle_type,
+			stops:       stops,
+		})
+	}
+	return trips, nil
+}
+
+// planJourney searches for journeys from origin to destination station in rounds
+// round k finds earliest arrivals using at most k transfers so the result
+// contains for every number of transfers the journey with earliest arrival
+// if it arrives sooner than every journey with fewer transfers,
+// arrivals are kept for stations given by stations map of stop names
+func planJourney(trips []plannerTrip, stations map[string]string, from string, to string, departure time.Time, min_transfer time.Duration, max_transfers int) []plannerItinerary {
+	itineraries := []plannerItinerary{}
+	previous := map[string]*plannerLabel{from: {arrival: departure}}
+	var best *plannerLabel
+
+	for round := 0; round <= max_transfers; round++ {
+		current := map[string]*plannerLabel{}
+		for stop, label := range previous {
+			current[stop] = label
+		}
+		improved := false
+
+		for t := range trips {
+			trip := &trips[t]
+			var boarded *plannerLabel
+			board := 0
+			for i, stop := range trip.stops {
+				station := stations[stop.StopName]
+				if boarded != nil {
+					label, ok := current[station]
+					if !ok || stop.ArrivalTime.Before(label.arrival) {
+						current[station] = &plannerLabel{
+							arrival: stop.ArrivalTime,
+							leg:     &plannerLeg{trip: trip, board: board, alight: i},
+							prev:    boarded,
+						}
+						improved = true
+					}
+					continue
+				}
+				if i == len(trip.stops)-1 {
+					break
+				}
+				label, ok := previous[station]
+				if !ok {
+					continue
+				}
+				ready := label.arrival
+				if label.leg != nil {
+					ready = ready.Add(min_transfer)
+				}
+				if !stop.DepartureTime.Before(ready) {
+					boarded = label
+					board = i
+				}
+			}
+		}
+
+		if label, ok := current[to]; ok && label != best && (best == nil || label.arrival.Before(best.arrival)) {
+			best = label
+			itineraries = append(itineraries, plannerItineraryFromLabel(label))
+		}
+		if !improved {
+			break
+		}
+		previous = current
+	}
+	return itineraries
+}
+
+// plannerItineraryFromLabel walks back from label to origin and collects legs of journey
+func plannerItineraryFromLabel(label *plannerLabel) plannerItinerary {
+	legs := []plannerLeg{}
+	for ; label != nil && label.leg != nil; label = label.prev {
+		legs = append([]plannerLeg{*label.leg}, legs...)
+	}
+	return plannerItinerary{legs: legs}
+}
+
+// itinerarySerializer converts found journey into serializer
+func itinerarySerializer(itinerary plannerItinerary, stations map[string]string) serializers.ItinerarySerializer {
+	serializer := serializers.ItinerarySerializer{
+		DepartureTime: itinerary.departure().Format("2006-01-02 15:04"),
+		ArrivalTime:   itinerary.arrival().Format("2006-01-02 15:04"),
+		Duration:      uint(itinerary.arrival().Sub(itinerary.departure()).Minutes()),
+		Transfers:     itinerary.transfers(),
+		Legs:          []serializers.ItineraryLegSerializer{},
+	}
+	for _, leg := range itinerary.legs {
+		serializer.Legs = append(serializer.Legs, serializers.ItineraryLegSerializer{
+			ConnectionID:  leg.trip.connection.ID,
+			LineName:      leg.trip.connection.LineName,
+			VehicleType:   leg.trip.vehicleType,
+			FromStop:      leg.trip.stops[leg.board].StopName,
+			FromStation:   stations[leg.trip.stops[leg.board].StopName],
+			ToStop:        leg.trip.stops[leg.alight].StopName,
+			ToStation:     stations[leg.trip.stops[leg.alight].StopName],
+			DepartureTime: leg.trip.stops[leg.board].DepartureTime.Format("2006-01-02 15:04"),
+			ArrivalTime:   leg.trip.stops[leg.alight].ArrivalTime.Format("2006-01-02 15:04"),
+		})
+	}
+	return serializer
+}
@@ -0,0 +1,182 @@
+// package views contains views used in router handlers
+// this file contains views for preventive maintenance plans and mileage of vehicles
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ListMaintenPlans lists maintenance plans, optionally only for ?vehicle_type= or ?vehicle=
+func ListMaintenPlans(ctx *gin.Context) {
+	var plan_models []models.MaintenancePlan
+	query := utils.DB.Preload("CreatedBy").Order("id")
+	if vehicle_type := ctx.Query("vehicle_type"); vehicle_type != "" {
+		query = query.Where("vehicle_type_name = ?", vehicle_type)
+	}
+	if vehicle := ctx.Query("vehicle"); vehicle != "" {
+		query = query.Where("vehicle_ref = ? OR vehicle_type_name = (SELECT vehicle_type_name FROM vehicles WHERE registration = ?)", vehicle, vehicle)
+	}
+	if res := query.Find(&plan_models); res.Error != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+		return
+	}
+	plans := []serializers.MaintenPlanSerializer{}
+	for i := range plan_models {
+		plan := serializers.MaintenPlanSerializer{}
+		plan.FromModel(&plan_models[i])
+		plans = append(plans, plan)
+	}
+	ctx.IndentedJSON(http.StatusOK, plans)
+}
+
+// GetMaintenPlan gets maintenance plan with state of each of its vehicles
+func GetMaintenPlan(ctx *gin.Context) {
+	plan_model := models.MaintenancePlan{}
+	if res := utils.DB.Preload("CreatedBy").First(&plan_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Maintenance plan not found"})
+		return
+	}
+	plan := serializers.MaintenPlanSerializer{}
+	plan.FromModel(&plan_model)
+	if err := plan.LoadVehicles(&plan_model, time.Now()); err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, plan)
+}
+
+// CreateMaintenPlan handles request for creating maintenance plan
+// plan is measured from its creation until it creates first request
+func CreateMaintenPlan(ctx *gin.Context) {
+	logged_user, err := models.GetUserFromCtx(ctx)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	plan := serializers.MaintenPlanCreateSerializer{}
+	if err := ctx.BindJSON(&plan); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !plan.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": plan.ValidatorErrs})
+		return
+	}
+	plan_model := plan.ToModel(logged_user.ID)
+	if res := utils.DB.Create(plan_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": res.Error.Error()})
+		return
+	}
+	plan_model.CreatedBy = logged_user
+	response := serializers.MaintenPlanSerializer{}
+	response.FromModel(plan_model)
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// UpdateMaintenPlan handles request for updating maintenance plan
+// requests already created by the plan are kept
+func UpdateMaintenPlan(ctx *gin.Context) {
+	plan_model := models.MaintenancePlan{}
+	if res := utils.DB.Preload("CreatedBy").First(&plan_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Maintenance plan not found"})
+		return
+	}
+	plan := serializers.MaintenPlanCreateSerializer{}
+	if err := ctx.BindJSON(&plan); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !plan.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": plan.ValidatorErrs})
+		return
+	}
+	plan.UpdateModel(&plan_model)
+	if res := utils.DB.Omit("CreatedBy", "VehicleType", "Vehicle").Save(&plan_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": res.Error.Error()})
+		return
+	}
+	response := serializers.MaintenPlanSerializer{}
+	response.FromModel(&plan_model)
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// DeleteMaintenPlan handles request for deleting maintenance plan
+// requests created by the plan are kept without it
+func DeleteMaintenPlan(ctx *gin.Context) {
+	plan_model := models.MaintenancePlan{}
+	if res := utils.DB.First(&plan_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Maintenance plan not found"})
+		return
+	}
+	if res := utils.DB.Delete(&plan_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": res.Error.Error()})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Maintenance plan deleted successfully"})
+}
+
+// RunMaintenPlans handles request for creating maintenance requests of plans which are due now
+func RunMaintenPlans(ctx *gin.Context) {
+	created, err := serializers.Schedule_maintenance(time.Now())
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	requests := []serializers.MaintenReqShortPublicSerializer{}
+	for i := range created {
+		request := serializers.MaintenReqShortPublicSerializer{}
+		if err := request.FromModel(&created[i]); err != nil {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		requests = append(requests, request)
+	}
+	ctx.IndentedJSON(http.StatusOK, requests)
+}
+
+// GetVehicleMileage gets estimated current mileage of vehicle with given registration
+func GetVehicleMileage(ctx *gin.Context) {
+	vehicle := models.Vehicle{}
+	if res := utils.DB.First(&vehicle, "registration = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Vehicle not found"})
+		return
+	}
+	mileage, err := serializers.Get_mileage(vehicle.Registration, time.Now())
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, mileage)
+}
+
+// CreateOdometerReading handles request for entering mileage of vehicle manually
+func CreateOdometerReading(ctx *gin.Context) {
+	logged_user, err := models.GetUserFromCtx(ctx)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reading := serializers.OdometerReadingCreateSerializer{}
+	if err := ctx.BindJSON(&reading); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !reading.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": reading.ValidatorErrs})
+		return
+	}
+	reading_model := reading.ToModel(logged_user.ID)
+	if res := utils.DB.Create(reading_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"errors": res.Error.Error()})
+		return
+	}
+	response := serializers.OdometerReadingSerializer{}
+	response.FromModel(reading_model)
+	ctx.IndentedJSON(http.StatusOK, response)
+}
@@ -0,0 +1,136 @@
+// package views contains views used in router handlers
+// this file contains views for qualifications of drivers
+package views
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetQualifications gets licences and route knowledge of driver with given id
+// driver can get only own qualifications
+func GetQualifications(ctx *gin.Context) {
+	logged_user, err := models.GetUserFromCtx(ctx)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	driver := models.User{}
+	res := utils.DB.Preload("Licences", func(db *gorm.DB) *gorm.DB {
+		return db.Order("valid_until")
+	}).Preload("RouteKnowledge", func(db *gorm.DB) *gorm.DB {
+		return db.Order("line_name")
+	}).First(&driver, "id = ? AND role = ?", ctx.Param("id"), models.DriverRole)
+	if res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Driver not found"})
+		return
+	}
+	if logged_user.Role == models.DriverRole && logged_user.ID != driver.ID {
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{"error": "permission denied"})
+		return
+	}
+	qualifications := serializers.QualificationsSerializer{}
+	qualifications.FromModel(&driver)
+	ctx.IndentedJSON(http.StatusOK, qualifications)
+}
+
+// ListExpiringQualifications lists licences and route knowledge expiring in next ?days= days
+// or already expired, QualificationsDefaultDays are used when not given
+func ListExpiringQualifications(ctx *gin.Context) {
+	days := serializers.QualificationsDefaultDays
+	if value := ctx.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid number of days"})
+			return
+		}
+		days = parsed
+	}
+	now := time.Now()
+	until := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, days)
+	report, err := serializers.Expiring_qualifications(until)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, report)
+}
+
+// CreateLicence handles request for recording licence of driver
+func CreateLicence(ctx *gin.Context) {
+	licence := serializers.LicenceCreateSerializer{}
+	if err := ctx.BindJSON(&licence); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !licence.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, licence.ValidatorErrs)
+		return
+	}
+	licence_model := licence.CreateModel()
+	if res := utils.DB.Create(&licence_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	utils.DB.Preload("Driver").First(&licence_model, licence_model.ID)
+	response := serializers.LicenceSerializer{}
+	response.FromModel(&licence_model)
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// DeleteLicence handles request for deleting licence
+func DeleteLicence(ctx *gin.Context) {
+	licence_model := models.Licence{}
+	if res := utils.DB.First(&licence_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Licence not found"})
+		return
+	}
+	if res := utils.DB.Delete(&licence_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Licence deleted successfully"})
+}
+
+// CreateRouteKnowledge handles request for recording route knowledge of driver
+func CreateRouteKnowledge(ctx *gin.Context) {
+	knowledge := serializers.RouteKnowledgeCreateSerializer{}
+	if err := ctx.BindJSON(&knowledge); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !knowledge.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, knowledge.ValidatorErrs)
+		return
+	}
+	knowledge_model := knowledge.CreateModel()
+	if res := utils.DB.Create(&knowledge_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	utils.DB.Preload("Driver").First(&knowledge_model, knowledge_model.ID)
+	response := serializers.RouteKnowledgeSerializer{}
+	response.FromModel(&knowledge_model)
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// DeleteRouteKnowledge handles request for deleting route knowledge
+func DeleteRouteKnowledge(ctx *gin.Context) {
+	knowledge_model := models.RouteKnowledge{}
+	if res := utils.DB.First(&knowledge_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Route knowledge not found"})
+		return
+	}
+	if res := utils.DB.Delete(&knowledge_model); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Route knowledge deleted successfully"})
+}
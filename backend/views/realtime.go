@@ -0,0 +1,69 @@
+// package views contains views used in router handlers
+// this file contains views for real-time vehicle data
+package views
+
+import (
+	"net/http"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RecordRealtimeEvent handles position or departure from stop reported for connection
+// drivers can report only connections assigned to them, AVL gateway any connection
+func RecordRealtimeEvent(ctx *gin.Context) {
+	connection_model := models.Connection{}
+	if res := utils.DB.First(&connection_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
+		return
+	}
+	if value, ok := ctx.Get("user"); ok {
+		user := value.(models.User)
+		if user.Role == models.DriverRole && (connection_model.DriverID == nil || *connection_model.DriverID != user.ID) {
+			ctx.IndentedJSON(http.StatusForbidden, gin.H{"error": "Connection is not assigned to you"})
+			return
+		}
+	}
+	event := serializers.RealtimeEventSerializer{}
+	if err := ctx.BindJSON(&event); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !event.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, event.ValidatorErrs)
+		return
+	}
+	event_model, err := event.CreateModel(&connection_model)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := serializers.Record_realtime_event(&connection_model, event_model); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	realtime := serializers.RealtimeSerializer{}
+	if err := realtime.FromModel(connection_model); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, realtime)
+}
+
+// GetRealtime gets delay, last position and expected times of connection for not registered user
+func GetRealtime(ctx *gin.Context) {
+	connection_model := models.Connection{}
+	res := utils.DB.Where(serializers.PublicConnections).First(&connection_model, "id = ?", ctx.Param("id"))
+	if res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Connection not found"})
+		return
+	}
+	realtime := serializers.RealtimeSerializer{}
+	if err := realtime.FromModel(connection_model); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, realtime)
+}
@@ -0,0 +1,49 @@
+// package views contains views used in router handlers
+// this file contains views for automatic roster of drivers and vehicles
+package views
+
+import (
+	"net/http"
+
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/gin-gonic/gin"
+)
+
+// PreviewRoster handles request for proposing drivers and vehicles for unassigned connections
+// nothing is assigned, proposal can be edited and committed by CommitRoster
+func PreviewRoster(ctx *gin.Context) {
+	preview := serializers.RosterPreviewSerializer{}
+	if err := ctx.BindJSON(&preview); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !preview.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, preview.ValidatorErrs)
+		return
+	}
+	roster, err := preview.Propose()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, roster)
+}
+
+// CommitRoster handles request for assigning previewed roster
+// either all assignments are saved or none of them
+func CommitRoster(ctx *gin.Context) {
+	roster := serializers.RosterCommitSerializer{}
+	if err := ctx.BindJSON(&roster); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !roster.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, roster.ValidatorErrs)
+		return
+	}
+	if err := roster.Commit(); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{"assigned": len(roster.Assignments)})
+}
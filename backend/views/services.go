@@ -0,0 +1,236 @@
+// package views contains views used in router handlers
+// this file contains views for recurring services
+package views
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/AdamPekny/IIS/backend/models"
+	"github.com/AdamPekny/IIS/backend/serializers"
+	"github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListServices lists all recurring services, optionally only for given line
+func ListServices(ctx *gin.Context) {
+	var service_models []models.Service
+	query := utils.DB.Preload("Exceptions").Order("line_name, departure_time")
+	if line := ctx.Query("line"); line != "" {
+		query = query.Where("line_name = ?", line)
+	}
+	if res := query.Find(&service_models); res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	services := []serializers.ServiceSerializer{}
+	for i := range service_models {
+		service := serializers.ServiceSerializer{}
+		service.FromModel(&service_models[i])
+		services = append(services, service)
+	}
+	ctx.IndentedJSON(http.StatusOK, services)
+}
+
+// GetService gets recurring service with given id
+func GetService(ctx *gin.Context) {
+	service_model := models.Service{}
+	if res := utils.DB.Preload("Exceptions").First(&service_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+		return
+	}
+	service := serializers.ServiceSerializer{}
+	service.FromModel(&service_model)
+	ctx.IndentedJSON(http.StatusOK, service)
+}
+
+// UpdateService handles request for updating recurring service
+// future connections of the service are updated, removed or generated to match it
+func UpdateService(ctx *gin.Context) {
+	service_model := models.Service{}
+	if res := utils.DB.Preload("Exceptions").First(&service_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+		return
+	}
+	service := serializers.ServiceUpdateSerializer{}
+	if err := ctx.BindJSON(&service); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !service.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, service.ValidatorErrs)
+		return
+	}
+	validators.Line_vehicle_validator(service_model.LineName, service.VehicleReg, &service.ValidatorErrs)
+	if !equalPtr(service.VehicleReg, service_model.VehicleRegistration) {
+		validators.Vehicle_maintenance_validator(service.VehicleReg, &service.ValidatorErrs)
+	}
+	if len(service.ValidatorErrs) != 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, service.ValidatorErrs)
+		return
+	}
+	orig_vehicle := service_model.VehicleRegistration
+	orig_driver := service_model.DriverID
+	service.UpdateModel(&service_model)
+	vehicle_changed := !equalPtr(orig_vehicle, service_model.VehicleRegistration)
+	driver_changed := !equalPtr(orig_driver, service_model.DriverID)
+
+	var future []models.Connection
+	res := utils.DB.Where("service_id = ? AND departure_time >= ?", service_model.ID, utils.Wall_clock_now()).Order("departure_time").Find(&future)
+	if res.Error != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+		return
+	}
+	to_save := []models.Connection{}
+	to_delete := []models.Connection{}
+	for _, connection := range future {
+		if connection.ServiceDay == nil || !service_model.RunsOn(*connection.ServiceDay) {
+			to_delete = append(to_delete, connection)
+			continue
+		}
+		departure, err := serializers.Service_departure(&service_model, *connection.ServiceDay)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		connection.DepartureTime = departure
+		connection.ArrivalTime = serializers.Get_arrival_time(departure, service_model.LineName, service_model.Direction)
+		connection.Direction = service_model.Direction
+		if vehicle_changed {
+			connection.VehicleRegistration = service_model.VehicleRegistration
+		}
+		if driver_changed {
+			connection.DriverID = service_model.DriverID
+		}
+		to_save = append(to_save, connection)
+	}
+	from, to := serializers.Service_generation_range(&service_model, utils.Wall_clock_now().AddDate(0, 0, serializers.ServiceHorizonDays))
+	to_create := []models.Connection{}
+	if !to.Before(from) {
+		var err error
+		to_create, err = serializers.Service_connections(&service_model, from, to)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// checking validity of updated and generated connections
+	for _, connection := range append(to_save, to_create...) {
+		id := -1
+		if connection.ID != 0 {
+			id = int(connection.ID)
+		}
+		departure := connection.DepartureTime.Format("2006-01-02 15:04")
+		validators.Vehicle_availability(id, connection.VehicleRegistration, departure, connection.ArrivalTime, 1, &service.ValidatorErrs)
+		validators.Driver_availability(id, connection.DriverID, departure, connection.ArrivalTime, 1, &service.ValidatorErrs)
+		validators.Driver_qualification_validator(connection.DriverID, connection.VehicleRegistration, connection.LineName, connection.DepartureTime, connection.ArrivalTime, &service.ValidatorErrs)
+		if len(service.ValidatorErrs) != 0 {
+			ctx.IndentedJSON(http.StatusBadRequest, service.ValidatorErrs)
+			return
+		}
+		res := utils.DB.Where("line_name = ? AND departure_time = ? AND (service_id IS NULL OR service_id <> ?)", connection.LineName, connection.DepartureTime, service_model.ID).Find(&models.Connection{})
+		if res.Error != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, res.Error.Error())
+			return
+		}
+		if res.RowsAffected != 0 {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Some connection at same time for this line already exists"})
+			return
+		}
+	}
+
+	validators.Connections_working_time(append(to_save, to_create...), &service.ValidatorErrs)
+	if len(service.ValidatorErrs) != 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, service.ValidatorErrs)
+		return
+	}
+
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("service_id = ?", service_model.ID).Delete(&models.ServiceException{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Session(&gorm.Session{FullSaveAssociations: true}).Omit("Connections").Save(&service_model).Error; err != nil {
+			return err
+		}
+		for i := range to_delete {
+			if err := tx.Delete(&to_delete[i]).Error; err != nil {
+				return err
+			}
+		}
+		for i := range to_save {
+			if err := tx.Save(&to_save[i]).Error; err != nil {
+				return err
+			}
+		}
+		if len(to_create) != 0 {
+			return tx.Create(&to_create).Error
+		}
+		return nil
+	})
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	response := serializers.ServiceSerializer{}
+	response.FromModel(&service_model)
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// DeleteService handles request for deleting recurring service
+// future connections are deleted, past connections are kept without service
+func DeleteService(ctx *gin.Context) {
+	service_model := models.Service{}
+	if res := utils.DB.First(&service_model, "id = ?", ctx.Param("id")); res.Error != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+		return
+	}
+	err := utils.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("service_id = ? AND departure_time >= ?", service_model.ID, utils.Wall_clock_now()).Delete(&models.Connection{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Connection{}).Where("service_id = ?", service_model.ID).Update("service_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&service_model).Error
+	})
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Service deleted successfully"})
+}
+
+// GenerateServices handles request for generating connections of all services until given day
+func GenerateServices(ctx *gin.Context) {
+	generate := serializers.ServiceGenerateSerializer{}
+	if err := ctx.BindJSON(&generate); err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	until, err := time.Parse("2006-01-02", generate.Until)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if until.After(utils.Wall_clock_now().AddDate(0, 0, serializers.ServiceMaxDays)) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Connections can be generated at most a year ahead"})
+		return
+	}
+	created, err := serializers.Generate_service_connections(until)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{"created": created})
+}
+
+// equalPtr checks if two optional values are equal
+func equalPtr[T comparable](a *T, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
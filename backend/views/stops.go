@@ -4,6 +4,7 @@ package views
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/AdamPekny/IIS/backend/models"
@@ -12,8 +13,25 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	nearestStopsDefaultLimit = 5
+	nearestStopsMaxLimit     = 50
+	nearestStopsMaxRadius    = 50000 // meters
+)
+
 // ListStops lists every stop in the database
+// with stations query only stations and stops which are not platforms are listed
 func ListStops(ctx *gin.Context) {
+	listStops(ctx, ctx.Query("stations") == "true")
+}
+
+// ListStations lists stations and stops which are not platforms for passenger search
+func ListStations(ctx *gin.Context) {
+	listStops(ctx, true)
+}
+
+// listStops lists stops with name matching query, platforms of stations are left out when stations is set
+func listStops(ctx *gin.Context, stations bool) {
 	var stopModels []models.Stop
 	var stopSerializers []serializers.StopSerializer
 
@@ -25,6 +43,9 @@ func ListStops(ctx *gin.Context) {
 	if query != "" {
 		dbQuery = dbQuery.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(query)+"%")
 	}
+	if stations {
+		dbQuery = dbQuery.Where("parent_id IS NULL")
+	}
 
 	// Fetch stops from the database based on the query
 	res := dbQuery.Find(&stopModels)
@@ -87,7 +108,15 @@ func EditStop(ctx *gin.Context) {
 		return
 	}
 
-	existingStop.Name = editRequest.Name
+	editRequest.ID = existingStop.ID
+	if !editRequest.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"errors": editRequest.ValidatorErrs,
+		})
+		return
+	}
+
+	editRequest.ToModel(&existingStop)
 	result = utils.DB.Save(&existingStop)
 
 	if result.Error != nil {
@@ -97,10 +126,8 @@ func EditStop(ctx *gin.Context) {
 		return
 	}
 
-	stopSerializer := serializers.StopSerializer{
-		ID:   existingStop.ID,
-		Name: existingStop.Name,
-	}
+	stopSerializer := serializers.StopSerializer{}
+	stopSerializer.FromModel(existingStop)
 
 	ctx.IndentedJSON(http.StatusOK, stopSerializer)
 }
@@ -123,12 +150,15 @@ func CreateStop(ctx *gin.Context) {
 		})
 		return
 	}
+	if !createRequest.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"errors": createRequest.ValidatorErrs,
+		})
+		return
+	}
 
 	// Create a new stop
-	newStop := models.Stop{
-		Name: createRequest.Name,
-		// Add other fields if needed
-	}
+	newStop := createRequest.ToModel()
 
 	// Save the new stop to the database
 	result := utils.DB.Create(&newStop)
@@ -140,11 +170,8 @@ func CreateStop(ctx *gin.Context) {
 	}
 
 	// Return the created stop in the response
-	stopSerializer := serializers.StopSerializer{
-		ID:   newStop.ID,
-		Name: newStop.Name,
-		// Add other fields if needed
-	}
+	stopSerializer := serializers.StopSerializer{}
+	stopSerializer.FromModel(newStop)
 
 	ctx.IndentedJSON(http.StatusOK, stopSerializer)
 }
@@ -188,3 +215,48 @@ func DeleteStop(ctx *gin.Context) {
 	})
 
 }
+
+// ListStopsGeoJSON lists stops with coordinates as GeoJSON points for maps
+func ListStopsGeoJSON(ctx *gin.Context) {
+	var stopModels []models.Stop
+	if res := utils.DB.Order("name").Find(&stopModels); res.Error != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "Could not retrieve stops!",
+		})
+		return
+	}
+	ctx.Header("Content-Type", "application/geo+json; charset=utf-8")
+	ctx.IndentedJSON(http.StatusOK, serializers.Stops_geojson(stopModels))
+}
+
+// ListNearestStops lists stops closest to place given by lat and lon query with their distance in meters
+// number of stops is limited by limit query and their distance by optional radius query in meters
+func ListNearestStops(ctx *gin.Context) {
+	latitude, err := strconv.ParseFloat(ctx.Query("lat"), 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid lat"})
+		return
+	}
+	longitude, err := strconv.ParseFloat(ctx.Query("lon"), 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid lon"})
+		return
+	}
+	limit, err := plannerIntQuery(ctx, "limit", nearestStopsDefaultLimit, 1, nearestStopsMaxLimit)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	radius, err := plannerIntQuery(ctx, "radius", 0, 0, nearestStopsMaxRadius)
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Invalid radius"})
+		return
+	}
+
+	stops, err := serializers.Nearest_stops(latitude, longitude, limit, float64(radius))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, stops)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/AdamPekny/IIS/backend/models"
 	"github.com/AdamPekny/IIS/backend/serializers"
 	utils "github.com/AdamPekny/IIS/backend/utils"
+	"github.com/AdamPekny/IIS/backend/validators"
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,7 +22,7 @@ func List_vehicles(ctx *gin.Context) {
 	var vehicle_serializers []serializers.VehicleGetSerializer
 	for _, vehicle := range vehicles {
 		mainteneces := []models.MaintenanceRequest{}
-		res := utils.DB.Joins("JOIN malfunction_reports ON maintenance_requests.malfunc_rep_ref = malfunction_reports.id").Where("vehicle_ref = ?", vehicle.Registration).
+		res := utils.DB.Where("vehicle_ref = ?", vehicle.Registration).
 			Order("created_at DESC").Find(&mainteneces)
 		if res.Error != nil {
 			ctx.IndentedJSON(http.StatusBadRequest, res.Error)
@@ -33,6 +34,8 @@ func List_vehicles(ctx *gin.Context) {
 				Capacity:     vehicle.Capacity,
 				Brand:        vehicle.Brand,
 				Type:         vehicle.VehicleType.Type,
+				ImageURL:     serializers.Vehicle_image_url(&vehicle, false),
+				ThumbnailURL: serializers.Vehicle_image_url(&vehicle, true),
 				LastMaintenance: serializers.LastMaintenance{
 					Status: "-",
 					Date:   "-",
@@ -47,6 +50,8 @@ func List_vehicles(ctx *gin.Context) {
 				Capacity:     vehicle.Capacity,
 				Brand:        vehicle.Brand,
 				Type:         vehicle.VehicleType.Type,
+				ImageURL:     serializers.Vehicle_image_url(&vehicle, false),
+				ThumbnailURL: serializers.Vehicle_image_url(&vehicle, true),
 				LastMaintenance: serializers.LastMaintenance{
 					Status: string(mainteneces[0].Status),
 					Date:   mainteneces[0].MaintenRep.CreatedAt.Format("2006-01-02 15:04"),
@@ -59,6 +64,8 @@ func List_vehicles(ctx *gin.Context) {
 				Capacity:     vehicle.Capacity,
 				Brand:        vehicle.Brand,
 				Type:         vehicle.VehicleType.Type,
+				ImageURL:     serializers.Vehicle_image_url(&vehicle, false),
+				ThumbnailURL: serializers.Vehicle_image_url(&vehicle, true),
 				LastMaintenance: serializers.LastMaintenance{
 					Status: string(mainteneces[0].Status),
 					Date:   mainteneces[0].CreatedAt.Format("2006-01-02"),
@@ -90,6 +97,12 @@ func Create_vehicle(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, result.Error)
 		return
 	} else {
+		if len(vehicle.ImageData) != 0 {
+			if err := serializers.Save_vehicle_image(vehicle_model, vehicle.ImageData); err != nil {
+				ctx.IndentedJSON(http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
 		ctx.IndentedJSON(http.StatusOK, result)
 	}
 }
@@ -104,7 +117,7 @@ func GetVehicle(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, res.Error)
 		return
 	}
-	res = utils.DB.Joins("JOIN malfunction_reports ON maintenance_requests.malfunc_rep_ref = malfunction_reports.id").Where("vehicle_ref = ?", vehicle_id).
+	res = utils.DB.Where("vehicle_ref = ?", vehicle_id).
 		Order("created_at DESC").Find(&mainteneces)
 	if res.Error != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, res.Error)
@@ -116,6 +129,8 @@ func GetVehicle(ctx *gin.Context) {
 			Capacity:     vehicle.Capacity,
 			Brand:        vehicle.Brand,
 			Type:         vehicle.VehicleType.Type,
+			ImageURL:     serializers.Vehicle_image_url(&vehicle, false),
+			ThumbnailURL: serializers.Vehicle_image_url(&vehicle, true),
 			LastMaintenance: serializers.LastMaintenance{
 				Status: "-",
 				Date:   "-",
@@ -130,6 +145,8 @@ func GetVehicle(ctx *gin.Context) {
 			Capacity:     vehicle.Capacity,
 			Brand:        vehicle.Brand,
 			Type:         vehicle.VehicleType.Type,
+			ImageURL:     serializers.Vehicle_image_url(&vehicle, false),
+			ThumbnailURL: serializers.Vehicle_image_url(&vehicle, true),
 			LastMaintenance: serializers.LastMaintenance{
 				Status: string(mainteneces[0].Status),
 				Date:   mainteneces[0].MaintenRep.CreatedAt.Format("2006-01-02 15:04"),
@@ -143,6 +160,8 @@ func GetVehicle(ctx *gin.Context) {
 			Capacity:     vehicle.Capacity,
 			Brand:        vehicle.Brand,
 			Type:         vehicle.VehicleType.Type,
+			ImageURL:     serializers.Vehicle_image_url(&vehicle, false),
+			ThumbnailURL: serializers.Vehicle_image_url(&vehicle, true),
 			LastMaintenance: serializers.LastMaintenance{
 				Status: string(mainteneces[0].Status),
 				Date:   mainteneces[0].CreatedAt.Format("2006-01-02"),
@@ -180,6 +199,12 @@ func UpdateVehicle(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, result.Error)
 		return
 	} else {
+		if len(vehicle_serializer.ImageData) != 0 {
+			if err := serializers.Save_vehicle_image(&vehicle, vehicle_serializer.ImageData); err != nil {
+				ctx.IndentedJSON(http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
 		ctx.IndentedJSON(http.StatusOK, result)
 	}
 }
@@ -197,11 +222,13 @@ func DeleteVehicle(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, result.Error)
 		return
 	} else {
+		serializers.Remove_image(vehicle.ImageKey)
 		ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Vehicle deleted successfully"})
 	}
 }
 
-// ListNotBrokenVehicles lists vehicles that does not have any malfunction report or all of its malfunction reports are done
+// ListNotBrokenVehicles lists vehicles that can be assigned to connections
+// vehicles with maintenance request which takes them out of service are left out
 func ListNotBrokenVehicles(ctx *gin.Context) {
 	var vehicles []models.Vehicle
 	res := utils.DB.Preload("VehicleType").Find(&vehicles)
@@ -209,20 +236,18 @@ func ListNotBrokenVehicles(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, res.Error)
 		return
 	}
-	result := utils.DB.Table("vehicles").Joins("LEFT JOIN malfunction_reports ON vehicles.registration = malfunction_reports.vehicle_ref").
-		Joins("LEFT JOIN maintenance_requests ON maintenance_requests.malfunc_rep_ref = malfunction_reports.id").
-		Group("vehicles.registration").
-		Having("COUNT(DISTINCT malfunction_reports.id) = SUM(CASE WHEN maintenance_requests.status = 'done' THEN 1 ELSE 0 END)").Preload("VehicleType").
-		Find(&vehicles)
-	if result.Error != nil {
-		ctx.IndentedJSON(http.StatusBadRequest, result.Error)
+	in_maintenance, err := validators.Vehicles_in_maintenance()
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
 	var vehicle_serializers []serializers.VehicleGetSerializer
 	for _, vehicle := range vehicles {
+		if in_maintenance[vehicle.Registration] {
+			continue
+		}
 		mainteneces := []models.MaintenanceRequest{}
-		res := utils.DB.Joins("JOIN malfunction_reports ON maintenance_requests.malfunc_rep_ref = malfunction_reports.id").
-			Where("vehicle_ref = ?", vehicle.Registration).
+		res := utils.DB.Where("vehicle_ref = ?", vehicle.Registration).
 			Order("created_at DESC").Find(&mainteneces)
 		if res.Error != nil {
 			ctx.IndentedJSON(http.StatusBadRequest, res.Error)
@@ -234,6 +259,8 @@ func ListNotBrokenVehicles(ctx *gin.Context) {
 				Capacity:     vehicle.Capacity,
 				Brand:        vehicle.Brand,
 				Type:         vehicle.VehicleType.Type,
+				ImageURL:     serializers.Vehicle_image_url(&vehicle, false),
+				ThumbnailURL: serializers.Vehicle_image_url(&vehicle, true),
 				LastMaintenance: serializers.LastMaintenance{
 					Status: "-",
 					Date:   "-",
@@ -246,6 +273,8 @@ func ListNotBrokenVehicles(ctx *gin.Context) {
 				Capacity:     vehicle.Capacity,
 				Brand:        vehicle.Brand,
 				Type:         vehicle.VehicleType.Type,
+				ImageURL:     serializers.Vehicle_image_url(&vehicle, false),
+				ThumbnailURL: serializers.Vehicle_image_url(&vehicle, true),
 				LastMaintenance: serializers.LastMaintenance{
 					Status: string(mainteneces[0].Status),
 					Date:   mainteneces[0].CreatedAt.Format("2006-01-02"),
@@ -266,6 +295,10 @@ func CreateVehicleType(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, err.Error())
 		return
 	}
+	if !vehicle_type.Valid() {
+		ctx.IndentedJSON(http.StatusBadRequest, vehicle_type.ValidatorErrs)
+		return
+	}
 	res := utils.DB.Where("type = ?", vehicle_type.Type).Find(&models.VehicleType{})
 	if res.Error != nil {
 		ctx.IndentedJSON(http.StatusBadRequest, res.Error)
@@ -283,6 +316,12 @@ func CreateVehicleType(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, result.Error)
 		return
 	} else {
+		if len(vehicle_type.IconData) != 0 {
+			if err := serializers.Save_vehicle_type_icon(&vehicle_type_model, vehicle_type.IconData); err != nil {
+				ctx.IndentedJSON(http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
 		ctx.IndentedJSON(http.StatusOK, result)
 	}
 }
@@ -297,7 +336,9 @@ func ListVehicleTypes(ctx *gin.Context) {
 	var vehicle_type_serializers []serializers.VehicleTypeSerializer
 	for _, vehicle_type := range vehicle_types {
 		vehicle_type_serializer := serializers.VehicleTypeSerializer{
-			Type: vehicle_type.Type,
+			Type:             vehicle_type.Type,
+			IconURL:          serializers.Vehicle_type_icon_url(&vehicle_type, false),
+			IconThumbnailURL: serializers.Vehicle_type_icon_url(&vehicle_type, true),
 		}
 		result := utils.DB.Where("vehicle_type_name=?", vehicle_type.Type).Find(&models.Vehicle{})
 		if result.Error != nil {
@@ -336,6 +377,7 @@ func DeleteVehicleType(ctx *gin.Context) {
 		ctx.IndentedJSON(http.StatusBadRequest, result.Error)
 		return
 	} else {
+		serializers.Remove_image(vehicle_type_model.IconKey)
 		ctx.IndentedJSON(http.StatusOK, gin.H{"message": "Vehicle type deleted successfully"})
 	}
 }
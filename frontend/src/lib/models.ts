@@ -42,6 +42,8 @@ export interface Vehicle {
     Capacity: number
     Brand: string
     Type: string
+    ImageURL: string | null
+    ThumbnailURL: string | null
     LastMaintenance: LastMaintenance
 }
 export interface NewVehicle {
@@ -62,12 +64,16 @@ export interface VehicleInList {
     Capacity: number
     Brand: string
     Type: string
+    ImageURL: string | null
+    ThumbnailURL: string | null
     LastMaintenance: LastMaintenance
 }
 
 export interface VehicleType {
     ID: string
     Type: VehicleTypeEnum
+    IconURL: string | null
+    IconThumbnailURL: string | null
 }
 
 export enum VehicleTypeEnum {
@@ -81,10 +87,24 @@ export interface Stop {
     ID: string
     Name: string
     Active: string
+    Latitude: number | null
+    Longitude: number | null
+    Platform: string | null
+    Accessible: boolean
+    Zone: string | null
+    ParentID: number | null
+    Station: string | null
+    Platforms: string[]
 }
 
 export interface NewStop {
     Name: string
+    Latitude?: number | null
+    Longitude?: number | null
+    Platform?: string | null
+    Accessible?: boolean
+    Zone?: string | null
+    ParentID?: number | null
 }
 
 export interface LineInList {
@@ -163,7 +183,11 @@ export interface RequestType {
     Status: string
     Deadline: string
     CreatedAt: string
-    MalfuncRep: MalfunctionReport
+    Title: string
+    VehicleRef: string | null
+    VehicleType: string
+    MalfuncRep: MalfunctionReport | null
+    MaintenPlanRef: number | null
     CreatedBy: User
     ResolvedBy: User
 }
@@ -181,6 +205,32 @@ export interface ConnectionList {
     DriverID: string | null
     DriverName: string | null
 }
+export interface DutyItem {
+    Type: string
+    StartTime: string
+    EndTime: string
+    FromStop: string
+    FromStation: string
+    ToStop: string
+    ToStation: string
+    Minutes: number
+    Connection: ConnectionList | null
+}
+export interface Duty {
+    DutyID: string | null
+    DepotName: string
+    SignOn: string
+    SignOff: string
+    DriverID: string | null
+    DriverName: string
+    VehicleReg: string | null
+    Items: DutyItem[]
+}
+export interface DutySheet {
+    DriverID: string
+    DriverName: string
+    Duties: Duty[]
+}
 export interface ConnectionDetail {
     ConnectionID: string
     LineName: string
@@ -204,7 +254,11 @@ export interface StopInConnection {
 export interface NewReport {
     Title: string
     Description: string
-    Cost: number | null
+    LabourHours: number | null
+}
+
+export interface Report extends NewReport {
+    Cost: number
 }
 
 export interface ConnectionUnauth {
@@ -6,6 +6,7 @@ require (
 	github.com/brianvoe/gofakeit/v6 v6.24.0
 	github.com/gin-contrib/cors v1.4.0
 	github.com/joho/godotenv v1.5.1
+	google.golang.org/protobuf v1.30.0
 )
 
 require (
@@ -32,7 +33,6 @@ require (
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	github.com/ugorji/go/codec v1.2.11 // indirect
 	golang.org/x/arch v0.3.0 // indirect
-	google.golang.org/protobuf v1.30.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"log"
+	"os"
+	"time"
+
 	api "github.com/AdamPekny/IIS/backend"
+	"github.com/AdamPekny/IIS/backend/serializers"
 	"github.com/AdamPekny/IIS/backend/utils"
 )
 
@@ -11,8 +16,41 @@ func init() {
 }
 
 func main() {
-	api.Migrate_all()
+	if err := api.Migrate_all(); err != nil {
+		log.Fatal(err)
+	}
+
+	if len(os.Args) > 1 {
+		if err := api.RunCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	go generateServices()
+	go scheduleMaintenance()
 
 	router := api.Router()
 	router.Run("0.0.0.0:8080")
 }
+
+// generateServices generates connections of services ServiceHorizonDays ahead now and then periodically,
+// so listings only read connections which already exist
+func generateServices() {
+	for {
+		if _, err := serializers.Generate_service_connections(utils.Wall_clock_now().AddDate(0, 0, serializers.ServiceHorizonDays)); err != nil {
+			log.Print(err)
+		}
+		time.Sleep(serializers.ServiceGenerateInterval)
+	}
+}
+
+// scheduleMaintenance creates requests of due maintenance plans now and then periodically
+func scheduleMaintenance() {
+	for {
+		if _, err := serializers.Schedule_maintenance(time.Now()); err != nil {
+			log.Print(err)
+		}
+		time.Sleep(serializers.MaintenanceScheduleInterval)
+	}
+}